@@ -0,0 +1,88 @@
+package db
+
+import "fmt"
+
+// Access checks shared by the db functions and the route policies. They take
+// the user ID from the session and report false for unknown batches or
+// questions as well as for users without access.
+
+// TeacherOwnsBatch reports whether the user is the teacher of the batch
+func TeacherOwnsBatch(userID, batchID int64) (bool, error) {
+	var owned bool
+	err := Con.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM batch b
+		JOIN teacher t ON t.id = b.teacher_id
+		WHERE b.id = ? AND t.user_id = ?)`, batchID, userID).Scan(&owned)
+	if err != nil {
+		return false, fmt.Errorf("error checking batch ownership: %w", err)
+	}
+	return owned, nil
+}
+
+// StudentInBatch reports whether the user is a student enrolled in the batch
+func StudentInBatch(userID, batchID int64) (bool, error) {
+	var enrolled bool
+	err := Con.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM batch_student bs
+		JOIN student s ON s.id = bs.student_id
+		WHERE bs.batch_id = ? AND s.user_id = ?)`, batchID, userID).Scan(&enrolled)
+	if err != nil {
+		return false, fmt.Errorf("error checking batch enrollment: %w", err)
+	}
+	return enrolled, nil
+}
+
+// TeacherOwnsQuestion reports whether the question is in a batch of the teacher
+func TeacherOwnsQuestion(userID, questionID int64) (bool, error) {
+	var owned bool
+	err := Con.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM question q
+		JOIN batch b ON b.id = q.batch_id
+		JOIN teacher t ON t.id = b.teacher_id
+		WHERE q.id = ? AND t.user_id = ?)`, questionID, userID).Scan(&owned)
+	if err != nil {
+		return false, fmt.Errorf("error checking question ownership: %w", err)
+	}
+	return owned, nil
+}
+
+// StudentCanSeeQuestion reports whether the user is a student enrolled in the
+// batch of the question
+func StudentCanSeeQuestion(userID, questionID int64) (bool, error) {
+	var enrolled bool
+	err := Con.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM question q
+		JOIN batch_student bs ON bs.batch_id = q.batch_id
+		JOIN student s ON s.id = bs.student_id
+		WHERE q.id = ? AND s.user_id = ?)`, questionID, userID).Scan(&enrolled)
+	if err != nil {
+		return false, fmt.Errorf("error checking batch enrollment: %w", err)
+	}
+	return enrolled, nil
+}
+
+// StudentOwnsAttempt reports whether the attempt is one of the user's, a student
+func StudentOwnsAttempt(userID, attemptID int64) (bool, error) {
+	var owned bool
+	err := Con.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM attempt a
+		JOIN student s ON s.id = a.student_id
+		WHERE a.id = ? AND s.user_id = ?)`, attemptID, userID).Scan(&owned)
+	if err != nil {
+		return false, fmt.Errorf("error checking attempt ownership: %w", err)
+	}
+	return owned, nil
+}
+
+// StudentOwnsSubmission reports whether the submission was made by the user, a student
+func StudentOwnsSubmission(userID, submissionID int64) (bool, error) {
+	var owned bool
+	err := Con.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM submission sub
+		JOIN student s ON s.id = sub.student_id
+		WHERE sub.id = ? AND s.user_id = ?)`, submissionID, userID).Scan(&owned)
+	if err != nil {
+		return false, fmt.Errorf("error checking submission ownership: %w", err)
+	}
+	return owned, nil
+}
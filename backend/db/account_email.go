@@ -0,0 +1,183 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Purposes of the one-time tokens mailed to users
+const (
+	tokenVerifyEmail   = "verify_email"
+	tokenResetPassword = "reset_password"
+)
+
+// How long the links in account emails work
+const (
+	verifyEmailTokenLifetime   = 48 * time.Hour
+	resetPasswordTokenLifetime = time.Hour
+)
+
+// AppURL is where the frontend is served, for links in emails and redirects
+func AppURL() string {
+	if u := strings.TrimRight(strings.TrimSpace(os.Getenv("APP_URL")), "/"); u != "" {
+		return u
+	}
+	return "http://localhost:5173"
+}
+
+// newUserToken creates a one-time token for a user and returns it. Only its
+// hash is stored, and earlier tokens of the user for the same purpose stop
+// working.
+func newUserToken(userID int64, purpose string, lifetime time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if _, err := Con.Exec("DELETE FROM user_token WHERE user_id = ? AND purpose = ?", userID, purpose); err != nil {
+		return "", fmt.Errorf("error deleting old tokens: %w", err)
+	}
+	_, err := Con.Exec("INSERT INTO user_token (user_id, purpose, token_hash, expires_at) VALUES (?, ?, ?, ?)",
+		userID, purpose, generateSHA256Hash(token), time.Now().Add(lifetime))
+	if err != nil {
+		return "", fmt.Errorf("error creating token: %w", err)
+	}
+	return token, nil
+}
+
+// consumeUserToken checks a token and deletes it, returning the user it was made for
+func consumeUserToken(token, purpose string) (int64, error) {
+	hash := generateSHA256Hash(strings.TrimSpace(token))
+
+	var userID int64
+	var expiresAt time.Time
+	err := Con.QueryRow("SELECT user_id, expires_at FROM user_token WHERE token_hash = ? AND purpose = ?",
+		hash, purpose).Scan(&userID, &expiresAt)
+	if err != nil {
+		return 0, errors.New("invalid or expired token")
+	}
+
+	// Deleting first means two requests with the same token can't both succeed
+	result, err := Con.Exec("DELETE FROM user_token WHERE token_hash = ?", hash)
+	if err != nil {
+		return 0, fmt.Errorf("error using token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 || time.Now().After(expiresAt) {
+		return 0, errors.New("invalid or expired token")
+	}
+	return userID, nil
+}
+
+// SendVerificationEmail mails a user a link to confirm their email address
+func SendVerificationEmail(userID int64) error {
+	var username, email string
+	err := Con.QueryRow("SELECT username, IFNULL(email, '') FROM user WHERE id = ?", userID).Scan(&username, &email)
+	if err != nil {
+		return fmt.Errorf("error retrieving user: %w", err)
+	}
+	if email == "" {
+		return errors.New("user has no email address")
+	}
+
+	token, err := newUserToken(userID, tokenVerifyEmail, verifyEmailTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	link := AppURL() + "/verify-email?token=" + url.QueryEscape(token)
+	return Mail.Send(Email{
+		To:      email,
+		Subject: "Confirm your ProCode email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address to start using your ProCode account:\n\n%s\n\n"+
+			"The link works for %d hours. If you didn't sign up, you can ignore this email.\n",
+			username, link, int(verifyEmailTokenLifetime.Hours())),
+	})
+}
+
+// ResendVerificationEmail mails a new verification link to the unverified
+// account with the email address. Unknown and verified addresses are ignored,
+// so the response doesn't tell who has an account.
+func ResendVerificationEmail(email string) error {
+	var userID int64
+	err := Con.QueryRow("SELECT id FROM user WHERE email = ? AND email_verified = FALSE", email).Scan(&userID)
+	if err != nil {
+		return nil
+	}
+	return SendVerificationEmail(userID)
+}
+
+// VerifyEmail confirms the email address of the user the token was sent to
+func VerifyEmail(token string) error {
+	userID, err := consumeUserToken(token, tokenVerifyEmail)
+	if err != nil {
+		return err
+	}
+	if _, err := Con.Exec("UPDATE user SET email_verified = TRUE WHERE id = ?", userID); err != nil {
+		return fmt.Errorf("error verifying email: %w", err)
+	}
+	return nil
+}
+
+// RequestPasswordReset mails a password reset link to the account with the
+// email address. Unknown addresses are ignored, so the response doesn't tell
+// who has an account.
+func RequestPasswordReset(email string) error {
+	var userID int64
+	var username string
+	err := Con.QueryRow("SELECT id, username FROM user WHERE email = ?", email).Scan(&userID, &username)
+	if err != nil {
+		return nil
+	}
+
+	token, err := newUserToken(userID, tokenResetPassword, resetPasswordTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	link := AppURL() + "/reset-password?token=" + url.QueryEscape(token)
+	return Mail.Send(Email{
+		To:      email,
+		Subject: "Reset your ProCode password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to choose a new password for your ProCode account:\n\n%s\n\n"+
+			"The link works for one hour. If you didn't ask for a new password, you can ignore this email.\n",
+			username, link),
+	})
+}
+
+// ResetPassword sets a new password for the user the reset token was sent
+// to. The link proves the user owns the email address, so it is marked as
+// verified, and every session is ended.
+func ResetPassword(token, newPassword string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	userID, err := consumeUserToken(token, tokenResetPassword)
+	if err != nil {
+		return err
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	_, err = Con.Exec(`
+		UPDATE user SET userpassword = ?, must_change_password = FALSE, email_verified = TRUE
+		WHERE id = ?`, hash, userID)
+	if err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+
+	if _, err := RevokeUserSessions(userID, "password_reset"); err != nil {
+		log.Printf("Error ending sessions of user %d after password reset: %v", userID, err)
+	}
+	return nil
+}
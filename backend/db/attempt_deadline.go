@@ -0,0 +1,161 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// deadlineGrace is how late a graded submission may still arrive, covering
+// the delay between the browser timer running out and the request landing
+const deadlineGrace = 10 * time.Second
+
+var attemptSweepInterval = 30 * time.Second
+
+// attemptDeadline is when an attempt started at startTime ends: after the
+// question's time limit or at its end time, whichever comes first. It is nil
+// when neither applies.
+func attemptDeadline(startTime time.Time, timeLimit int, endTime *time.Time) *time.Time {
+	var deadline *time.Time
+	if timeLimit > 0 && !startTime.IsZero() {
+		limit := startTime.Add(time.Duration(timeLimit) * time.Minute)
+		deadline = &limit
+	}
+	if endTime != nil && (deadline == nil || endTime.Before(*deadline)) {
+		end := *endTime
+		deadline = &end
+	}
+	return deadline
+}
+
+// checkWindow rejects submissions made outside the question's availability
+// window or after the attempt's deadline
+func (t *evaluationTarget) checkWindow(now time.Time) error {
+	if t.OpensAt != nil && now.Before(*t.OpensAt) {
+		return errors.New("this question is not available yet")
+	}
+	if t.Deadline != nil && now.After(t.Deadline.Add(deadlineGrace)) {
+		return errors.New("the time for this attempt is over")
+	}
+	return nil
+}
+
+// StartAttemptSweeper periodically finalizes attempts whose deadline has
+// passed without a final graded submission
+func StartAttemptSweeper() {
+	go func() {
+		for {
+			sweepExpiredAttempts()
+			time.Sleep(attemptSweepInterval)
+		}
+	}()
+}
+
+// sweepExpiredAttempts finalizes every open attempt past its deadline. Attempts
+// with a graded submission still in the queue are left to that submission.
+func sweepExpiredAttempts() {
+	rows, err := Con.Query(`
+		SELECT a.id, a.student_id, a.question_id, a.start_time, q.time_limit, q.end_time
+		FROM attempt a
+		JOIN question q ON q.id = a.question_id
+		WHERE a.attempted = FALSE AND a.status = 'in_progress'
+			AND (q.time_limit > 0 OR q.end_time IS NOT NULL)
+			AND NOT EXISTS (SELECT 1 FROM submission s
+				WHERE s.attempt_id = a.id AND s.calculate_score = TRUE AND s.status IN (?, ?))`,
+		SubmissionQueued, SubmissionRunning)
+	if err != nil {
+		log.Println("Error sweeping expired attempts:", err)
+		return
+	}
+
+	type expiredAttempt struct {
+		id, studentID, questionID int64
+		deadline                  time.Time
+	}
+	var expired []expiredAttempt
+	now := time.Now()
+	for rows.Next() {
+		var a expiredAttempt
+		var startTime sql.NullTime
+		var endTime *time.Time
+		var timeLimit int
+		if err := rows.Scan(&a.id, &a.studentID, &a.questionID, &startTime, &timeLimit, &endTime); err != nil {
+			log.Println("Error scanning open attempt:", err)
+			rows.Close()
+			return
+		}
+		deadline := attemptDeadline(startTime.Time, timeLimit, endTime)
+		if deadline != nil && now.After(deadline.Add(deadlineGrace)) {
+			a.deadline = *deadline
+			expired = append(expired, a)
+		}
+	}
+	rows.Close()
+
+	for _, a := range expired {
+		if err := finalizeAttempt(a.id, a.studentID, a.questionID, a.deadline); err != nil {
+			log.Printf("Error finalizing attempt %d: %v", a.id, err)
+		}
+	}
+}
+
+// finalizeAttempt closes an attempt whose deadline has passed. The student's
+// latest code, from the saved draft or the last run, is queued as a graded
+// submission, which recordEvaluation recognizes as late and uses to close the
+// attempt. Without such code, or when it was already graded, the attempt is
+// closed as it stands.
+func finalizeAttempt(attemptID, studentID, questionID int64, deadline time.Time) error {
+	var code string
+	var languageID int
+	var graded bool
+	var createdAt time.Time
+	err := Con.QueryRow(`
+		SELECT code, language_id, calculate_score, created_at
+		FROM submission
+		WHERE attempt_id = ?
+		ORDER BY id DESC LIMIT 1`, attemptID).Scan(&code, &languageID, &graded, &createdAt)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error loading last submission: %w", err)
+	}
+	hasSubmission := err == nil
+
+	// A draft saved after the last submission is newer code, unless it is
+	// exactly what was graded
+	draft, err := loadDraft(attemptID)
+	if err != nil {
+		return err
+	}
+	if draft != nil && (!hasSubmission || draft.SavedAt.After(createdAt)) && !(graded && draft.Code == code) {
+		code, languageID = draft.Code, draft.LanguageID
+		hasSubmission, graded = true, false
+	}
+
+	if !hasSubmission || graded {
+		_, err := Con.Exec(`
+			UPDATE attempt SET status = 'timed_out', attempted = TRUE, end_time = ?
+			WHERE id = ? AND attempted = FALSE`, deadline, attemptID)
+		if err != nil {
+			return fmt.Errorf("error closing attempt: %w", err)
+		}
+		return nil
+	}
+
+	result, err := Con.Exec(`
+		INSERT INTO submission (student_id, question_id, attempt_id, code, language_id, calculate_score, status)
+		VALUES (?, ?, ?, ?, ?, TRUE, ?)`,
+		studentID, questionID, attemptID, code, languageID, SubmissionQueued)
+	if err != nil {
+		return fmt.Errorf("error creating final submission: %w", err)
+	}
+
+	submissionID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error getting final submission ID: %w", err)
+	}
+
+	log.Printf("Attempt %d timed out, grading its last code as submission %d", attemptID, submissionID)
+	queueSubmission(submissionID)
+	return nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxDraftBytes caps the size of a saved draft
+const MaxDraftBytes = 256 * 1024
+
+// defaultDraftSaveInterval is the minimum time in seconds between two saves of
+// the same attempt's draft, overridable with DRAFT_SAVE_INTERVAL
+const defaultDraftSaveInterval = 5
+
+// AttemptDraft is the editor contents last saved on an in-progress attempt
+type AttemptDraft struct {
+	Code       string    `json:"code"`
+	LanguageID int       `json:"languageId"`
+	SavedAt    time.Time `json:"savedAt"`
+}
+
+// SaveDraft stores the student's current code on their in-progress attempt.
+// Saves closer together than DRAFT_SAVE_INTERVAL are rejected.
+func SaveDraft(attemptID int64, code string, languageID int) (*AttemptDraft, error) {
+	var attempted bool
+	var status string
+	var startTime sql.NullTime
+	var timeLimit int
+	var endTime *time.Time
+	err := Con.QueryRow(`
+		SELECT a.attempted, a.status, a.start_time, q.time_limit, q.end_time
+		FROM attempt a
+		JOIN question q ON q.id = a.question_id
+		WHERE a.id = ?`, attemptID).Scan(
+		&attempted, &status, &startTime, &timeLimit, &endTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("attempt not found")
+		}
+		return nil, fmt.Errorf("error finding attempt: %w", err)
+	}
+
+	// Drafts of a finished attempt would be graded by nobody, and a draft saved
+	// after the deadline must not reach the sweeper
+	now := time.Now()
+	if attempted || status != "in_progress" {
+		return nil, errors.New("this attempt is already over")
+	}
+	if deadline := attemptDeadline(startTime.Time, timeLimit, endTime); deadline != nil && now.After(deadline.Add(deadlineGrace)) {
+		return nil, errors.New("the time for this attempt is over")
+	}
+
+	// The throttle is part of the update so concurrent saves cannot both pass it
+	interval := time.Duration(envInt("DRAFT_SAVE_INTERVAL", defaultDraftSaveInterval)) * time.Second
+	result, err := Con.Exec(`
+		UPDATE attempt SET draft_code = ?, draft_language_id = ?, draft_saved_at = ?
+		WHERE id = ? AND attempted = FALSE AND (draft_saved_at IS NULL OR draft_saved_at <= ?)`,
+		code, languageID, now, attemptID, now.Add(-interval))
+	if err != nil {
+		return nil, fmt.Errorf("error saving draft: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return nil, errors.New("draft saved too recently, try again later")
+	}
+
+	return &AttemptDraft{Code: code, LanguageID: languageID, SavedAt: now}, nil
+}
+
+// loadDraft returns the draft saved on an attempt, or nil if there is none
+func loadDraft(attemptID int64) (*AttemptDraft, error) {
+	var code sql.NullString
+	var languageID sql.NullInt64
+	var savedAt sql.NullTime
+	err := Con.QueryRow("SELECT draft_code, draft_language_id, draft_saved_at FROM attempt WHERE id = ?", attemptID).Scan(
+		&code, &languageID, &savedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error loading draft: %w", err)
+	}
+	if !code.Valid || !savedAt.Valid {
+		return nil, nil
+	}
+	return &AttemptDraft{Code: code.String, LanguageID: int(languageID.Int64), SavedAt: savedAt.Time}, nil
+}
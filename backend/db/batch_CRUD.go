@@ -214,27 +214,7 @@ func JoinBatch(batchID, userID int64) error {
 	return nil
 }
 
-func GetStudentsInBatch(batchID int64, userID int64) ([]*UserData, error) {
-	// First, verify if the user is a teacher
-	var teacherID int64
-	err := Con.QueryRow("SELECT id FROM teacher WHERE user_id = ?", userID).Scan(&teacherID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("only teachers can view students in a batch")
-		}
-		return nil, fmt.Errorf("error verifying teacher status: %w", err)
-	}
-
-	// Verify if the teacher is associated with the batch
-	var exists bool
-	err = Con.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = ? AND teacher_id = ?)", batchID, teacherID).Scan(&exists)
-	if err != nil {
-		return nil, fmt.Errorf("error checking batch ownership: %w", err)
-	}
-	if !exists {
-		return nil, errors.New("batch not found or you don't have permission to view its students")
-	}
-
+func GetStudentsInBatch(batchID int64) ([]*UserData, error) {
 	query := `
 		SELECT u.id, u.username, u.email, u.role, s.student_id
 		FROM user u
@@ -273,23 +253,12 @@ func GetStudentsInBatch(batchID int64, userID int64) ([]*UserData, error) {
 }
 
 func DeleteBatch(batchID int64, userID int64) error {
-	// Get the teacher ID directly and check if user is a teacher in one query
-	var teacherID int64
-	err := Con.QueryRow("SELECT id FROM teacher WHERE user_id = ?", userID).Scan(&teacherID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return errors.New("only teachers can delete batches")
-		}
-		return fmt.Errorf("error checking teacher status: %w", err)
-	}
-
 	// Check if the batch exists and belongs to this teacher
-	var exists bool
-	err = Con.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = ? AND teacher_id = ?)", batchID, teacherID).Scan(&exists)
+	owned, err := TeacherOwnsBatch(userID, batchID)
 	if err != nil {
-		return fmt.Errorf("error checking batch ownership: %w", err)
+		return err
 	}
-	if !exists {
+	if !owned {
 		return errors.New("batch not found or you don't have permission to delete it")
 	}
 
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Checker is a teacher-supplied program that judges the output of questions
+// with more than one valid answer. It runs on the same executor as the
+// submission and reads three length-prefixed sections from stdin, each a
+// byte count on its own line followed by exactly that many bytes:
+//
+//	<len>\n<test input><len>\n<expected output><len>\n<contestant output>
+//
+// The first line it prints is the verdict: "accept", "reject" or
+// "partial <fraction between 0 and 1>". Anything after it is shown to the
+// student as the checker's message.
+type Checker struct {
+	Code       string `json:"code"`
+	LanguageID int    `json:"language_id"`
+}
+
+// Validate checks that the checker can be run
+func (c *Checker) Validate() error {
+	if strings.TrimSpace(c.Code) == "" {
+		return errors.New("checker code is required")
+	}
+	if c.LanguageID <= 0 {
+		return errors.New("checker language_id is required")
+	}
+	return nil
+}
+
+// request builds the checker run for one test case
+func (c *Checker) request(tc evalTestCase, actualOutput string) ExecutionRequest {
+	var stdin strings.Builder
+	for _, part := range []string{tc.Input, tc.ExpectedOutput, actualOutput} {
+		stdin.WriteString(strconv.Itoa(len(part)))
+		stdin.WriteByte('\n')
+		stdin.WriteString(part)
+	}
+
+	return ExecutionRequest{
+		SourceCode: c.Code,
+		LanguageID: c.LanguageID,
+		Stdin:      stdin.String(),
+	}
+}
+
+// applyChecker replaces the comparator verdict of a test result with the
+// verdict of the checker run
+func applyChecker(testResult TestResult, checkerRun ExecutionResult) TestResult {
+	testResult.Status = "FAIL"
+	testResult.Score = 0
+	testResult.Error = ""
+
+	if checkerRun.StatusID != StatusAccepted {
+		return checkerFailed(testResult, "Checker failed", firstNonEmpty(checkerRun.CompileOutput, checkerRun.Stderr,
+			checkerRun.Message, checkerRun.StatusDescription))
+	}
+
+	credit, message, err := parseCheckerOutput(checkerRun.Stdout)
+	if err != nil {
+		return checkerFailed(testResult, "Checker failed", err.Error())
+	}
+	return applyCredit(testResult, credit, message)
+}
+
+// checkerFailed marks a test result as an internal error of the checker or
+// interactor. The details come from the teacher's program and may give the
+// test case away, so hidden test cases only get the summary.
+func checkerFailed(testResult TestResult, summary, details string) TestResult {
+	testResult.Status = "FAIL"
+	testResult.Score = 0
+	testResult.Verdict = VerdictInternalError
+	testResult.Error = summary
+	if !testResult.IsHidden && details != "" {
+		testResult.Error += ": " + details
+	}
+	return testResult
+}
+
+// applyCredit sets the verdict of a test result from the credit a checker or
+// interactor gave it. The message is dropped for hidden tests, since checkers
+// often quote the expected answer.
+func applyCredit(testResult TestResult, credit float64, message string) TestResult {
+	testResult.Score = credit
+	testResult.CheckerMessage = ""
+	if !testResult.IsHidden {
+		testResult.CheckerMessage = message
+	}
+	switch {
+	case credit >= 1:
+		testResult.Status = "PASS"
+		testResult.Verdict = VerdictAccepted
+	case credit > 0:
+		testResult.Status = "FAIL"
+		testResult.Verdict = VerdictPartial
+	default:
+		testResult.Status = "FAIL"
+		testResult.Verdict = VerdictWrongAnswer
+	}
+	return testResult
+}
+
+// parseCheckerOutput reads the verdict line and message printed by a checker
+func parseCheckerOutput(stdout string) (float64, string, error) {
+	verdictLine, message, _ := strings.Cut(strings.TrimLeft(stdout, " \t\r\n"), "\n")
+	message = strings.TrimSpace(message)
+	fields := strings.Fields(strings.ToLower(verdictLine))
+	if len(fields) == 0 {
+		return 0, "", errors.New("checker printed no verdict")
+	}
+
+	switch fields[0] {
+	case "accept":
+		return 1, message, nil
+	case "reject":
+		return 0, message, nil
+	case "partial":
+		if len(fields) < 2 {
+			return 0, "", errors.New("partial verdict needs a fraction")
+		}
+		credit, err := strconv.ParseFloat(fields[1], 64)
+		// Written so that NaN fails too
+		if err != nil || !(credit >= 0 && credit <= 1) {
+			return 0, "", fmt.Errorf("invalid partial credit %q", fields[1])
+		}
+		return credit, message, nil
+	}
+	return 0, "", fmt.Errorf("unknown checker verdict %q", fields[0])
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCheckerOutput(t *testing.T) {
+	tests := []struct {
+		name        string
+		stdout      string
+		wantCredit  float64
+		wantMessage string
+		wantErr     bool
+	}{
+		{"accept", "accept\n", 1, "", false},
+		{"accept with message", "ACCEPT\n  shortest path found \n", 1, "shortest path found", false},
+		{"leading blank lines", "\n\n  reject\nwrong length", 0, "wrong length", false},
+		{"partial", "partial 0.25\nthree of four", 0.25, "three of four", false},
+		{"partial bounds", "partial 1", 1, "", false},
+		{"partial without fraction", "partial\n", 0, "", true},
+		{"partial above one", "partial 1.5", 0, "", true},
+		{"partial negative", "partial -0.1", 0, "", true},
+		{"partial NaN", "partial NaN", 0, "", true},
+		{"partial not a number", "partial half", 0, "", true},
+		{"unknown verdict", "ok\n", 0, "", true},
+		{"no output", "  \n", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credit, message, err := parseCheckerOutput(tt.stdout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCheckerOutput(%q) error = %v, want error %v", tt.stdout, err, tt.wantErr)
+			}
+			if credit != tt.wantCredit || message != tt.wantMessage {
+				t.Errorf("parseCheckerOutput(%q) = %v, %q, want %v, %q", tt.stdout, credit, message, tt.wantCredit, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestApplyChecker(t *testing.T) {
+	tests := []struct {
+		name        string
+		hidden      bool
+		checkerRun  ExecutionResult
+		wantStatus  string
+		wantVerdict string
+		wantScore   float64
+		wantError   string
+		wantMessage string
+	}{
+		{
+			name:        "accept",
+			checkerRun:  ExecutionResult{StatusID: StatusAccepted, Stdout: "accept\nvalid tour"},
+			wantStatus:  "PASS",
+			wantVerdict: VerdictAccepted,
+			wantScore:   1,
+			wantMessage: "valid tour",
+		},
+		{
+			name:        "reject",
+			checkerRun:  ExecutionResult{StatusID: StatusAccepted, Stdout: "reject\nedge 3-4 missing"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictWrongAnswer,
+			wantMessage: "edge 3-4 missing",
+		},
+		{
+			name:        "reject on hidden test",
+			hidden:      true,
+			checkerRun:  ExecutionResult{StatusID: StatusAccepted, Stdout: "reject\nexpected 7, read 8"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictWrongAnswer,
+		},
+		{
+			name:        "partial",
+			checkerRun:  ExecutionResult{StatusID: StatusAccepted, Stdout: "partial 0.5"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictPartial,
+			wantScore:   0.5,
+		},
+		{
+			name:        "checker crashed",
+			checkerRun:  ExecutionResult{StatusID: StatusRuntimeNZEC, Stderr: "expected 7, read 8"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictInternalError,
+			wantError:   "Checker failed: expected 7, read 8",
+		},
+		{
+			name:        "checker crashed on hidden test",
+			hidden:      true,
+			checkerRun:  ExecutionResult{StatusID: StatusRuntimeNZEC, Stderr: "expected 7, read 8"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictInternalError,
+			wantError:   "Checker failed",
+		},
+		{
+			name:        "unparsable verdict",
+			checkerRun:  ExecutionResult{StatusID: StatusAccepted, Stdout: "maybe"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictInternalError,
+			wantError:   `Checker failed: unknown checker verdict "maybe"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The comparator result the checker overrides
+			before := TestResult{Status: "PASS", Verdict: VerdictAccepted, Score: 1, IsHidden: tt.hidden, ActualOutput: "1 2 3"}
+			got := applyChecker(before, tt.checkerRun)
+
+			if got.Status != tt.wantStatus || got.Verdict != tt.wantVerdict || got.Score != tt.wantScore {
+				t.Errorf("got %s %s %v, want %s %s %v", got.Status, got.Verdict, got.Score, tt.wantStatus, tt.wantVerdict, tt.wantScore)
+			}
+			if got.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", got.Error, tt.wantError)
+			}
+			if got.CheckerMessage != tt.wantMessage {
+				t.Errorf("checker message = %q, want %q", got.CheckerMessage, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestCheckerRequest(t *testing.T) {
+	checker := &Checker{Code: "checker", LanguageID: 71}
+	tc := evalTestCase{Input: "3\n", ExpectedOutput: "1 2 3"}
+
+	req := checker.request(tc, "3 2 1\n")
+	want := "2\n3\n5\n1 2 36\n3 2 1\n"
+	if req.Stdin != want {
+		t.Errorf("stdin = %q, want %q", req.Stdin, want)
+	}
+	if req.SourceCode != "checker" || req.LanguageID != 71 {
+		t.Errorf("request runs %q in language %d, want the checker", req.SourceCode, req.LanguageID)
+	}
+}
+
+func TestGradeInteractive(t *testing.T) {
+	accepted := ExecutionResult{StatusID: StatusAccepted}
+
+	tests := []struct {
+		name        string
+		run         InteractiveResult
+		hidden      bool
+		wantVerdict string
+		wantError   string
+		wantMessage string
+	}{
+		{
+			name:        "interactor accepts",
+			run:         InteractiveResult{Solution: accepted, Interactor: ExecutionResult{StatusID: StatusAccepted, Stderr: "accept\n"}},
+			wantVerdict: VerdictAccepted,
+		},
+		{
+			name:        "interactor rejects",
+			run:         InteractiveResult{Solution: accepted, Interactor: ExecutionResult{StatusID: StatusAccepted, Stderr: "reject\ntoo many queries"}},
+			wantVerdict: VerdictWrongAnswer,
+			wantMessage: "too many queries",
+		},
+		{
+			name:        "interactor rejects hidden test",
+			run:         InteractiveResult{Solution: accepted, Interactor: ExecutionResult{StatusID: StatusAccepted, Stderr: "reject\nsecret was 42"}},
+			hidden:      true,
+			wantVerdict: VerdictWrongAnswer,
+		},
+		{
+			name:        "solution timed out",
+			run:         InteractiveResult{Solution: ExecutionResult{StatusID: StatusTimeLimitExceeded}, Interactor: ExecutionResult{StatusID: StatusAccepted, Stderr: "reject"}},
+			wantVerdict: VerdictTimeLimitExceeded,
+			wantError:   "Execution error: ",
+		},
+		{
+			name:        "interactor crashed",
+			run:         InteractiveResult{Solution: accepted, Interactor: ExecutionResult{StatusID: StatusRuntimeNZEC, Stderr: "secret was 42"}},
+			wantVerdict: VerdictInternalError,
+			wantError:   "Interactor failed: secret was 42",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := gradeInteractive(tt.run, evalTestCase{Input: "10", IsHidden: tt.hidden})
+			if got.Verdict != tt.wantVerdict {
+				t.Errorf("verdict = %s, want %s", got.Verdict, tt.wantVerdict)
+			}
+			if !strings.HasPrefix(got.Error, tt.wantError) || (tt.wantError == "" && got.Error != "") {
+				t.Errorf("error = %q, want %q", got.Error, tt.wantError)
+			}
+			if got.CheckerMessage != tt.wantMessage {
+				t.Errorf("checker message = %q, want %q", got.CheckerMessage, tt.wantMessage)
+			}
+		})
+	}
+}
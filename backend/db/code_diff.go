@@ -0,0 +1,170 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is how many unchanged lines surround each hunk
+const diffContextLines = 3
+
+// diffOp is one line of a line diff: ' ' kept, '-' removed or '+' added
+type diffOp struct {
+	Kind byte
+	Line string
+}
+
+// diffLines computes a shortest line diff from a to b with Myers' algorithm
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk the trace back from the end, collecting operations in reverse
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x--
+		y--
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// splitLines splits code into lines, ignoring a trailing newline and CRs
+func splitLines(code string) []string {
+	code = strings.ReplaceAll(code, "\r\n", "\n")
+	code = strings.TrimSuffix(code, "\n")
+	if code == "" {
+		return nil
+	}
+	return strings.Split(code, "\n")
+}
+
+// unifiedDiff renders the changes from oldCode to newCode as a unified diff
+// and counts the added and removed lines
+func unifiedDiff(oldName, newName, oldCode, newCode string) (diff string, added, removed int) {
+	ops := diffLines(splitLines(oldCode), splitLines(newCode))
+
+	// Mark which operations fall within the context of a change
+	show := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.Kind == ' ' {
+			continue
+		}
+		if op.Kind == '+' {
+			added++
+		} else {
+			removed++
+		}
+		for j := max(0, i-diffContextLines); j <= min(len(ops)-1, i+diffContextLines); j++ {
+			show[j] = true
+		}
+	}
+	if added == 0 && removed == 0 {
+		return "", 0, 0
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(ops); {
+		if !show[i] {
+			if ops[i].Kind != '+' {
+				oldLine++
+			}
+			if ops[i].Kind != '-' {
+				newLine++
+			}
+			i++
+			continue
+		}
+
+		// Collect one hunk of consecutive shown operations
+		end := i
+		oldCount, newCount := 0, 0
+		for end < len(ops) && show[end] {
+			if ops[end].Kind != '+' {
+				oldCount++
+			}
+			if ops[end].Kind != '-' {
+				newCount++
+			}
+			end++
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+		for _, op := range ops[i:end] {
+			sb.WriteByte(op.Kind)
+			sb.WriteString(op.Line)
+			sb.WriteByte('\n')
+		}
+
+		oldLine += oldCount
+		newLine += newCount
+		i = end
+	}
+
+	return sb.String(), added, removed
+}
+
+// hunkRange formats a hunk's start line and length the way diff -u does
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
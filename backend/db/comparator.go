@@ -0,0 +1,128 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Output comparators that can be set on a question or a test case
+const (
+	ComparatorExact           = "exact"            // equal after trimming surrounding whitespace
+	ComparatorTokens          = "tokens"           // same whitespace-separated tokens
+	ComparatorCaseInsensitive = "case_insensitive" // equal ignoring case
+	ComparatorFloatAbs        = "float_abs"        // numbers within an absolute tolerance
+	ComparatorFloatRel        = "float_rel"        // numbers within a relative tolerance
+	ComparatorUnorderedLines  = "unordered_lines"  // same lines in any order
+	ComparatorRegex           = "regex"            // expected output is a regular expression
+)
+
+// defaultFloatTolerance is used by the float comparators when none is set
+const defaultFloatTolerance = 1e-6
+
+// Comparator decides whether a program's output matches the expected output.
+// An empty Type inherits the question's comparator, then falls back to exact.
+type Comparator struct {
+	Type      string   `json:"comparator"`
+	Tolerance *float64 `json:"comparator_tolerance"`
+}
+
+// Or returns c with unset fields taken from fallback
+func (c Comparator) Or(fallback Comparator) Comparator {
+	if c.Type == "" {
+		c.Type = fallback.Type
+		if c.Tolerance == nil {
+			c.Tolerance = fallback.Tolerance
+		}
+	}
+	return c
+}
+
+// Validate checks the comparator settings against a test case's expected output
+func (c Comparator) Validate(expectedOutput string) error {
+	switch c.Type {
+	case "", ComparatorExact, ComparatorTokens, ComparatorCaseInsensitive, ComparatorUnorderedLines:
+	case ComparatorFloatAbs, ComparatorFloatRel:
+		if c.Tolerance != nil && *c.Tolerance < 0 {
+			return fmt.Errorf("comparator_tolerance must not be negative")
+		}
+	case ComparatorRegex:
+		if _, err := regexp.Compile(strings.TrimSpace(expectedOutput)); err != nil {
+			return fmt.Errorf("expected output is not a valid regular expression: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown comparator %q", c.Type)
+	}
+	return nil
+}
+
+// Match reports whether actual matches expected
+func (c Comparator) Match(actual, expected string) bool {
+	actual = strings.TrimSpace(actual)
+	expected = strings.TrimSpace(expected)
+
+	switch c.Type {
+	case ComparatorTokens:
+		return slices.Equal(strings.Fields(actual), strings.Fields(expected))
+	case ComparatorCaseInsensitive:
+		return strings.EqualFold(actual, expected)
+	case ComparatorFloatAbs, ComparatorFloatRel:
+		return c.matchFloats(strings.Fields(actual), strings.Fields(expected))
+	case ComparatorUnorderedLines:
+		return slices.Equal(sortedLines(actual), sortedLines(expected))
+	case ComparatorRegex:
+		re, err := regexp.Compile(`^(?:` + expected + `)$`)
+		return err == nil && re.MatchString(actual)
+	}
+	return actual == expected
+}
+
+// matchFloats compares tokens pairwise, numerically where both sides are numbers
+func (c Comparator) matchFloats(actual, expected []string) bool {
+	if len(actual) != len(expected) {
+		return false
+	}
+
+	for i := range expected {
+		want, errWant := strconv.ParseFloat(expected[i], 64)
+		got, errGot := strconv.ParseFloat(actual[i], 64)
+		if errWant != nil || errGot != nil {
+			if actual[i] != expected[i] {
+				return false
+			}
+			continue
+		}
+		if !c.floatsMatch(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// floatsMatch reports whether got is within the comparator's tolerance of want
+func (c Comparator) floatsMatch(got, want float64) bool {
+	tolerance := defaultFloatTolerance
+	if c.Tolerance != nil {
+		tolerance = *c.Tolerance
+	}
+
+	diff := math.Abs(got - want)
+	if c.Type == ComparatorFloatRel {
+		// Fall back to an absolute check near zero, where relative error is meaningless
+		return diff <= tolerance*math.Max(math.Abs(want), 1)
+	}
+	return diff <= tolerance
+}
+
+// sortedLines splits text into lines without trailing whitespace, sorted
+func sortedLines(text string) []string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	slices.Sort(lines)
+	return lines
+}
@@ -0,0 +1,90 @@
+package db
+
+import "testing"
+
+func tolerance(v float64) *float64 { return &v }
+
+func TestComparatorMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		comparator Comparator
+		actual     string
+		expected   string
+		want       bool
+	}{
+		{"exact trims surrounding whitespace", Comparator{}, "  42\n", "42", true},
+		{"exact keeps inner whitespace", Comparator{Type: ComparatorExact}, "1  2", "1 2", false},
+		{"tokens ignore spacing", Comparator{Type: ComparatorTokens}, "1  2\n3", "1 2 3", true},
+		{"tokens compare values", Comparator{Type: ComparatorTokens}, "1 2", "1 3", false},
+		{"case insensitive", Comparator{Type: ComparatorCaseInsensitive}, "YES", "yes", true},
+		{"case insensitive compares letters", Comparator{Type: ComparatorCaseInsensitive}, "yes", "no", false},
+		{"float abs default tolerance", Comparator{Type: ComparatorFloatAbs}, "0.3333333", "0.33333333", true},
+		{"float abs outside tolerance", Comparator{Type: ComparatorFloatAbs, Tolerance: tolerance(0.01)}, "1.02", "1", false},
+		{"float abs inside tolerance", Comparator{Type: ComparatorFloatAbs, Tolerance: tolerance(0.01)}, "1.005", "1", true},
+		{"float abs non-numeric tokens exact", Comparator{Type: ComparatorFloatAbs}, "x 1.0", "x 1", true},
+		{"float abs non-numeric mismatch", Comparator{Type: ComparatorFloatAbs}, "y 1", "x 1", false},
+		{"float abs token count", Comparator{Type: ComparatorFloatAbs}, "1 2", "1", false},
+		{"float rel scales with value", Comparator{Type: ComparatorFloatRel, Tolerance: tolerance(1e-3)}, "1000.5", "1000", true},
+		{"float rel outside tolerance", Comparator{Type: ComparatorFloatRel, Tolerance: tolerance(1e-3)}, "1002", "1000", false},
+		{"float rel absolute near zero", Comparator{Type: ComparatorFloatRel, Tolerance: tolerance(1e-3)}, "0.0005", "0", true},
+		{"unordered lines", Comparator{Type: ComparatorUnorderedLines}, "b\na  \nc", "a\nb\nc", true},
+		{"unordered lines counts duplicates", Comparator{Type: ComparatorUnorderedLines}, "a\na\nb", "a\nb\nb", false},
+		{"regex anchored", Comparator{Type: ComparatorRegex}, "answer: 42", `answer: \d+`, true},
+		{"regex must match whole output", Comparator{Type: ComparatorRegex}, "answer: 42!", `answer: \d+`, false},
+		{"invalid regex never matches", Comparator{Type: ComparatorRegex}, "(", "(", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.comparator.Match(tt.actual, tt.expected); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.actual, tt.expected, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComparatorValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		comparator Comparator
+		expected   string
+		wantErr    bool
+	}{
+		{"empty inherits", Comparator{}, "x", false},
+		{"tokens", Comparator{Type: ComparatorTokens}, "x", false},
+		{"float without tolerance", Comparator{Type: ComparatorFloatAbs}, "1", false},
+		{"negative tolerance", Comparator{Type: ComparatorFloatRel, Tolerance: tolerance(-1)}, "1", true},
+		{"valid regex", Comparator{Type: ComparatorRegex}, `\d+`, false},
+		{"invalid regex", Comparator{Type: ComparatorRegex}, "(", true},
+		{"unknown type", Comparator{Type: "fuzzy"}, "x", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.comparator.Validate(tt.expected)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%q) error = %v, want error %v", tt.expected, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestComparatorOr(t *testing.T) {
+	question := Comparator{Type: ComparatorFloatAbs, Tolerance: tolerance(0.5)}
+
+	if got := (Comparator{}).Or(question); got.Type != ComparatorFloatAbs || got.Tolerance == nil || *got.Tolerance != 0.5 {
+		t.Errorf("unset comparator should inherit the question's, got %+v", got)
+	}
+
+	// A tolerance on its own tightens the question's comparator
+	got := Comparator{Tolerance: tolerance(0.1)}.Or(question)
+	if got.Type != ComparatorFloatAbs || *got.Tolerance != 0.1 {
+		t.Errorf("test case tolerance should be kept, got %+v", got)
+	}
+
+	// A type of its own doesn't pick up the question's tolerance
+	got = Comparator{Type: ComparatorFloatRel}.Or(question)
+	if got.Type != ComparatorFloatRel || got.Tolerance != nil {
+		t.Errorf("test case comparator should be kept as is, got %+v", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
@@ -54,6 +55,8 @@ func createTablesIfNotExist() error {
 		email VARCHAR(100),
 		userpassword VARCHAR(100),
 		role ENUM('student', 'teacher', 'admin'),
+		must_change_password BOOLEAN NOT NULL DEFAULT FALSE,
+		email_verified BOOLEAN NOT NULL DEFAULT FALSE,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);`
 
@@ -117,20 +120,64 @@ func createTablesIfNotExist() error {
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		start_time DATETIME,
 		end_time DATETIME,
+		cpu_time_limit DECIMAL(6,3),
+		memory_limit INT,
+		stack_limit INT,
+		comparator VARCHAR(32),
+		comparator_tolerance DOUBLE,
+		checker_code MEDIUMTEXT,
+		checker_language_id INT,
+		question_type VARCHAR(20) NOT NULL DEFAULT 'standard',
+		interactor_code MEDIUMTEXT,
+		interactor_language_id INT,
+		function_signature TEXT,
+		scoring_policy VARCHAR(20),
+		max_submissions INT NOT NULL DEFAULT 1,
+		submission_penalty INT NOT NULL DEFAULT 0,
+		reference_code MEDIUMTEXT,
+		reference_language_id INT,
 		FOREIGN KEY (teacher_id) REFERENCES teacher(id) ON DELETE CASCADE,
 		FOREIGN KEY (batch_id) REFERENCES batch(id) ON DELETE CASCADE
 	);`
 
+	testGroupTable := `
+	CREATE TABLE IF NOT EXISTS test_group (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		question_id INT NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		points INT NOT NULL DEFAULT 0,
+		scoring ENUM('all_or_nothing', 'proportional') DEFAULT 'all_or_nothing',
+		position INT NOT NULL DEFAULT 0,
+		FOREIGN KEY (question_id) REFERENCES question(id) ON DELETE CASCADE,
+		UNIQUE KEY (question_id, name)
+	);`
+
+	testGroupDependencyTable := `
+	CREATE TABLE IF NOT EXISTS test_group_dependency (
+		group_id INT NOT NULL,
+		depends_on_group_id INT NOT NULL,
+		PRIMARY KEY (group_id, depends_on_group_id),
+		FOREIGN KEY (group_id) REFERENCES test_group(id) ON DELETE CASCADE,
+		FOREIGN KEY (depends_on_group_id) REFERENCES test_group(id) ON DELETE CASCADE
+	);`
+
 	testCaseTable := `
 	CREATE TABLE IF NOT EXISTS test_case (
 		id INT AUTO_INCREMENT PRIMARY KEY,
 		question_id INT NOT NULL,
-		input_text TEXT NOT NULL,
-		expected_output TEXT NOT NULL,
+		input_text MEDIUMTEXT NOT NULL,
+		expected_output MEDIUMTEXT NOT NULL,
 		is_hidden BOOLEAN DEFAULT FALSE,
+		cpu_time_limit DECIMAL(6,3),
+		memory_limit INT,
+		stack_limit INT,
+		comparator VARCHAR(32),
+		comparator_tolerance DOUBLE,
+		group_id INT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-		FOREIGN KEY (question_id) REFERENCES question(id) ON DELETE CASCADE
+		FOREIGN KEY (question_id) REFERENCES question(id) ON DELETE CASCADE,
+		FOREIGN KEY (group_id) REFERENCES test_group(id) ON DELETE SET NULL
 	);`
 
 	attemptTable := `
@@ -145,11 +192,85 @@ func createTablesIfNotExist() error {
 		end_time TIMESTAMP,
 		time_taken_seconds INT,
 		attempted BOOLEAN DEFAULT FALSE,
+		group_scores TEXT,
+		graded_submissions INT NOT NULL DEFAULT 0,
+		wrong_submissions INT NOT NULL DEFAULT 0,
+		draft_code MEDIUMTEXT,
+		draft_language_id INT,
+		draft_saved_at TIMESTAMP NULL,
 		submission_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (student_id) REFERENCES student(id) ON DELETE CASCADE,
 		FOREIGN KEY (question_id) REFERENCES question(id) ON DELETE CASCADE
 	);`
 
+	submissionTable := `
+	CREATE TABLE IF NOT EXISTS submission (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		student_id INT NOT NULL,
+		question_id INT NOT NULL,
+		attempt_id INT,
+		code MEDIUMTEXT NOT NULL,
+		language_id INT NOT NULL,
+		calculate_score BOOLEAN DEFAULT FALSE,
+		status ENUM('queued', 'running', 'done', 'failed') NOT NULL DEFAULT 'queued',
+		result MEDIUMTEXT,
+		score INT,
+		error TEXT,
+		retries INT DEFAULT 0,
+		run_after DATETIME,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		started_at TIMESTAMP NULL,
+		finished_at TIMESTAMP NULL,
+		INDEX (status),
+		INDEX (question_id, student_id),
+		FOREIGN KEY (student_id) REFERENCES student(id) ON DELETE CASCADE,
+		FOREIGN KEY (question_id) REFERENCES question(id) ON DELETE CASCADE,
+		FOREIGN KEY (attempt_id) REFERENCES attempt(id) ON DELETE SET NULL
+	);`
+
+	rejudgeJobTable := `
+	CREATE TABLE IF NOT EXISTS rejudge_job (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		batch_id INT NOT NULL,
+		question_id INT,
+		student_id INT,
+		requested_by INT NOT NULL,
+		status ENUM('queued', 'running', 'done', 'failed') NOT NULL DEFAULT 'queued',
+		total_attempts INT NOT NULL DEFAULT 0,
+		processed_attempts INT NOT NULL DEFAULT 0,
+		changed_attempts INT NOT NULL DEFAULT 0,
+		failed_attempts INT NOT NULL DEFAULT 0,
+		error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		started_at TIMESTAMP NULL,
+		finished_at TIMESTAMP NULL,
+		INDEX (status),
+		FOREIGN KEY (batch_id) REFERENCES batch(id) ON DELETE CASCADE,
+		FOREIGN KEY (question_id) REFERENCES question(id) ON DELETE CASCADE,
+		FOREIGN KEY (student_id) REFERENCES student(id) ON DELETE CASCADE,
+		FOREIGN KEY (requested_by) REFERENCES user(id) ON DELETE CASCADE
+	);`
+
+	rejudgeResultTable := `
+	CREATE TABLE IF NOT EXISTS rejudge_result (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		job_id INT NOT NULL,
+		attempt_id INT NOT NULL,
+		student_id INT NOT NULL,
+		question_id INT NOT NULL,
+		old_score INT NOT NULL,
+		new_score INT,
+		old_status VARCHAR(20) NOT NULL,
+		new_status VARCHAR(20),
+		error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE KEY (job_id, attempt_id),
+		FOREIGN KEY (job_id) REFERENCES rejudge_job(id) ON DELETE CASCADE,
+		FOREIGN KEY (attempt_id) REFERENCES attempt(id) ON DELETE CASCADE,
+		FOREIGN KEY (student_id) REFERENCES student(id) ON DELETE CASCADE,
+		FOREIGN KEY (question_id) REFERENCES question(id) ON DELETE CASCADE
+	);`
+
 	blogTable := `
 	CREATE TABLE IF NOT EXISTS blog (
 		id INT AUTO_INCREMENT PRIMARY KEY,
@@ -178,10 +299,57 @@ func createTablesIfNotExist() error {
 		UNIQUE KEY (blog_id, tag_name)
 	);`
 
+	// One row per login; the refresh tokens of a session form a family and
+	// only the one with the current generation may be used
+	sessionTable := `
+	CREATE TABLE IF NOT EXISTS session (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		generation INT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		rotated_at DATETIME NULL,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME NULL,
+		revoked_reason VARCHAR(50),
+		user_agent VARCHAR(255),
+		ip_address VARCHAR(45),
+		INDEX (user_id, revoked_at),
+		FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE
+	);`
+
+	// One-time tokens mailed to users, stored as SHA-256 hashes
+	userTokenTable := `
+	CREATE TABLE IF NOT EXISTS user_token (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		purpose ENUM('verify_email', 'reset_password') NOT NULL,
+		token_hash CHAR(64) NOT NULL UNIQUE,
+		expires_at DATETIME NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX (user_id, purpose),
+		FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE
+	);`
+
+	// Accounts of external identity providers linked to users, for SSO
+	userIdentityTable := `
+	CREATE TABLE IF NOT EXISTS user_identity (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		provider VARCHAR(50) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		email VARCHAR(100),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_login_at TIMESTAMP NULL,
+		UNIQUE KEY (provider, subject),
+		FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE
+	);`
+
 	tables := []string{
 		userTable, studentTable, teacherTable, batchTable,
-		batchStudentTable, noteTable, questionTable, testCaseTable, attemptTable,
-		blogTable, blogTagTable,
+		batchStudentTable, noteTable, questionTable, testGroupTable, testGroupDependencyTable,
+		testCaseTable, attemptTable,
+		submissionTable, rejudgeJobTable, rejudgeResultTable, blogTable, blogTagTable,
+		sessionTable, userTokenTable, userIdentityTable,
 	}
 
 	for _, table := range tables {
@@ -192,6 +360,13 @@ func createTablesIfNotExist() error {
 	}
 	fmt.Println("Tables verified/created.")
 
+	if err := addMissingColumns(); err != nil {
+		return fmt.Errorf("error migrating tables: %v", err)
+	}
+	if err := widenColumns(); err != nil {
+		return fmt.Errorf("error migrating tables: %v", err)
+	}
+
 	// After tables are created, create admin user if not exists
 	if err := createAdminIfNotExists(); err != nil {
 		return fmt.Errorf("error creating admin user: %v", err)
@@ -200,6 +375,101 @@ func createTablesIfNotExist() error {
 	return nil
 }
 
+// columnMigrations lists columns added after a table was first released.
+// CREATE TABLE IF NOT EXISTS leaves existing tables alone, so databases
+// created by an older version get these columns through addMissingColumns.
+var columnMigrations = []struct {
+	table, column, definition string
+}{
+	{"question", "cpu_time_limit", "DECIMAL(6,3)"},
+	{"question", "memory_limit", "INT"},
+	{"question", "stack_limit", "INT"},
+	{"test_case", "cpu_time_limit", "DECIMAL(6,3)"},
+	{"test_case", "memory_limit", "INT"},
+	{"test_case", "stack_limit", "INT"},
+	{"question", "comparator", "VARCHAR(32)"},
+	{"question", "comparator_tolerance", "DOUBLE"},
+	{"test_case", "comparator", "VARCHAR(32)"},
+	{"test_case", "comparator_tolerance", "DOUBLE"},
+	{"question", "checker_code", "MEDIUMTEXT"},
+	{"question", "checker_language_id", "INT"},
+	{"test_case", "group_id", "INT, ADD FOREIGN KEY (group_id) REFERENCES test_group(id) ON DELETE SET NULL"},
+	{"attempt", "group_scores", "TEXT"},
+	{"question", "question_type", "VARCHAR(20) NOT NULL DEFAULT 'standard'"},
+	{"question", "interactor_code", "MEDIUMTEXT"},
+	{"question", "interactor_language_id", "INT"},
+	{"question", "function_signature", "TEXT"},
+	{"submission", "score", "INT"},
+	{"question", "scoring_policy", "VARCHAR(20)"},
+	{"question", "max_submissions", "INT NOT NULL DEFAULT 1"},
+	{"question", "submission_penalty", "INT NOT NULL DEFAULT 0"},
+	{"attempt", "graded_submissions", "INT NOT NULL DEFAULT 0"},
+	{"attempt", "wrong_submissions", "INT NOT NULL DEFAULT 0"},
+	{"attempt", "draft_code", "MEDIUMTEXT"},
+	{"attempt", "draft_language_id", "INT"},
+	{"attempt", "draft_saved_at", "TIMESTAMP NULL"},
+	{"question", "reference_code", "MEDIUMTEXT"},
+	{"question", "reference_language_id", "INT"},
+	{"user", "must_change_password", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	// Accounts from before email verification count as verified. New users
+	// are inserted with an explicit value, so the default doesn't matter.
+	{"user", "email_verified", "BOOLEAN NOT NULL DEFAULT TRUE"},
+}
+
+func addMissingColumns() error {
+	for _, m := range columnMigrations {
+		var exists bool
+		err := Con.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?)`,
+			m.table, m.column).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		if _, err := Con.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)); err != nil {
+			return err
+		}
+		fmt.Printf("Added column %s.%s\n", m.table, m.column)
+	}
+	return nil
+}
+
+// columnTypeMigrations lists columns whose type was widened after a table was
+// first released, with the type information_schema reports once widened
+var columnTypeMigrations = []struct {
+	table, column, dataType, definition string
+}{
+	// Test cases imported from archives don't fit in TEXT's 64 KB
+	{"test_case", "input_text", "mediumtext", "MEDIUMTEXT NOT NULL"},
+	{"test_case", "expected_output", "mediumtext", "MEDIUMTEXT NOT NULL"},
+}
+
+func widenColumns() error {
+	for _, m := range columnTypeMigrations {
+		var dataType string
+		err := Con.QueryRow(`
+			SELECT DATA_TYPE FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`,
+			m.table, m.column).Scan(&dataType)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(dataType, m.dataType) {
+			continue
+		}
+
+		if _, err := Con.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", m.table, m.column, m.definition)); err != nil {
+			return err
+		}
+		fmt.Printf("Changed column %s.%s to %s\n", m.table, m.column, m.definition)
+	}
+	return nil
+}
+
 func createAdminIfNotExists() error {
 	var count int
 	if err := Con.QueryRow("SELECT COUNT(*) FROM user WHERE role = 'admin'").Scan(&count); err != nil {
@@ -207,10 +477,13 @@ func createAdminIfNotExists() error {
 	}
 
 	if count == 0 {
-		// Create admin user
-		hashedPassword := generateSHA256Hash("admin123")
-		_, err := Con.Exec(
-			"INSERT INTO user (username, email, userpassword, role) VALUES (?, ?, ?, ?)",
+		// Create admin user with the default password, which has to be changed on first login
+		hashedPassword, err := HashPassword(defaultAdminPassword)
+		if err != nil {
+			return err
+		}
+		_, err = Con.Exec(
+			"INSERT INTO user (username, email, userpassword, role, must_change_password, email_verified) VALUES (?, ?, ?, ?, TRUE, TRUE)",
 			"admin", "admin@procode.in", hashedPassword, "admin",
 		)
 		if err != nil {
@@ -219,5 +492,8 @@ func createAdminIfNotExists() error {
 		fmt.Println("Admin user created successfully")
 	}
 
-	return nil
+	// Admins created by older versions may still have the default password
+	_, err := Con.Exec("UPDATE user SET must_change_password = TRUE WHERE role = 'admin' AND userpassword = ?",
+		generateSHA256Hash(defaultAdminPassword))
+	return err
 }
@@ -2,6 +2,7 @@ package db
 
 import (
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -13,6 +14,10 @@ type UserData struct {
 	Email    string
 	Role     string
 	RoleID   string
+	// Set on accounts that must pick a new password before they can log in
+	MustChangePassword bool
+	// Unverified accounts can't log in until they confirm their email address
+	EmailVerified bool
 }
 
 // UsernameExists checks if a username already exists in the database
@@ -37,24 +42,12 @@ func EmailExists(email string) (bool, error) {
 	return count > 0, nil
 }
 
-// Generate SHA-256 hash
+// Generate SHA-256 hash, the format passwords were stored in before bcrypt
 func generateSHA256Hash(data string) string {
 	hash := sha256.Sum256([]byte(data))
 	return hex.EncodeToString(hash[:])
 }
 
-// Verify the password with nonce against stored hash
-func verifyPasswordWithNonce(storedHash, providedHash, nonce string) bool {
-	// Combine the stored hash with nonce
-	combinedHash := storedHash + nonce
-
-	// Hash again
-	finalHash := generateSHA256Hash(combinedHash)
-
-	// Compare with the hash provided by client
-	return finalHash == providedHash
-}
-
 func CreateUserWithRole(username, email, password, role, userRoleId string) (userID int64, err error) {
 	if role != "student" && role != "teacher" {
 		return 0, errors.New("invalid role: must be 'student' or 'teacher'")
@@ -78,16 +71,42 @@ func CreateUserWithRole(username, email, password, role, userRoleId string) (use
 		return 0, errors.New("email already exists")
 	}
 
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := Con.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID, err = insertUser(tx, username, email, hashedPassword, role, userRoleId, false)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	fmt.Printf("Created user with ID %d and role %s\n", userID, role)
+	return userID, nil
+}
+
+// insertUser adds a user with their student or teacher row. Users without a
+// password, such as those signing in through SSO, get an empty passwordHash.
+func insertUser(tx *sql.Tx, username, email, passwordHash, role, userRoleId string, emailVerified bool) (int64, error) {
 	insertUserQuery := `
-		INSERT INTO user(username, email, userpassword, role)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO user(username, email, userpassword, role, email_verified)
+		VALUES (?, ?, NULLIF(?, ''), ?, ?)
 	`
-	result, err := Con.Exec(insertUserQuery, username, email, password, role)
+	result, err := tx.Exec(insertUserQuery, username, email, passwordHash, role, emailVerified)
 	if err != nil {
 		return 0, fmt.Errorf("error inserting user: %w", err)
 	}
 
-	userID, err = result.LastInsertId()
+	userID, err := result.LastInsertId()
 	if err != nil {
 		return 0, fmt.Errorf("error getting inserted user ID: %w", err)
 	}
@@ -105,40 +124,38 @@ func CreateUserWithRole(username, email, password, role, userRoleId string) (use
 		`
 	}
 
-	_, err = Con.Exec(insertRoleQuery, userID, userRoleId)
+	_, err = tx.Exec(insertRoleQuery, userID, userRoleId)
 	if err != nil {
 		return 0, fmt.Errorf("error inserting into %s table: %w", role, err)
 	}
-
-	fmt.Printf("Created user with ID %d and role %s\n", userID, role)
 	return userID, nil
 }
 
-func GetUserByCredentials(username, providedHash string, nonce string) (*UserData, error) {
-	query := `
-		SELECT u.id, u.username, u.email, u.userpassword, u.role
-		FROM user u
-		WHERE u.username = ?
-	`
+// GetUserByCredentials checks a username and plaintext password and returns the user
+func GetUserByCredentials(username, password string) (*UserData, error) {
+	userID, _, err := authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(userID)
+}
 
-	var user UserData
-	var storedHash string
+// GetUserByID loads a user with their role ID. Teachers who are not approved
+// get an error, so a revoked teacher can't log in or refresh a session.
+func GetUserByID(userID int64) (*UserData, error) {
+	query := "SELECT id, username, IFNULL(email, ''), role, must_change_password, email_verified FROM user WHERE id = ?"
 
-	err := Con.QueryRow(query, username).Scan(
+	var user UserData
+	err := Con.QueryRow(query, userID).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
-		&storedHash,
 		&user.Role,
+		&user.MustChangePassword,
+		&user.EmailVerified,
 	)
-
 	if err != nil {
-		return nil, fmt.Errorf("user not found")
-	}
-
-	// Verify the password using the nonce
-	if !verifyPasswordWithNonce(storedHash, providedHash, nonce) {
-		return nil, errors.New("invalid password")
+		return nil, fmt.Errorf("error retrieving user: %w", err)
 	}
 
 	if user.Role == "student" {
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Status IDs shared by every executor. They mirror the Judge0 status IDs so
+// that results coming from Judge0 can be used without translation.
+const (
+	StatusInQueue           = 1
+	StatusProcessing        = 2
+	StatusAccepted          = 3
+	StatusWrongAnswer       = 4
+	StatusTimeLimitExceeded = 5
+	StatusCompilationError  = 6
+	StatusRuntimeSIGSEGV    = 7
+	StatusRuntimeSIGXFSZ    = 8
+	StatusRuntimeSIGFPE     = 9
+	StatusRuntimeSIGABRT    = 10
+	StatusRuntimeNZEC       = 11
+	StatusRuntimeOther      = 12
+	StatusInternalError     = 13
+	StatusExecFormatError   = 14
+)
+
+// ExecutionLimits overrides the executor's default resource limits for one
+// run. Zero values keep the executor's defaults.
+type ExecutionLimits struct {
+	CPUTime  float64 // seconds
+	MemoryKB int
+	StackKB  int
+}
+
+// ExecutionRequest is a single program run handed to an Executor
+type ExecutionRequest struct {
+	SourceCode string
+	LanguageID int
+	Stdin      string
+	Limits     ExecutionLimits
+	// Files are written next to the program before it runs, by name. Only
+	// interactors use them, so only InteractiveExecutors have to support them.
+	Files map[string]string
+}
+
+// ExecutionResult is the raw outcome of a single program run
+type ExecutionResult struct {
+	Stdout            string
+	Stderr            string
+	CompileOutput     string
+	Message           string
+	StatusID          int
+	StatusDescription string
+	Time              float64 // CPU seconds used, 0 if unknown
+	MemoryKB          int     // peak memory used, 0 if unknown
+}
+
+// unavailableError wraps errors reaching the executor, such as Judge0 being
+// down or rate limiting us, as opposed to requests it can never run
+type unavailableError struct {
+	err error
+}
+
+func (e unavailableError) Error() string { return e.err.Error() }
+func (e unavailableError) Unwrap() error { return e.err }
+
+// isExecutorUnavailable reports whether err may go away if the run is retried
+func isExecutorUnavailable(err error) bool {
+	var unavailable unavailableError
+	return errors.As(err, &unavailable)
+}
+
+// Executor runs submitted code. Implementations must be safe for concurrent use.
+type Executor interface {
+	Execute(req ExecutionRequest) (ExecutionResult, error)
+}
+
+// InteractiveResult is the outcome of a submission run against an interactor
+type InteractiveResult struct {
+	Solution   ExecutionResult
+	Interactor ExecutionResult
+}
+
+// InteractiveExecutor is implemented by executors that can run a submission
+// together with an interactor, the stdout of each connected to the stdin of
+// the other. Solution.Stdin is ignored and the solution's stdout is not captured.
+type InteractiveExecutor interface {
+	Executor
+	ExecuteInteractive(solution, interactor ExecutionRequest) (InteractiveResult, error)
+}
+
+// Exec is the executor used by EvaluateCode, selected by InitExecutor
+var Exec Executor
+
+// InitExecutor selects the code execution backend from the CODE_EXECUTOR
+// environment variable. Supported values:
+//
+//	judge0             - hosted Judge0 on RapidAPI (default), needs JUDGE0_API
+//	judge0_self_hosted - self-hosted Judge0 at JUDGE0_URL, optional JUDGE0_AUTH_TOKEN
+//	local              - compile and run on this server in a sandbox (Linux only)
+//	fake               - in-process fake that echoes stdin, for tests and offline use
+//
+// Judge0 batch submissions can be turned off with JUDGE0_BATCH=false. Test
+// case concurrency is bounded by EXECUTOR_MAX_CONCURRENCY across the server
+// and EXECUTOR_SUBMISSION_CONCURRENCY per submission.
+func InitExecutor() error {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("CODE_EXECUTOR")))
+
+	switch backend {
+	case "", "judge0":
+		apiKey := strings.TrimSpace(os.Getenv("JUDGE0_API"))
+		if apiKey == "" {
+			return errors.New("Judge0 API key not found in environment")
+		}
+		judge0 := NewHostedJudge0Executor(apiKey)
+		judge0.Batch = os.Getenv("JUDGE0_BATCH") != "false"
+		Exec = judge0
+	case "judge0_self_hosted":
+		baseURL := strings.TrimSpace(os.Getenv("JUDGE0_URL"))
+		if baseURL == "" {
+			return errors.New("JUDGE0_URL is required for the self-hosted Judge0 executor")
+		}
+		judge0 := NewSelfHostedJudge0Executor(baseURL, strings.TrimSpace(os.Getenv("JUDGE0_AUTH_TOKEN")))
+		judge0.Batch = os.Getenv("JUDGE0_BATCH") != "false"
+		Exec = judge0
+	case "local":
+		local, err := NewLocalExecutorFromEnv()
+		if err != nil {
+			return err
+		}
+		Exec = local
+	case "fake":
+		Exec = &FakeExecutor{}
+	default:
+		return fmt.Errorf("unknown CODE_EXECUTOR %q", backend)
+	}
+
+	configureConcurrency()
+	log.Printf("Using %s code executor", backendName(backend))
+	return nil
+}
+
+func backendName(backend string) string {
+	if backend == "" {
+		return "judge0"
+	}
+	return backend
+}
+
+// envInt reads a positive integer from the environment, falling back to def
+func envInt(key string, def int64) int64 {
+	v, err := strconv.ParseInt(strings.TrimSpace(os.Getenv(key)), 10, 64)
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,58 @@
+package db
+
+import "sync"
+
+// FakeExecutor is an in-process executor for tests and offline development.
+// It never runs the submitted code. If Handler is set its result is returned,
+// otherwise the program is treated as one that echoes its stdin. Interactive
+// runs use InteractiveHandler, or are accepted by the interactor without it.
+type FakeExecutor struct {
+	Handler            func(req ExecutionRequest) (ExecutionResult, error)
+	InteractiveHandler func(solution, interactor ExecutionRequest) (InteractiveResult, error)
+
+	mu       sync.Mutex
+	requests []ExecutionRequest
+}
+
+// Execute records the request and returns the fake result
+func (f *FakeExecutor) Execute(req ExecutionRequest) (ExecutionResult, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	if f.Handler != nil {
+		return f.Handler(req)
+	}
+
+	return ExecutionResult{
+		Stdout:            req.Stdin,
+		StatusID:          StatusAccepted,
+		StatusDescription: "Accepted",
+	}, nil
+}
+
+// ExecuteInteractive records both requests and returns the fake result
+func (f *FakeExecutor) ExecuteInteractive(solution, interactor ExecutionRequest) (InteractiveResult, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, solution, interactor)
+	f.mu.Unlock()
+
+	if f.InteractiveHandler != nil {
+		return f.InteractiveHandler(solution, interactor)
+	}
+
+	accepted := ExecutionResult{StatusID: StatusAccepted, StatusDescription: "Accepted"}
+	verdict := accepted
+	verdict.Stderr = "accept\n"
+	return InteractiveResult{Solution: accepted, Interactor: verdict}, nil
+}
+
+// Requests returns a copy of every request the executor has received
+func (f *FakeExecutor) Requests() []ExecutionRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	requests := make([]ExecutionRequest, len(f.requests))
+	copy(requests, f.requests)
+	return requests
+}
@@ -0,0 +1,291 @@
+package db
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const rapidAPIHost = "judge0-ce.p.rapidapi.com"
+
+const (
+	// judge0BatchSize is Judge0's default MAX_SUBMISSION_BATCH_SIZE
+	judge0BatchSize    = 20
+	judge0BatchTimeout = 2 * time.Minute
+	judge0PollInterval = 500 * time.Millisecond
+)
+
+// Judge0Submission represents the JSON structure for Judge0 API submission
+type Judge0Submission struct {
+	SourceCode   string  `json:"source_code"`
+	LanguageID   int     `json:"language_id"`
+	Stdin        string  `json:"stdin"`
+	CPUTimeLimit float64 `json:"cpu_time_limit,omitempty"`
+	MemoryLimit  int     `json:"memory_limit,omitempty"`
+	StackLimit   int     `json:"stack_limit,omitempty"`
+}
+
+// Judge0Response represents the JSON structure for Judge0 API response
+type Judge0Response struct {
+	Stdout        string `json:"stdout"`
+	Stderr        string `json:"stderr"`
+	CompileOutput string `json:"compile_output"`
+	Message       string `json:"message"`
+	Time          string `json:"time"`
+	Memory        int    `json:"memory"`
+	Status        struct {
+		ID          int    `json:"id"`
+		Description string `json:"description"`
+	} `json:"status"`
+}
+
+// Judge0Executor runs code on a Judge0 instance, either the hosted RapidAPI
+// one or a self-hosted server
+type Judge0Executor struct {
+	BaseURL string
+	Headers map[string]string
+	Client  *http.Client
+	// Batch enables the /submissions/batch endpoint for multi-case runs
+	Batch bool
+}
+
+// NewHostedJudge0Executor returns an executor for Judge0 CE on RapidAPI
+func NewHostedJudge0Executor(apiKey string) *Judge0Executor {
+	return &Judge0Executor{
+		BaseURL: "https://" + rapidAPIHost,
+		Headers: map[string]string{
+			"X-RapidAPI-Host": rapidAPIHost,
+			"X-RapidAPI-Key":  apiKey,
+		},
+		Client: newJudge0Client(),
+		Batch:  true,
+	}
+}
+
+// NewSelfHostedJudge0Executor returns an executor for a Judge0 server at baseURL.
+// authToken is sent as X-Auth-Token when the server has authentication enabled.
+func NewSelfHostedJudge0Executor(baseURL, authToken string) *Judge0Executor {
+	headers := map[string]string{}
+	if authToken != "" {
+		headers["X-Auth-Token"] = authToken
+	}
+	return &Judge0Executor{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Headers: headers,
+		Client:  newJudge0Client(),
+		Batch:   true,
+	}
+}
+
+func newJudge0Client() *http.Client {
+	// Create a custom HTTP client with a modified TLS configuration that accepts all certificates
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, // Skip certificate verification - use with caution
+			},
+		},
+	}
+}
+
+// Execute submits the code to Judge0 and waits for the result
+func (e *Judge0Executor) Execute(req ExecutionRequest) (ExecutionResult, error) {
+	submission := newJudge0Submission(req)
+
+	var result Judge0Response
+	if err := e.do("POST", "/submissions", url.Values{"wait": {"true"}}, submission, &result); err != nil {
+		return ExecutionResult{}, err
+	}
+
+	return result.toExecutionResult(), nil
+}
+
+// CanBatch reports whether ExecuteBatch should be used
+func (e *Judge0Executor) CanBatch() bool {
+	return e.Batch
+}
+
+// ExecuteBatch runs the requests through Judge0's batch submission endpoint.
+// Every chunk is submitted up front, then the unfinished submissions are
+// polled and each result is reported as soon as Judge0 has it.
+func (e *Judge0Executor) ExecuteBatch(reqs []ExecutionRequest, onResult func(i int, result ExecutionResult)) error {
+	// pending maps the token of every unfinished submission to its request
+	pending := make(map[string]int, len(reqs))
+	var tokens []string
+	for start := 0; start < len(reqs); start += judge0BatchSize {
+		chunk, err := e.submitBatch(reqs[start:min(start+judge0BatchSize, len(reqs))])
+		if err != nil {
+			return err
+		}
+		for i, token := range chunk {
+			pending[token] = start + i
+		}
+		tokens = append(tokens, chunk...)
+	}
+
+	deadline := time.Now().Add(judge0BatchTimeout)
+	for {
+		// Poll in chunks as well, Judge0 limits the tokens of one request
+		unfinished := tokens[:0]
+		for start := 0; start < len(tokens); start += judge0BatchSize {
+			chunk := tokens[start:min(start+judge0BatchSize, len(tokens))]
+			results, err := e.pollBatch(chunk)
+			if err != nil {
+				return err
+			}
+			for i, r := range results {
+				if r.Status.ID == StatusInQueue || r.Status.ID == StatusProcessing {
+					unfinished = append(unfinished, chunk[i])
+					continue
+				}
+				onResult(pending[chunk[i]], r.toExecutionResult())
+			}
+		}
+		tokens = unfinished
+		if len(tokens) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return unavailableError{errors.New("timed out waiting for judge0 batch results")}
+		}
+		time.Sleep(judge0PollInterval)
+	}
+}
+
+// submitBatch creates up to judge0BatchSize submissions and returns their tokens
+func (e *Judge0Executor) submitBatch(reqs []ExecutionRequest) ([]string, error) {
+	batch := struct {
+		Submissions []Judge0Submission `json:"submissions"`
+	}{Submissions: make([]Judge0Submission, len(reqs))}
+	for i, req := range reqs {
+		batch.Submissions[i] = newJudge0Submission(req)
+	}
+
+	var created []struct {
+		Token string `json:"token"`
+	}
+	if err := e.do("POST", "/submissions/batch", nil, batch, &created); err != nil {
+		return nil, err
+	}
+	if len(created) != len(reqs) {
+		return nil, fmt.Errorf("judge0 accepted %d of %d batch submissions", len(created), len(reqs))
+	}
+
+	tokens := make([]string, len(created))
+	for i, c := range created {
+		if c.Token == "" {
+			return nil, fmt.Errorf("judge0 rejected batch submission %d", i+1)
+		}
+		tokens[i] = c.Token
+	}
+	return tokens, nil
+}
+
+// pollBatch fetches the current state of the submissions with the tokens
+func (e *Judge0Executor) pollBatch(tokens []string) ([]Judge0Response, error) {
+	query := url.Values{
+		"tokens": {strings.Join(tokens, ",")},
+		"fields": {"stdout,stderr,compile_output,message,time,memory,status"},
+	}
+	var polled struct {
+		Submissions []Judge0Response `json:"submissions"`
+	}
+	if err := e.do("GET", "/submissions/batch", query, nil, &polled); err != nil {
+		return nil, err
+	}
+	if len(polled.Submissions) != len(tokens) {
+		return nil, fmt.Errorf("judge0 returned %d of %d batch results", len(polled.Submissions), len(tokens))
+	}
+	return polled.Submissions, nil
+}
+
+// do sends a JSON request to Judge0 and decodes the JSON response into out
+func (e *Judge0Executor) do(method, path string, query url.Values, payload any, out any) error {
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("error marshaling submission: %w", err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	httpReq, err := http.NewRequest(method, e.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	// Set headers
+	httpReq.Header.Set("Content-Type", "application/json")
+	for key, value := range e.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	// Add query parameters
+	q := url.Values{}
+	for key, values := range query {
+		q[key] = values
+	}
+	q.Set("base64_encoded", "false")
+	httpReq.URL.RawQuery = q.Encode()
+
+	resp, err := e.Client.Do(httpReq)
+	if err != nil {
+		return unavailableError{fmt.Errorf("error sending request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return unavailableError{fmt.Errorf("error reading response: %w", err)}
+	}
+
+	if resp.StatusCode >= 400 {
+		err := fmt.Errorf("judge0 returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return unavailableError{err}
+		}
+		return err
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("error unmarshaling response: %w", err)
+	}
+	return nil
+}
+
+func newJudge0Submission(req ExecutionRequest) Judge0Submission {
+	return Judge0Submission{
+		SourceCode:   req.SourceCode,
+		LanguageID:   req.LanguageID,
+		Stdin:        req.Stdin,
+		CPUTimeLimit: req.Limits.CPUTime,
+		MemoryLimit:  req.Limits.MemoryKB,
+		StackLimit:   req.Limits.StackKB,
+	}
+}
+
+func (r Judge0Response) toExecutionResult() ExecutionResult {
+	// Judge0 reports time as a decimal string, or null when nothing ran
+	timeUsed, _ := strconv.ParseFloat(r.Time, 64)
+	return ExecutionResult{
+		Stdout:            r.Stdout,
+		Stderr:            r.Stderr,
+		CompileOutput:     r.CompileOutput,
+		Message:           r.Message,
+		StatusID:          r.Status.ID,
+		StatusDescription: r.Status.Description,
+		Time:              timeUsed,
+		MemoryKB:          r.Memory,
+	}
+}
@@ -0,0 +1,738 @@
+//go:build linux
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxHelperArg makes the server binary act as the exec step of the
+// sandbox. The helper applies rlimits to itself and then execs the submitted
+// program, so the limits are in place before any untrusted code runs. See
+// executor_local_sandbox.go for the steps before it.
+const sandboxHelperArg = "__procode_sandbox"
+
+// sandboxUID is the user the submitted program runs as inside its user namespace
+const sandboxUID = 1000
+
+func init() {
+	if len(os.Args) < 2 {
+		return
+	}
+	switch os.Args[1] {
+	case sandboxInitArg:
+		runSandboxInit(os.Args[2:])
+	case sandboxHelperArg:
+		runSandboxHelper(os.Args[2:])
+	case sandboxCleanupArg:
+		runSandboxCleanup(os.Args[2:])
+	}
+}
+
+// LocalLimits are the resource limits applied to a single sandboxed process
+type LocalLimits struct {
+	CPUTime    time.Duration
+	WallTime   time.Duration
+	MemoryKB   int64
+	StackKB    int64
+	Processes  int64
+	OutputKB   int64
+	FileSizeKB int64
+}
+
+// localLanguage describes how to build and run one language with local toolchains.
+// "{memory_mb}" in a command is replaced with the memory limit in megabytes.
+type localLanguage struct {
+	Name       string
+	SourceFile string
+	Compile    []string
+	Run        []string
+	// LimitAddressSpace is false for runtimes (JVM, V8, Go toolchain) that
+	// reserve far more virtual memory than they use. Their heap is capped
+	// with a runtime flag instead.
+	LimitAddressSpace bool
+	Env               []string
+}
+
+// localLanguages maps the Judge0 language IDs used by the frontend to local toolchains
+var localLanguages = map[int]localLanguage{
+	71: {
+		Name:              "Python 3",
+		SourceFile:        "main.py",
+		Run:               []string{"python3", "main.py"},
+		LimitAddressSpace: true,
+	},
+	60: {
+		Name:       "Go",
+		SourceFile: "main.go",
+		Compile:    []string{"go", "build", "-o", "main", "main.go"},
+		Run:        []string{"./main"},
+		Env:        []string{"CGO_ENABLED=0", "GOFLAGS=-mod=mod", "GOTOOLCHAIN=local"},
+	},
+	62: {
+		Name:       "Java",
+		SourceFile: "Main.java",
+		Compile:    []string{"javac", "Main.java"},
+		Run:        []string{"java", "-Xmx{memory_mb}m", "-XX:+UseSerialGC", "-cp", ".", "Main"},
+	},
+	54: {
+		Name:              "C++",
+		SourceFile:        "main.cpp",
+		Compile:           []string{"g++", "-O2", "-std=c++17", "-o", "main", "main.cpp"},
+		Run:               []string{"./main"},
+		LimitAddressSpace: true,
+	},
+	50: {
+		Name:              "C",
+		SourceFile:        "main.c",
+		Compile:           []string{"gcc", "-O2", "-std=c11", "-o", "main", "main.c", "-lm"},
+		Run:               []string{"./main"},
+		LimitAddressSpace: true,
+	},
+	63: {
+		Name:       "JavaScript",
+		SourceFile: "main.js",
+		Run:        []string{"node", "--max-old-space-size={memory_mb}", "main.js"},
+	},
+}
+
+// LocalExecutor compiles and runs submissions on this machine. Every program
+// gets its own temporary directory and host uid, rlimits and a wall-clock
+// timeout. It runs in namespaces with a read-only root that holds only
+// RootDirs and its directory, and, unless AllowNetwork is set, no network.
+type LocalExecutor struct {
+	WorkDir       string
+	Limits        LocalLimits
+	CompileLimits LocalLimits
+	// RootDirs are the host paths visible, read-only, inside the sandbox
+	RootDirs []string
+	// UIDCount host uids from UIDBase on are reserved for sandboxed programs.
+	// No account may use them, and the server needs CAP_SETUID and
+	// CAP_SETGID to map them.
+	UIDBase  int
+	UIDCount int
+	// GoCache is a build cache shared by Go compilations. Only the compile
+	// step sees it, never the compiled program. When empty every
+	// compilation starts from a cold cache, which is slow but fully isolated.
+	GoCache      string
+	AllowNetwork bool
+
+	uidsOnce sync.Once
+	uids     *sandboxUIDs
+}
+
+// NewLocalExecutorFromEnv builds a LocalExecutor configured by LOCAL_RUNNER_* variables
+func NewLocalExecutorFromEnv() (*LocalExecutor, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("error locating server binary for sandbox helper: %w", err)
+	}
+	if _, err := os.Stat(self); err != nil {
+		return nil, fmt.Errorf("sandbox helper binary not accessible: %w", err)
+	}
+
+	rootDirs := envList("LOCAL_RUNNER_ROOT_DIRS")
+	if len(rootDirs) == 0 {
+		rootDirs = defaultSandboxRootDirs
+	}
+
+	e := &LocalExecutor{
+		WorkDir: os.Getenv("LOCAL_RUNNER_WORKDIR"),
+		Limits: LocalLimits{
+			CPUTime:   time.Duration(envInt("LOCAL_RUNNER_CPU_SECONDS", 2)) * time.Second,
+			WallTime:  time.Duration(envInt("LOCAL_RUNNER_WALL_SECONDS", 5)) * time.Second,
+			MemoryKB:  envInt("LOCAL_RUNNER_MEMORY_KB", 256*1024),
+			StackKB:   envInt("LOCAL_RUNNER_STACK_KB", 64*1024),
+			Processes: envInt("LOCAL_RUNNER_MAX_PROCESSES", 128),
+			OutputKB:  envInt("LOCAL_RUNNER_MAX_OUTPUT_KB", 1024),
+			// Submissions have no reason to write files larger than their output
+			FileSizeKB: envInt("LOCAL_RUNNER_MAX_OUTPUT_KB", 1024),
+		},
+		CompileLimits: LocalLimits{
+			CPUTime:   time.Duration(envInt("LOCAL_RUNNER_COMPILE_CPU_SECONDS", 20)) * time.Second,
+			WallTime:  time.Duration(envInt("LOCAL_RUNNER_COMPILE_WALL_SECONDS", 30)) * time.Second,
+			MemoryKB:  envInt("LOCAL_RUNNER_COMPILE_MEMORY_KB", 1024*1024),
+			StackKB:   envInt("LOCAL_RUNNER_STACK_KB", 64*1024),
+			Processes: envInt("LOCAL_RUNNER_COMPILE_MAX_PROCESSES", 256),
+			OutputKB:  envInt("LOCAL_RUNNER_MAX_OUTPUT_KB", 1024),
+			// Compilers write object files and build caches
+			FileSizeKB: envInt("LOCAL_RUNNER_COMPILE_MAX_FILE_KB", 512*1024),
+		},
+		RootDirs:     rootDirs,
+		UIDBase:      int(envInt("LOCAL_RUNNER_UID_BASE", 200000)),
+		UIDCount:     int(envInt("LOCAL_RUNNER_UID_COUNT", 256)),
+		GoCache:      os.Getenv("LOCAL_RUNNER_GOCACHE"),
+		AllowNetwork: os.Getenv("LOCAL_RUNNER_ALLOW_NETWORK") == "true",
+	}
+	// A server given CAP_SETUID and CAP_SETGID as file capabilities starts
+	// non-dumpable, and then can't write the uid maps of its sandboxes.
+	// Sandboxed programs run as other uids, so they still can't attach to it.
+	if err := unix.Prctl(unix.PR_SET_DUMPABLE, 1, 0, 0, 0); err != nil {
+		return nil, fmt.Errorf("error making the server dumpable: %w", err)
+	}
+	if err := e.checkSandbox(); err != nil {
+		return nil, fmt.Errorf("local executor sandbox is not available (needs user namespaces and CAP_SETUID/CAP_SETGID): %w", err)
+	}
+	return e, nil
+}
+
+// Execute compiles (if needed) and runs the submission against req.Stdin
+func (e *LocalExecutor) Execute(req ExecutionRequest) (ExecutionResult, error) {
+	box, lang, compileFailure, err := e.prepare(req)
+	if box != nil {
+		defer e.release(box)
+	}
+	if err != nil {
+		return ExecutionResult{}, err
+	}
+	if compileFailure != nil {
+		return *compileFailure, nil
+	}
+
+	limits := e.Limits.with(req.Limits)
+	run, err := e.runSandboxed(box, lang, lang.Run, req.Stdin, limits, false)
+	if err != nil {
+		return ExecutionResult{}, err
+	}
+	return run.result(limits), nil
+}
+
+// ExecuteInteractive runs the solution and the interactor at the same time,
+// each in its own sandbox, with the stdout of one piped into the stdin of the other.
+// The boxes have different uids and neither is mounted in the other's root, so
+// the solution can't read the expected answer the interactor is given.
+func (e *LocalExecutor) ExecuteInteractive(solution, interactor ExecutionRequest) (InteractiveResult, error) {
+	solBox, solLang, compileFailure, err := e.prepare(solution)
+	if solBox != nil {
+		defer e.release(solBox)
+	}
+	if err != nil {
+		return InteractiveResult{}, err
+	}
+	if compileFailure != nil {
+		return InteractiveResult{Solution: *compileFailure}, nil
+	}
+
+	interBox, interLang, compileFailure, err := e.prepare(interactor)
+	if interBox != nil {
+		defer e.release(interBox)
+	}
+	if err != nil {
+		return InteractiveResult{}, fmt.Errorf("interactor: %w", err)
+	}
+	if compileFailure != nil {
+		return InteractiveResult{
+			Solution: ExecutionResult{
+				Message:           "Interactor failed to compile",
+				StatusID:          StatusInternalError,
+				StatusDescription: "Internal Error",
+			},
+			Interactor: *compileFailure,
+		}, nil
+	}
+
+	solLimits := e.Limits.with(solution.Limits)
+	interLimits := e.Limits.with(interactor.Limits)
+	// The interactor spends most of its time waiting for the solution
+	interLimits.WallTime = max(interLimits.WallTime, solLimits.WallTime)
+
+	sol, err := e.sandboxCommand(solBox, solLang, solLang.Run, solLimits, false)
+	if err != nil {
+		return InteractiveResult{}, err
+	}
+	defer sol.cancel()
+	inter, err := e.sandboxCommand(interBox, interLang, interLang.Run, interLimits, false)
+	if err != nil {
+		return InteractiveResult{}, err
+	}
+	defer inter.cancel()
+
+	toInteractor, fromSolution, err := os.Pipe()
+	if err != nil {
+		return InteractiveResult{}, fmt.Errorf("error creating pipe: %w", err)
+	}
+	toSolution, fromInteractor, err := os.Pipe()
+	if err != nil {
+		toInteractor.Close()
+		fromSolution.Close()
+		return InteractiveResult{}, fmt.Errorf("error creating pipe: %w", err)
+	}
+	sol.cmd.Stdin, sol.cmd.Stdout = toSolution, fromSolution
+	inter.cmd.Stdin, inter.cmd.Stdout = toInteractor, fromInteractor
+
+	solErr := sol.start()
+	interErr := error(nil)
+	if solErr == nil {
+		interErr = inter.start()
+	}
+	// Only the children may hold the pipes, so each side sees EOF once the other exits
+	for _, f := range []*os.File{toInteractor, fromSolution, toSolution, fromInteractor} {
+		f.Close()
+	}
+	if solErr != nil {
+		return InteractiveResult{}, fmt.Errorf("error starting sandboxed process: %w", solErr)
+	}
+	if interErr != nil {
+		sol.cancel()
+		sol.cmd.Wait()
+		sol.status.Close()
+		return InteractiveResult{}, fmt.Errorf("error starting interactor: %w", interErr)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		interErr = inter.cmd.Wait()
+	}()
+	solErr = sol.cmd.Wait()
+	wg.Wait()
+
+	solRun, err := sol.outcome(solErr)
+	if err != nil {
+		return InteractiveResult{}, err
+	}
+	interRun, err := inter.outcome(interErr)
+	if err != nil {
+		return InteractiveResult{}, fmt.Errorf("interactor: %w", err)
+	}
+	return InteractiveResult{
+		Solution:   solRun.result(solLimits),
+		Interactor: interRun.result(interLimits),
+	}, nil
+}
+
+// prepare writes the program and its files to a new box and compiles it. A
+// failed compilation is returned as a result rather than an error. The caller
+// releases the box, which is returned even when preparing fails.
+func (e *LocalExecutor) prepare(req ExecutionRequest) (*localBox, localLanguage, *ExecutionResult, error) {
+	lang, ok := localLanguages[req.LanguageID]
+	if !ok {
+		return nil, lang, nil, fmt.Errorf("language ID %d is not supported by the local executor", req.LanguageID)
+	}
+
+	box, err := e.newBox()
+	if err != nil {
+		return nil, lang, nil, err
+	}
+	dir := box.boxDir()
+
+	if err := os.WriteFile(filepath.Join(dir, lang.SourceFile), []byte(req.SourceCode), 0644); err != nil {
+		return box, lang, nil, fmt.Errorf("error writing source file: %w", err)
+	}
+	for name, content := range req.Files {
+		if name != filepath.Base(name) || name == lang.SourceFile {
+			return box, lang, nil, fmt.Errorf("invalid file name %q", name)
+		}
+		// Only the box's own uid may read them, they can hold the expected output
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			return box, lang, nil, fmt.Errorf("error writing file %s: %w", name, err)
+		}
+	}
+
+	if len(lang.Compile) == 0 {
+		return box, lang, nil, nil
+	}
+	compiled, err := e.runSandboxed(box, lang, lang.Compile, "", e.CompileLimits, true)
+	if err != nil {
+		return box, lang, nil, err
+	}
+	if compiled.status() != StatusAccepted {
+		output := strings.TrimSpace(compiled.Stderr + "\n" + compiled.Stdout)
+		if compiled.TimedOut {
+			output = "Compilation timed out"
+		}
+		return box, lang, &ExecutionResult{
+			CompileOutput:     output,
+			StatusID:          StatusCompilationError,
+			StatusDescription: "Compilation Error",
+		}, nil
+	}
+	return box, lang, nil, nil
+}
+
+// with applies the per-run overrides of a request to the limits
+func (l LocalLimits) with(o ExecutionLimits) LocalLimits {
+	if o.CPUTime > 0 {
+		l.CPUTime = time.Duration(o.CPUTime * float64(time.Second))
+		// Leave room for time spent waiting on I/O and process startup
+		l.WallTime = max(l.WallTime, 2*l.CPUTime+time.Second)
+	}
+	if o.MemoryKB > 0 {
+		l.MemoryKB = int64(o.MemoryKB)
+	}
+	if o.StackKB > 0 {
+		l.StackKB = int64(o.StackKB)
+	}
+	return l
+}
+
+// sandboxOutcome is what happened to one sandboxed process
+type sandboxOutcome struct {
+	Stdout         string
+	Stderr         string
+	Time           float64 // user + system CPU seconds
+	MemoryKB       int64   // peak resident set size
+	ExitCode       int
+	Signal         syscall.Signal
+	TimedOut       bool
+	OutputExceeded bool
+}
+
+var localStatusDescriptions = map[int]string{
+	StatusAccepted:          "Accepted",
+	StatusTimeLimitExceeded: "Time Limit Exceeded",
+	StatusRuntimeSIGSEGV:    "Runtime Error (SIGSEGV)",
+	StatusRuntimeSIGXFSZ:    "Output Limit Exceeded",
+	StatusRuntimeSIGFPE:     "Runtime Error (SIGFPE)",
+	StatusRuntimeSIGABRT:    "Runtime Error (SIGABRT)",
+	StatusRuntimeNZEC:       "Runtime Error (NZEC)",
+	StatusRuntimeOther:      "Runtime Error (Other)",
+}
+
+func (o sandboxOutcome) status() int {
+	switch {
+	case o.OutputExceeded:
+		return StatusRuntimeSIGXFSZ
+	case o.TimedOut, o.Signal == syscall.SIGXCPU:
+		return StatusTimeLimitExceeded
+	case o.Signal == syscall.SIGSEGV:
+		return StatusRuntimeSIGSEGV
+	case o.Signal == syscall.SIGXFSZ:
+		return StatusRuntimeSIGXFSZ
+	case o.Signal == syscall.SIGFPE:
+		return StatusRuntimeSIGFPE
+	case o.Signal == syscall.SIGABRT:
+		return StatusRuntimeSIGABRT
+	case o.Signal != 0:
+		return StatusRuntimeOther
+	case o.ExitCode != 0:
+		return StatusRuntimeNZEC
+	}
+	return StatusAccepted
+}
+
+// result converts the outcome of a run with the given limits into an ExecutionResult
+func (o sandboxOutcome) result(limits LocalLimits) ExecutionResult {
+	statusID := o.status()
+	message := o.message()
+	// RLIMIT_CPU has whole-second granularity, enforce fractional limits here
+	if statusID != StatusTimeLimitExceeded && o.Time > limits.CPUTime.Seconds() {
+		statusID = StatusTimeLimitExceeded
+		message = "CPU time limit exceeded"
+	}
+
+	return ExecutionResult{
+		Stdout:            o.Stdout,
+		Stderr:            o.Stderr,
+		Message:           message,
+		StatusID:          statusID,
+		StatusDescription: localStatusDescriptions[statusID],
+		Time:              o.Time,
+		MemoryKB:          int(o.MemoryKB),
+	}
+}
+
+func (o sandboxOutcome) message() string {
+	switch {
+	case o.OutputExceeded:
+		return "Output limit exceeded"
+	case o.TimedOut:
+		return "Wall-clock time limit exceeded"
+	case o.Signal != 0:
+		return "Program terminated by signal: " + o.Signal.String()
+	case o.ExitCode != 0:
+		return "Exited with error status " + strconv.Itoa(o.ExitCode)
+	}
+	return ""
+}
+
+// runSandboxed runs argv in the box through the sandbox with the given
+// limits. compile is set for the compile step of a language.
+func (e *LocalExecutor) runSandboxed(box *localBox, lang localLanguage, argv []string, stdin string, limits LocalLimits, compile bool) (sandboxOutcome, error) {
+	p, err := e.sandboxCommand(box, lang, argv, limits, compile)
+	if err != nil {
+		return sandboxOutcome{}, err
+	}
+	defer p.cancel()
+
+	p.cmd.Stdin = strings.NewReader(stdin)
+	if err := p.start(); err != nil {
+		p.status.Close()
+		return sandboxOutcome{}, fmt.Errorf("error starting sandboxed process: %w", err)
+	}
+	return p.outcome(p.cmd.Wait())
+}
+
+// sandboxProcess is a sandboxed command that has been set up but not started.
+// Its stdin and stdout can still be replaced before it starts.
+type sandboxProcess struct {
+	cmd    *exec.Cmd
+	ctx    context.Context
+	cancel context.CancelFunc
+	stdout *limitedBuffer
+	stderr *limitedBuffer
+	// status is read by outcome, statusWriter is the sandbox's end
+	status       *os.File
+	statusWriter *os.File
+}
+
+// start starts the process and lets go of the sandbox's end of the status pipe
+func (p *sandboxProcess) start() error {
+	err := p.cmd.Start()
+	p.statusWriter.Close()
+	return err
+}
+
+// sandboxCommand prepares argv to run in the box through the sandbox. The
+// wall-clock timeout starts now; the caller must call cancel when done.
+func (e *LocalExecutor) sandboxCommand(box *localBox, lang localLanguage, argv []string, limits LocalLimits, compile bool) (*sandboxProcess, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("error locating sandbox helper: %w", err)
+	}
+
+	memoryKB := limits.MemoryKB
+	if compile || !lang.LimitAddressSpace {
+		memoryKB = 0
+	}
+
+	memoryMB := strconv.FormatInt(max(limits.MemoryKB/1024, 16), 10)
+	command := make([]string, len(argv))
+	for i, arg := range argv {
+		command[i] = strings.ReplaceAll(arg, "{memory_mb}", memoryMB)
+	}
+
+	cfg := sandboxConfig{
+		Box:      box.boxDir(),
+		Root:     box.rootDir(),
+		Helper:   self,
+		ReadOnly: e.RootDirs,
+		TmpKB:    limits.FileSizeKB,
+		Umask:    0022,
+	}
+	goCache := sandboxBoxDir + "/.gocache"
+	if compile && e.GoCache != "" {
+		// Compilations run as different uids, all of which write the cache
+		cfg.GoCache, cfg.Umask = e.GoCache, 0
+		goCache = sandboxGoCache
+	}
+	if len(command) > 0 {
+		cfg.Exec = []string{
+			strconv.FormatInt(int64(math.Ceil(limits.CPUTime.Seconds())), 10),
+			strconv.FormatInt(memoryKB, 10),
+			strconv.FormatInt(limits.StackKB, 10),
+			strconv.FormatInt(limits.Processes, 10),
+			strconv.FormatInt(limits.FileSizeKB, 10),
+			"--",
+		}
+		cfg.Exec = append(cfg.Exec, command...)
+	}
+	encoded, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding sandbox config: %w", err)
+	}
+
+	status, statusWriter, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating status pipe: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), limits.WallTime)
+
+	cmd := exec.CommandContext(ctx, self, sandboxInitArg, string(encoded))
+	cmd.Dir = box.dir
+	cmd.ExtraFiles = []*os.File{statusWriter}
+	cmd.Env = append([]string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + sandboxBoxDir,
+		"TMPDIR=" + sandboxBoxDir,
+		"LANG=C.UTF-8",
+		"GOCACHE=" + goCache,
+		"GOPATH=" + sandboxBoxDir + "/.gopath",
+	}, lang.Env...)
+
+	outputLimit := int(limits.OutputKB * 1024)
+	stdout := &limitedBuffer{limit: outputLimit}
+	stderr := &limitedBuffer{limit: outputLimit}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+			syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		GidMappingsEnableSetgroups: true,
+	}
+	if !e.AllowNetwork {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr.UidMappings, cmd.SysProcAttr.GidMappings = sandboxIDMappings(box.uid)
+
+	// Kill the whole process group, not just the helper, on timeout or overflow
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	stdout.onOverflow = cancel
+	stderr.onOverflow = cancel
+
+	return &sandboxProcess{
+		cmd: cmd, ctx: ctx, cancel: cancel, stdout: stdout, stderr: stderr,
+		status: status, statusWriter: statusWriter,
+	}, nil
+}
+
+// outcome collects what happened to the program once the sandbox has
+// exited with runErr. The program's exit status and resource usage come from
+// the sandbox's init step; without them the sandbox itself failed, unless it
+// was killed for running out of time or output.
+func (p *sandboxProcess) outcome(runErr error) (sandboxOutcome, error) {
+	status, _ := io.ReadAll(p.status)
+	p.status.Close()
+
+	outcome := sandboxOutcome{
+		Stdout:         p.stdout.String(),
+		Stderr:         p.stderr.String(),
+		OutputExceeded: p.stdout.overflowed() || p.stderr.overflowed(),
+		TimedOut:       errors.Is(p.ctx.Err(), context.DeadlineExceeded),
+	}
+
+	var exitCode, signal int
+	var userUS, systemUS, maxRSS int64
+	_, err := fmt.Sscanf(string(status), "%d %d %d %d %d", &exitCode, &signal, &userUS, &systemUS, &maxRSS)
+	if err != nil {
+		if outcome.TimedOut || outcome.OutputExceeded {
+			if usage, ok := p.cmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
+				outcome.Time = time.Duration(usage.Utime.Nano() + usage.Stime.Nano()).Seconds()
+				outcome.MemoryKB = usage.Maxrss
+			}
+			return outcome, nil
+		}
+		return sandboxOutcome{}, fmt.Errorf("sandbox failed: %v: %s", runErr, strings.TrimSpace(p.stderr.String()))
+	}
+
+	outcome.ExitCode = exitCode
+	outcome.Signal = syscall.Signal(signal)
+	outcome.Time = time.Duration((userUS + systemUS) * int64(time.Microsecond)).Seconds()
+	outcome.MemoryKB = maxRSS
+	return outcome, nil
+}
+
+// runSandboxHelper is executed inside the sandbox. Arguments are
+// cpu-seconds, address-space-kb, stack-kb, processes, file-size-kb, "--", argv...
+// A limit of 0 leaves that resource unlimited.
+func runSandboxHelper(args []string) {
+	if len(args) < 7 || args[5] != "--" {
+		fmt.Fprintln(os.Stderr, "sandbox: invalid arguments")
+		os.Exit(127)
+	}
+
+	var values [5]uint64
+	for i := range values {
+		v, err := strconv.ParseUint(args[i], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "sandbox: invalid limit:", args[i])
+			os.Exit(127)
+		}
+		values[i] = v
+	}
+
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_CPU, values[0]},
+		{unix.RLIMIT_AS, values[1] * 1024},
+		{unix.RLIMIT_STACK, values[2] * 1024},
+		{unix.RLIMIT_NPROC, values[3]},
+		{unix.RLIMIT_FSIZE, values[4] * 1024},
+		{unix.RLIMIT_CORE, 0},
+	}
+	for _, l := range limits {
+		if l.value == 0 && l.resource != unix.RLIMIT_CORE {
+			continue
+		}
+		rlimit := unix.Rlimit{Cur: l.value, Max: l.value}
+		if l.resource == unix.RLIMIT_CPU {
+			// Leave headroom between the soft and hard limit so SIGXCPU is delivered
+			rlimit.Max = l.value + 1
+		}
+		if err := unix.Setrlimit(l.resource, &rlimit); err != nil {
+			fmt.Fprintln(os.Stderr, "sandbox: setrlimit failed:", err)
+			os.Exit(127)
+		}
+	}
+
+	// Neither the program nor anything it runs may gain privileges
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		fmt.Fprintln(os.Stderr, "sandbox: prctl failed:", err)
+		os.Exit(127)
+	}
+
+	argv := args[6:]
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sandbox:", err)
+		os.Exit(127)
+	}
+	err = syscall.Exec(path, argv, os.Environ())
+	fmt.Fprintln(os.Stderr, "sandbox: exec failed:", err)
+	os.Exit(127)
+}
+
+// limitedBuffer keeps at most limit bytes and reports when more were written
+type limitedBuffer struct {
+	mu         sync.Mutex
+	buf        bytes.Buffer
+	limit      int
+	exceeded   bool
+	onOverflow func()
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.exceeded {
+		return len(p), nil
+	}
+	if b.buf.Len()+len(p) > b.limit {
+		b.buf.Write(p[:b.limit-b.buf.Len()])
+		b.exceeded = true
+		if b.onOverflow != nil {
+			b.onOverflow()
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *limitedBuffer) overflowed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exceeded
+}
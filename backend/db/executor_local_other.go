@@ -0,0 +1,24 @@
+//go:build !linux
+
+package db
+
+import "errors"
+
+// LocalExecutor is only available on Linux, where namespaces and rlimits
+// are used to sandbox submissions
+type LocalExecutor struct{}
+
+// NewLocalExecutorFromEnv always fails on platforms other than Linux
+func NewLocalExecutorFromEnv() (*LocalExecutor, error) {
+	return nil, errors.New("the local executor is only supported on Linux")
+}
+
+// Execute is never reached because NewLocalExecutorFromEnv fails
+func (e *LocalExecutor) Execute(req ExecutionRequest) (ExecutionResult, error) {
+	return ExecutionResult{}, errors.New("the local executor is only supported on Linux")
+}
+
+// ExecuteInteractive is never reached because NewLocalExecutorFromEnv fails
+func (e *LocalExecutor) ExecuteInteractive(solution, interactor ExecutionRequest) (InteractiveResult, error) {
+	return InteractiveResult{}, errors.New("the local executor is only supported on Linux")
+}
@@ -0,0 +1,425 @@
+//go:build linux
+
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// The sandbox is built in three steps, each a run of the server binary:
+//
+//  1. The executor starts the init step in new user, mount, PID, IPC, UTS
+//     and (usually) network namespaces. Namespace root is mapped to the
+//     server's own uid and sandboxUID to a host uid reserved for the run.
+//  2. The init step, PID 1 of the sandbox, builds a read-only root that
+//     holds only the toolchain directories and the run's box, pivots into
+//     it and starts the exec step as sandboxUID. Once that exits it reports
+//     how on the status pipe, and every process left in the sandbox dies
+//     with it.
+//  3. The exec step applies the rlimits and execs the submitted program.
+//
+// The submitted program therefore sees neither the server's files nor other
+// runs, has no capabilities and can't gain any, and its process limit
+// counts against a uid no other run or the server uses.
+
+// Arguments that make the server binary act as one of the sandbox steps
+const (
+	sandboxInitArg    = "__procode_sandbox_init"
+	sandboxCleanupArg = "__procode_sandbox_cleanup"
+)
+
+// Paths inside the sandbox
+const (
+	sandboxBoxDir  = "/box"
+	sandboxHelper  = "/.sandbox"
+	sandboxGoCache = "/gocache"
+)
+
+// sandboxStatusFD is where the init step reports how the program exited
+const sandboxStatusFD = 3
+
+// defaultSandboxRootDirs are bound read-only into every sandbox. They hold the
+// toolchains and the libraries they load, but no server files.
+var defaultSandboxRootDirs = []string{"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/libx32", "/etc"}
+
+// sandboxDevices are bound from the host's /dev
+var sandboxDevices = []string{"null", "zero", "full", "random", "urandom"}
+
+// sandboxConfig tells the init step how to build the sandbox
+type sandboxConfig struct {
+	Box      string   // Host directory bound read-write at /box
+	Root     string   // Empty host directory the root is assembled on
+	Helper   string   // Server binary, bound at /.sandbox for the exec step
+	ReadOnly []string // Host paths bound read-only at the same path
+	GoCache  string   // Host Go build cache bound at /gocache, if set
+	TmpKB    int64    // Size of the tmpfs at /tmp
+	Umask    int
+	Exec     []string // Arguments of the exec step, none to only check the sandbox
+}
+
+// sandboxUIDs hands out the host uids sandboxed programs run as. Each box
+// holds one until it is released, so no two runs ever share a uid.
+type sandboxUIDs struct {
+	free chan int
+}
+
+func newSandboxUIDs(base, count int) *sandboxUIDs {
+	free := make(chan int, count)
+	for i := 0; i < count; i++ {
+		free <- base + i
+	}
+	return &sandboxUIDs{free: free}
+}
+
+// acquire waits for a free uid
+func (u *sandboxUIDs) acquire() int {
+	return <-u.free
+}
+
+func (u *sandboxUIDs) release(uid int) {
+	u.free <- uid
+}
+
+// localBox is the directory one program is written, compiled and run in,
+// together with the host uid it runs as
+type localBox struct {
+	dir string // Holds box/, bound at /box, and root/, where the sandbox root is built
+	uid int
+}
+
+func (b *localBox) boxDir() string {
+	return filepath.Join(b.dir, "box")
+}
+
+func (b *localBox) rootDir() string {
+	return filepath.Join(b.dir, "root")
+}
+
+// newBox creates an empty box with a uid of its own. The caller must release it.
+func (e *LocalExecutor) newBox() (*localBox, error) {
+	box := &localBox{uid: e.sandboxUIDs().acquire()}
+
+	dir, err := os.MkdirTemp(e.WorkDir, "procode-run-")
+	if err != nil {
+		e.uids.release(box.uid)
+		return nil, fmt.Errorf("error creating sandbox directory: %w", err)
+	}
+	box.dir = dir
+	for _, sub := range []string{box.boxDir(), box.rootDir()} {
+		if err := os.Mkdir(sub, 0755); err != nil {
+			e.release(box)
+			return nil, fmt.Errorf("error creating sandbox directory: %w", err)
+		}
+	}
+	return box, nil
+}
+
+// release deletes the box and returns its uid. The program may have left
+// files the server can't delete, so they are removed from inside a user
+// namespace where the server is root over the box's uid.
+func (e *LocalExecutor) release(box *localBox) {
+	self, _ := os.Executable()
+	cmd := exec.Command(self, sandboxCleanupArg, box.dir)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWUSER}
+	cmd.SysProcAttr.UidMappings, cmd.SysProcAttr.GidMappings = sandboxIDMappings(box.uid)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: error removing %s: %v %s\n", box.dir, err, output)
+	}
+	os.RemoveAll(box.dir)
+	e.uids.release(box.uid)
+}
+
+func (e *LocalExecutor) sandboxUIDs() *sandboxUIDs {
+	e.uidsOnce.Do(func() {
+		e.uids = newSandboxUIDs(e.UIDBase, max(e.UIDCount, 1))
+	})
+	return e.uids
+}
+
+// sandboxIDMappings maps namespace root to the server and sandboxUID to the
+// box's host uid. Mapping a uid other than its own needs CAP_SETUID and
+// CAP_SETGID, so the server must have them or run as root.
+func sandboxIDMappings(uid int) (uids, gids []syscall.SysProcIDMap) {
+	uids = []syscall.SysProcIDMap{
+		{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+		{ContainerID: sandboxUID, HostID: uid, Size: 1},
+	}
+	gids = []syscall.SysProcIDMap{
+		{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+		{ContainerID: sandboxUID, HostID: uid, Size: 1},
+	}
+	return uids, gids
+}
+
+// checkSandbox builds a sandbox without running anything in it, so that a
+// server that can't create one fails at startup rather than on every submission
+func (e *LocalExecutor) checkSandbox() error {
+	box, err := e.newBox()
+	if err != nil {
+		return err
+	}
+	defer e.release(box)
+
+	p, err := e.sandboxCommand(box, localLanguage{}, nil, e.Limits, false)
+	if err != nil {
+		return err
+	}
+	defer p.cancel()
+	defer p.status.Close()
+	if err := p.start(); err != nil {
+		return err
+	}
+	if err := p.cmd.Wait(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(p.stderr.String()))
+	}
+	return nil
+}
+
+// runSandboxInit is PID 1 of the sandbox. It builds the root, starts the exec
+// step as sandboxUID and reports its exit status and resource usage on the
+// status pipe as "<exit code> <signal> <user µs> <system µs> <max RSS KB>".
+func runSandboxInit(args []string) {
+	var cfg sandboxConfig
+	if len(args) != 1 || json.Unmarshal([]byte(args[0]), &cfg) != nil {
+		sandboxFail("invalid arguments")
+	}
+	// Only this process may write the status, not the program
+	syscall.CloseOnExec(sandboxStatusFD)
+
+	if err := buildSandboxRoot(cfg); err != nil {
+		sandboxFail(err.Error())
+	}
+	if len(cfg.Exec) == 0 {
+		os.Exit(0)
+	}
+
+	syscall.Umask(cfg.Umask)
+	cmd := exec.Command(sandboxHelper, append([]string{sandboxHelperArg}, cfg.Exec...)...)
+	cmd.Dir = sandboxBoxDir
+	cmd.Env = os.Environ()
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: sandboxUID, Gid: sandboxUID, Groups: []uint32{}},
+	}
+	if err := cmd.Start(); err != nil {
+		sandboxFail("error starting program: " + err.Error())
+	}
+	cmd.Wait()
+
+	var exitCode, signal int
+	status := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if status.Signaled() {
+		signal = int(status.Signal())
+	} else {
+		exitCode = status.ExitStatus()
+	}
+	usage := cmd.ProcessState.SysUsage().(*syscall.Rusage)
+	fmt.Fprintf(os.NewFile(sandboxStatusFD, "status"), "%d %d %d %d %d\n", exitCode, signal,
+		usage.Utime.Nano()/1000, usage.Stime.Nano()/1000, usage.Maxrss)
+	os.Exit(0)
+}
+
+// buildSandboxRoot assembles the sandbox's root on a tmpfs and pivots into it
+func buildSandboxRoot(cfg sandboxConfig) error {
+	// Keep every mount below out of the server's mount namespace
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("error making mounts private: %w", err)
+	}
+
+	root := cfg.Root
+	if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755,size=1m"); err != nil {
+		return fmt.Errorf("error mounting sandbox root: %w", err)
+	}
+
+	for _, path := range cfg.ReadOnly {
+		if err := bindIntoRoot(root, path, path, unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV); err != nil {
+			return err
+		}
+	}
+	for _, device := range sandboxDevices {
+		if err := bindIntoRoot(root, "/dev/"+device, "/dev/"+device, unix.MS_NOSUID|unix.MS_NOEXEC); err != nil {
+			return err
+		}
+	}
+	for name, target := range map[string]string{
+		"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, "dev", name)); err != nil {
+			return fmt.Errorf("error creating /dev/%s: %w", name, err)
+		}
+	}
+
+	if err := bindIntoRoot(root, cfg.Helper, sandboxHelper, unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV); err != nil {
+		return err
+	}
+	if err := bindIntoRoot(root, cfg.Box, sandboxBoxDir, unix.MS_NOSUID|unix.MS_NODEV); err != nil {
+		return err
+	}
+	if cfg.GoCache != "" {
+		if err := os.MkdirAll(cfg.GoCache, 0777); err != nil {
+			return fmt.Errorf("error creating Go build cache: %w", err)
+		}
+		if err := os.Chmod(cfg.GoCache, 0777); err != nil {
+			return fmt.Errorf("error opening Go build cache to the sandbox: %w", err)
+		}
+		if err := bindIntoRoot(root, cfg.GoCache, sandboxGoCache, unix.MS_NOSUID|unix.MS_NODEV); err != nil {
+			return err
+		}
+	}
+
+	tmp := filepath.Join(root, "tmp")
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		return fmt.Errorf("error creating /tmp: %w", err)
+	}
+	tmpOptions := "mode=1777,size=" + strconv.FormatInt(max(cfg.TmpKB, 64), 10) + "k"
+	if err := unix.Mount("tmpfs", tmp, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, tmpOptions); err != nil {
+		return fmt.Errorf("error mounting /tmp: %w", err)
+	}
+
+	// Runtimes such as the JVM find themselves through /proc/self/exe. A new
+	// proc only shows the sandbox's processes, but container runtimes that
+	// mask parts of /proc forbid it; the existing one is bound instead.
+	proc := filepath.Join(root, "proc")
+	if err := os.Mkdir(proc, 0755); err != nil {
+		return fmt.Errorf("error creating /proc: %w", err)
+	}
+	if err := unix.Mount("proc", proc, "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		if err := bindMount("/proc", proc, unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC); err != nil {
+			return err
+		}
+	}
+
+	// The box's files were written by the server, the program owns them
+	if err := chownBox(cfg.Box); err != nil {
+		return err
+	}
+
+	oldRoot := filepath.Join(root, ".oldroot")
+	if err := os.Mkdir(oldRoot, 0700); err != nil {
+		return fmt.Errorf("error creating old root: %w", err)
+	}
+	if err := unix.PivotRoot(root, oldRoot); err != nil {
+		return fmt.Errorf("error pivoting to sandbox root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := unix.Unmount("/.oldroot", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("error detaching old root: %w", err)
+	}
+	if err := os.Remove("/.oldroot"); err != nil {
+		return fmt.Errorf("error removing old root: %w", err)
+	}
+	if err := unix.Mount("", "/", "", unix.MS_REMOUNT|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("error making sandbox root read-only: %w", err)
+	}
+	return nil
+}
+
+// bindIntoRoot binds the host path src to dst inside the root being built.
+// Symlinks, such as /lib pointing to usr/lib, are copied as they are.
+// Paths that don't exist on the host are skipped.
+func bindIntoRoot(root, src, dst string, flags uintptr) error {
+	info, err := os.Lstat(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", src, err)
+	}
+
+	target := filepath.Join(root, dst)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", dst, err)
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", src, err)
+		}
+		if err := os.Symlink(link, target); err != nil {
+			return fmt.Errorf("error creating %s: %w", dst, err)
+		}
+		return nil
+	case info.IsDir():
+		err = os.Mkdir(target, 0755)
+	default:
+		err = os.WriteFile(target, nil, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", dst, err)
+	}
+	return bindMount(src, target, flags)
+}
+
+// bindMount binds src to dst with the mount flags. Flags the original mount
+// already has, which a user namespace can't drop, are kept.
+func bindMount(src, dst string, flags uintptr) error {
+	if err := unix.Mount(src, dst, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("error binding %s: %w", src, err)
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(dst, &st); err != nil {
+		return fmt.Errorf("error reading mount flags of %s: %w", src, err)
+	}
+	// ST_* flags have the values of the matching MS_* flags
+	flags |= uintptr(st.Flags) & (unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+	if err := unix.Mount("", dst, "", unix.MS_BIND|unix.MS_REMOUNT|flags, ""); err != nil {
+		return fmt.Errorf("error restricting %s: %w", src, err)
+	}
+	return nil
+}
+
+// chownBox gives the box, and the files the server wrote into it, to
+// sandboxUID. Files the program created already belong to it.
+func chownBox(box string) error {
+	entries, err := os.ReadDir(box)
+	if err != nil {
+		return fmt.Errorf("error reading box: %w", err)
+	}
+	paths := []string{box}
+	for _, entry := range entries {
+		paths = append(paths, filepath.Join(box, entry.Name()))
+	}
+	for _, path := range paths {
+		var st unix.Stat_t
+		if err := unix.Lstat(path, &st); err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		if st.Uid != 0 {
+			continue
+		}
+		if err := os.Lchown(path, sandboxUID, sandboxUID); err != nil {
+			return fmt.Errorf("error handing %s to the sandbox: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// runSandboxCleanup removes a box. It runs as root of a user namespace that
+// maps the box's uid, so it may delete whatever the program left behind.
+func runSandboxCleanup(args []string) {
+	if len(args) != 1 {
+		sandboxFail("invalid arguments")
+	}
+	if err := os.RemoveAll(args[0]); err != nil {
+		sandboxFail(err.Error())
+	}
+	os.Exit(0)
+}
+
+func sandboxFail(message string) {
+	fmt.Fprintln(os.Stderr, "sandbox:", message)
+	os.Exit(127)
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"sync"
+)
+
+// BatchExecutor is implemented by executors that can run several programs in
+// one call, such as Judge0 with its batch submission endpoint. onResult must
+// be called with the index and result of each request as soon as that
+// request has finished, never concurrently. CanBatch reports whether the
+// endpoint is usable on this instance.
+type BatchExecutor interface {
+	Executor
+	CanBatch() bool
+	ExecuteBatch(reqs []ExecutionRequest, onResult func(i int, result ExecutionResult)) error
+}
+
+// Concurrency limits for running test cases. MaxConcurrentExecutions bounds
+// executions across the whole server, SubmissionConcurrency bounds the test
+// cases of a single submission that run at the same time.
+var (
+	MaxConcurrentExecutions = 16
+	SubmissionConcurrency   = 4
+
+	execSlots     chan struct{}
+	execSlotsOnce sync.Once
+)
+
+// configureConcurrency reads EXECUTOR_MAX_CONCURRENCY and EXECUTOR_SUBMISSION_CONCURRENCY
+func configureConcurrency() {
+	MaxConcurrentExecutions = int(envInt("EXECUTOR_MAX_CONCURRENCY", int64(MaxConcurrentExecutions)))
+	SubmissionConcurrency = int(envInt("EXECUTOR_SUBMISSION_CONCURRENCY", int64(SubmissionConcurrency)))
+}
+
+// acquireExecSlot blocks until a server-wide execution slot is free and
+// returns the function that releases it
+func acquireExecSlot() func() {
+	execSlotsOnce.Do(func() {
+		execSlots = make(chan struct{}, max(MaxConcurrentExecutions, 1))
+	})
+	execSlots <- struct{}{}
+	return func() { <-execSlots }
+}
+
+// executeLimited runs a single request while holding a server-wide slot
+func executeLimited(executor Executor, req ExecutionRequest) (ExecutionResult, error) {
+	release := acquireExecSlot()
+	defer release()
+	return executor.Execute(req)
+}
+
+// executeAll runs every request and calls onResult with the index and result
+// of each one as it finishes. Calls to onResult are never concurrent. It uses
+// the executor's batch endpoint when it has one, otherwise it runs at most
+// SubmissionConcurrency requests at a time. The first error is returned.
+func executeAll(executor Executor, reqs []ExecutionRequest, onResult func(i int, result ExecutionResult)) error {
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	if batch, ok := executor.(BatchExecutor); ok && batch.CanBatch() {
+		release := acquireExecSlot()
+		defer release()
+		return batch.ExecuteBatch(reqs, onResult)
+	}
+
+	var mu sync.Mutex
+	return forEachConcurrent(len(reqs), func(i int) error {
+		result, err := executeLimited(executor, reqs[i])
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		onResult(i, result)
+		return nil
+	})
+}
+
+// forEachConcurrent calls work for every index below n, at most
+// SubmissionConcurrency at a time. Once work fails no new calls are started
+// and the first error is returned.
+func forEachConcurrent(n int, work func(i int) error) error {
+	workers := min(max(SubmissionConcurrency, 1), n)
+	jobs := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				mu.Lock()
+				failed := firstErr != nil
+				mu.Unlock()
+				if failed {
+					continue
+				}
+
+				if err := work(i); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
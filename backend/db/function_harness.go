@@ -0,0 +1,563 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// functionLanguage generates the code for function questions in one language.
+// A harness reads one JSON value per line from stdin, one per parameter, calls
+// the student's function and prints the JSON of the result on a line of its own.
+type functionLanguage struct {
+	stub    func(fn *FunctionSignature) string
+	harness func(fn *FunctionSignature, code string) string
+}
+
+// functionLanguages maps language IDs to their generators. C has no
+// reasonable way to pass arrays without lengths, so it is not supported.
+var functionLanguages = map[int]functionLanguage{
+	71: {pythonStub, pythonHarness},
+	63: {javascriptStub, javascriptHarness},
+	62: {javaStub, javaHarness},
+	54: {cppStub, cppHarness},
+	60: {goStub, goHarness},
+}
+
+// Stubs returns the starting code of the function in every supported language
+func (fn *FunctionSignature) Stubs() map[int]string {
+	stubs := make(map[int]string, len(functionLanguages))
+	for id, lang := range functionLanguages {
+		stubs[id] = lang.stub(fn)
+	}
+	return stubs
+}
+
+// Harness wraps the student's function in a program that can be run against test cases
+func (fn *FunctionSignature) Harness(code string, languageID int) (string, error) {
+	lang, ok := functionLanguages[languageID]
+	if !ok {
+		return "", fmt.Errorf("language ID %d is not supported for function questions", languageID)
+	}
+	return lang.harness(fn, code), nil
+}
+
+// typeName spells a parameter type in a language, given the scalar names and
+// how to wrap an element type into an array
+func typeName(typ string, scalars map[string]string, array func(elem string) string) string {
+	base, dims, _ := splitType(typ)
+	name := scalars[base]
+	for i := 0; i < dims; i++ {
+		name = array(name)
+	}
+	return name
+}
+
+func paramList(fn *FunctionSignature, param func(p FunctionParam) string) string {
+	params := make([]string, len(fn.Params))
+	for i, p := range fn.Params {
+		params[i] = param(p)
+	}
+	return strings.Join(params, ", ")
+}
+
+func harnessArgNames(fn *FunctionSignature) string {
+	args := make([]string, len(fn.Params))
+	for i := range fn.Params {
+		args[i] = fmt.Sprintf("harnessArg%d", i)
+	}
+	return strings.Join(args, ", ")
+}
+
+// Python
+
+var pythonTypes = map[string]string{TypeInt: "int", TypeLong: "int", TypeFloat: "float", TypeBool: "bool", TypeString: "str"}
+
+func pythonType(typ string) string {
+	return typeName(typ, pythonTypes, func(elem string) string { return "List[" + elem + "]" })
+}
+
+func pythonStub(fn *FunctionSignature) string {
+	params := paramList(fn, func(p FunctionParam) string { return p.Name + ": " + pythonType(p.Type) })
+	return fmt.Sprintf("from typing import List\n\n\ndef %s(%s) -> %s:\n    pass\n", fn.Name, params, pythonType(fn.ReturnType))
+}
+
+func pythonHarness(fn *FunctionSignature, code string) string {
+	return `import json as _harness_json
+import sys as _harness_sys
+from typing import List
+
+` + code + `
+
+
+if __name__ == "__main__":
+    _harness_args = [_harness_json.loads(_harness_line) for _harness_line in _harness_sys.stdin.read().splitlines() if _harness_line.strip()]
+    _harness_result = ` + fn.Name + `(*_harness_args)
+    _harness_sys.stdout.write("\n" + _harness_json.dumps(_harness_result, ensure_ascii=False) + "\n")
+`
+}
+
+// JavaScript
+
+var javascriptTypes = map[string]string{TypeInt: "number", TypeLong: "number", TypeFloat: "number", TypeBool: "boolean", TypeString: "string"}
+
+func javascriptType(typ string) string {
+	return typeName(typ, javascriptTypes, func(elem string) string { return elem + "[]" })
+}
+
+func javascriptStub(fn *FunctionSignature) string {
+	var b strings.Builder
+	b.WriteString("/**\n")
+	for _, p := range fn.Params {
+		fmt.Fprintf(&b, " * @param {%s} %s\n", javascriptType(p.Type), p.Name)
+	}
+	fmt.Fprintf(&b, " * @return {%s}\n */\n", javascriptType(fn.ReturnType))
+	fmt.Fprintf(&b, "function %s(%s) {\n    \n}\n", fn.Name, paramList(fn, func(p FunctionParam) string { return p.Name }))
+	return b.String()
+}
+
+func javascriptHarness(fn *FunctionSignature, code string) string {
+	return code + `
+
+(() => {
+    const args = require("fs").readFileSync(0, "utf8").split("\n")
+        .filter((line) => line.trim() !== "")
+        .map((line) => JSON.parse(line));
+    process.stdout.write("\n" + JSON.stringify(` + fn.Name + `(...args)) + "\n");
+})();
+`
+}
+
+// Java
+
+var javaTypes = map[string]string{TypeInt: "int", TypeLong: "long", TypeFloat: "double", TypeBool: "boolean", TypeString: "String"}
+
+func javaType(typ string) string {
+	return typeName(typ, javaTypes, func(elem string) string { return elem + "[]" })
+}
+
+func javaStub(fn *FunctionSignature) string {
+	params := paramList(fn, func(p FunctionParam) string { return javaType(p.Type) + " " + p.Name })
+	return fmt.Sprintf("import java.util.*;\n\nclass Solution {\n    public %s %s(%s) {\n        \n    }\n}\n",
+		javaType(fn.ReturnType), fn.Name, params)
+}
+
+// javaConverter returns the name of the method that converts a parsed JSON
+// value to typ, adding it and the converters it needs to methods
+func javaConverter(typ string, methods map[string]string) string {
+	base, dims, _ := splitType(typ)
+	name := fmt.Sprintf("to_%s_%d", base, dims)
+	if _, ok := methods[name]; ok {
+		return name
+	}
+
+	var body string
+	if dims == 0 {
+		body = map[string]string{
+			TypeInt:    "return ((Number) o).intValue();",
+			TypeLong:   "return ((Number) o).longValue();",
+			TypeFloat:  "return ((Number) o).doubleValue();",
+			TypeBool:   "return (Boolean) o;",
+			TypeString: "return (String) o;",
+		}[base]
+	} else {
+		elem := strings.TrimSuffix(typ, "[]")
+		body = fmt.Sprintf("List<?> l = (List<?>) o;\n        %s r = new %s[l.size()]%s;\n"+
+			"        for (int i = 0; i < r.length; i++) r[i] = %s(l.get(i));\n        return r;",
+			javaType(typ), javaTypes[base], strings.Repeat("[]", dims-1), javaConverter(elem, methods))
+	}
+	methods[name] = fmt.Sprintf("    static %s %s(Object o) {\n        %s\n    }\n", javaType(typ), name, body)
+	return name
+}
+
+func javaHarness(fn *FunctionSignature, code string) string {
+	methods := map[string]string{}
+	var calls strings.Builder
+	for i, p := range fn.Params {
+		fmt.Fprintf(&calls, "        %s harnessArg%d = %s(values.get(%d));\n", javaType(p.Type), i, javaConverter(p.Type, methods), i)
+	}
+
+	var converters strings.Builder
+	for _, method := range sortedValues(methods) {
+		converters.WriteString("\n" + method)
+	}
+
+	return `import java.io.*;
+import java.util.*;
+` + code + `
+
+public class Main {
+    public static void main(String[] args) throws Exception {
+        BufferedReader in = new BufferedReader(new InputStreamReader(System.in, "UTF-8"));
+        List<Object> values = new ArrayList<>();
+        for (String line; (line = in.readLine()) != null; ) {
+            if (!line.trim().isEmpty()) values.add(new HarnessJson(line).parse());
+        }
+` + calls.String() + `        ` + javaType(fn.ReturnType) + ` result = new Solution().` + fn.Name + `(` + harnessArgNames(fn) + `);
+        StringBuilder out = new StringBuilder("\n");
+        HarnessJson.write(out, result);
+        PrintStream stdout = new PrintStream(new FileOutputStream(FileDescriptor.out), true, "UTF-8");
+        stdout.print(out.append('\n'));
+        stdout.flush();
+    }
+` + converters.String() + `}
+
+class HarnessJson {
+    private final String s;
+    private int i;
+
+    HarnessJson(String s) {
+        this.s = s;
+    }
+
+    Object parse() {
+        skip();
+        char c = s.charAt(i);
+        if (c == '[') {
+            i++;
+            List<Object> list = new ArrayList<>();
+            skip();
+            if (s.charAt(i) == ']') {
+                i++;
+                return list;
+            }
+            while (true) {
+                list.add(parse());
+                skip();
+                if (s.charAt(i++) == ']') return list;
+            }
+        }
+        if (c == '"') return string();
+        if (s.startsWith("true", i)) { i += 4; return Boolean.TRUE; }
+        if (s.startsWith("false", i)) { i += 5; return Boolean.FALSE; }
+        if (s.startsWith("null", i)) { i += 4; return null; }
+        int start = i;
+        while (i < s.length() && "+-0123456789.eE".indexOf(s.charAt(i)) >= 0) i++;
+        String number = s.substring(start, i);
+        if (number.contains(".") || number.contains("e") || number.contains("E")) return Double.parseDouble(number);
+        return Long.parseLong(number);
+    }
+
+    private void skip() {
+        while (i < s.length() && Character.isWhitespace(s.charAt(i))) i++;
+    }
+
+    private String string() {
+        StringBuilder b = new StringBuilder();
+        i++;
+        while (true) {
+            char c = s.charAt(i++);
+            if (c == '"') return b.toString();
+            if (c != '\\') {
+                b.append(c);
+                continue;
+            }
+            char e = s.charAt(i++);
+            switch (e) {
+                case 'n': b.append('\n'); break;
+                case 't': b.append('\t'); break;
+                case 'r': b.append('\r'); break;
+                case 'b': b.append('\b'); break;
+                case 'f': b.append('\f'); break;
+                case 'u': b.append((char) Integer.parseInt(s.substring(i, i + 4), 16)); i += 4; break;
+                default: b.append(e);
+            }
+        }
+    }
+
+    static void write(StringBuilder b, Object v) {
+        if (v == null) {
+            b.append("null");
+        } else if (v instanceof String) {
+            b.append('"');
+            for (char c : ((String) v).toCharArray()) {
+                if (c == '"' || c == '\\') b.append('\\').append(c);
+                else if (c < 0x20) b.append(String.format("\\u%04x", (int) c));
+                else b.append(c);
+            }
+            b.append('"');
+        } else if (v instanceof int[]) {
+            int[] a = (int[]) v;
+            b.append('[');
+            for (int j = 0; j < a.length; j++) b.append(j > 0 ? "," : "").append(a[j]);
+            b.append(']');
+        } else if (v instanceof long[]) {
+            long[] a = (long[]) v;
+            b.append('[');
+            for (int j = 0; j < a.length; j++) b.append(j > 0 ? "," : "").append(a[j]);
+            b.append(']');
+        } else if (v instanceof double[]) {
+            double[] a = (double[]) v;
+            b.append('[');
+            for (int j = 0; j < a.length; j++) b.append(j > 0 ? "," : "").append(a[j]);
+            b.append(']');
+        } else if (v instanceof boolean[]) {
+            boolean[] a = (boolean[]) v;
+            b.append('[');
+            for (int j = 0; j < a.length; j++) b.append(j > 0 ? "," : "").append(a[j]);
+            b.append(']');
+        } else if (v instanceof Object[]) {
+            Object[] a = (Object[]) v;
+            b.append('[');
+            for (int j = 0; j < a.length; j++) {
+                if (j > 0) b.append(',');
+                write(b, a[j]);
+            }
+            b.append(']');
+        } else {
+            b.append(v);
+        }
+    }
+}
+`
+}
+
+// C++
+
+var cppTypes = map[string]string{TypeInt: "int", TypeLong: "long long", TypeFloat: "double", TypeBool: "bool", TypeString: "string"}
+
+func cppType(typ string) string {
+	return typeName(typ, cppTypes, func(elem string) string { return "vector<" + elem + ">" })
+}
+
+func cppStub(fn *FunctionSignature) string {
+	params := paramList(fn, func(p FunctionParam) string { return cppType(p.Type) + " " + p.Name })
+	return fmt.Sprintf("#include <bits/stdc++.h>\nusing namespace std;\n\n%s %s(%s) {\n    \n}\n", cppType(fn.ReturnType), fn.Name, params)
+}
+
+func cppHarness(fn *FunctionSignature, code string) string {
+	var calls strings.Builder
+	for i, p := range fn.Params {
+		fmt.Fprintf(&calls, "    %s harnessArg%d = harness::Conv<%s>::from(args.at(%d));\n", cppType(p.Type), i, cppType(p.Type), i)
+	}
+
+	return `#include <bits/stdc++.h>
+using namespace std;
+` + code + `
+
+namespace harness {
+
+struct Value {
+    char kind = 'z';  // n(umber), s(tring), b(ool), a(rray) or z for null
+    std::string text; // number text, string contents or "true"/"false"
+    std::vector<Value> items;
+};
+
+struct Parser {
+    const std::string& s;
+    size_t i = 0;
+
+    void skip() {
+        while (i < s.size() && isspace((unsigned char) s[i])) i++;
+    }
+
+    static void utf8(std::string& out, unsigned cp) {
+        if (cp < 0x80) {
+            out += (char) cp;
+        } else if (cp < 0x800) {
+            out += (char) (0xC0 | (cp >> 6));
+            out += (char) (0x80 | (cp & 0x3F));
+        } else if (cp < 0x10000) {
+            out += (char) (0xE0 | (cp >> 12));
+            out += (char) (0x80 | ((cp >> 6) & 0x3F));
+            out += (char) (0x80 | (cp & 0x3F));
+        } else {
+            out += (char) (0xF0 | (cp >> 18));
+            out += (char) (0x80 | ((cp >> 12) & 0x3F));
+            out += (char) (0x80 | ((cp >> 6) & 0x3F));
+            out += (char) (0x80 | (cp & 0x3F));
+        }
+    }
+
+    Value parse() {
+        skip();
+        Value v;
+        char c = s.at(i);
+        if (c == '[') {
+            v.kind = 'a';
+            i++;
+            skip();
+            if (s.at(i) == ']') {
+                i++;
+                return v;
+            }
+            while (true) {
+                v.items.push_back(parse());
+                skip();
+                if (s.at(i++) == ']') return v;
+            }
+        }
+        if (c == '"') {
+            v.kind = 's';
+            i++;
+            while (true) {
+                char ch = s.at(i++);
+                if (ch == '"') return v;
+                if (ch != '\\') {
+                    v.text += ch;
+                    continue;
+                }
+                char e = s.at(i++);
+                switch (e) {
+                    case 'n': v.text += '\n'; break;
+                    case 't': v.text += '\t'; break;
+                    case 'r': v.text += '\r'; break;
+                    case 'b': v.text += '\b'; break;
+                    case 'f': v.text += '\f'; break;
+                    case 'u': {
+                        unsigned cp = std::stoul(s.substr(i, 4), nullptr, 16);
+                        i += 4;
+                        if (cp >= 0xD800 && cp < 0xDC00 && s.compare(i, 2, "\\u") == 0) {
+                            unsigned low = std::stoul(s.substr(i + 2, 4), nullptr, 16);
+                            cp = 0x10000 + ((cp - 0xD800) << 10) + (low - 0xDC00);
+                            i += 6;
+                        }
+                        utf8(v.text, cp);
+                        break;
+                    }
+                    default: v.text += e;
+                }
+            }
+        }
+        if (s.compare(i, 4, "true") == 0) { i += 4; v.kind = 'b'; v.text = "true"; return v; }
+        if (s.compare(i, 5, "false") == 0) { i += 5; v.kind = 'b'; v.text = "false"; return v; }
+        if (s.compare(i, 4, "null") == 0) { i += 4; return v; }
+        size_t start = i;
+        while (i < s.size() && std::string("+-0123456789.eE").find(s[i]) != std::string::npos) i++;
+        v.kind = 'n';
+        v.text = s.substr(start, i - start);
+        return v;
+    }
+};
+
+template <class T> struct Conv;
+template <> struct Conv<int> { static int from(const Value& v) { return (int) std::stoll(v.text); } };
+template <> struct Conv<long long> { static long long from(const Value& v) { return std::stoll(v.text); } };
+template <> struct Conv<double> { static double from(const Value& v) { return std::stod(v.text); } };
+template <> struct Conv<bool> { static bool from(const Value& v) { return v.text == "true"; } };
+template <> struct Conv<std::string> { static std::string from(const Value& v) { return v.text; } };
+template <class T> struct Conv<std::vector<T>> {
+    static std::vector<T> from(const Value& v) {
+        std::vector<T> r;
+        for (const Value& item : v.items) r.push_back(Conv<T>::from(item));
+        return r;
+    }
+};
+
+void write(std::ostream& o, int v) { o << v; }
+void write(std::ostream& o, long long v) { o << v; }
+void write(std::ostream& o, double v) { o << std::setprecision(17) << v; }
+void write(std::ostream& o, bool v) { o << (v ? "true" : "false"); }
+void write(std::ostream& o, const std::string& v) {
+    o << '"';
+    for (char c : v) {
+        if (c == '"' || c == '\\') o << '\\' << c;
+        else if ((unsigned char) c < 0x20) o << "\\u" << std::hex << std::setw(4) << std::setfill('0') << (int) c << std::dec;
+        else o << c;
+    }
+    o << '"';
+}
+template <class T> void write(std::ostream& o, const std::vector<T>& v) {
+    o << '[';
+    bool first = true;
+    for (auto item : v) {
+        if (!first) o << ',';
+        first = false;
+        write(o, static_cast<T>(item));
+    }
+    o << ']';
+}
+
+}  // namespace harness
+
+int main() {
+    std::vector<harness::Value> args;
+    std::string line;
+    while (std::getline(std::cin, line)) {
+        if (line.find_first_not_of(" \t\r") == std::string::npos) continue;
+        harness::Parser parser{line};
+        args.push_back(parser.parse());
+    }
+` + calls.String() + `    ` + cppType(fn.ReturnType) + ` harnessResult = ` + fn.Name + `(` + harnessArgNames(fn) + `);
+    std::cout << '\n';
+    harness::write(std::cout, harnessResult);
+    std::cout << std::endl;
+    return 0;
+}
+`
+}
+
+// Go
+
+var goTypes = map[string]string{TypeInt: "int", TypeLong: "int64", TypeFloat: "float64", TypeBool: "bool", TypeString: "string"}
+
+func goType(typ string) string {
+	return typeName(typ, goTypes, func(elem string) string { return "[]" + elem })
+}
+
+func goStub(fn *FunctionSignature) string {
+	params := paramList(fn, func(p FunctionParam) string { return p.Name + " " + goType(p.Type) })
+	return fmt.Sprintf("func %s(%s) %s {\n\t\n}\n", fn.Name, params, goType(fn.ReturnType))
+}
+
+func goHarness(fn *FunctionSignature, code string) string {
+	// The harness provides the package clause, the student's imports follow its own
+	trimmed := strings.TrimSpace(code)
+	if strings.HasPrefix(trimmed, "package ") {
+		_, code, _ = strings.Cut(trimmed, "\n")
+	}
+
+	var calls strings.Builder
+	for i, p := range fn.Params {
+		fmt.Fprintf(&calls, "\tvar harnessArg%d %s\n\tharnessDecode(harnessArgs, %d, &harnessArg%d)\n", i, goType(p.Type), i, i)
+	}
+
+	return `package main
+
+import (
+	harnessbufio "bufio"
+	harnessjson "encoding/json"
+	harnessos "os"
+	harnessstrings "strings"
+)
+` + code + `
+
+func main() {
+	var harnessArgs []string
+	harnessScanner := harnessbufio.NewScanner(harnessos.Stdin)
+	harnessScanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for harnessScanner.Scan() {
+		if line := harnessstrings.TrimSpace(harnessScanner.Text()); line != "" {
+			harnessArgs = append(harnessArgs, line)
+		}
+	}
+` + calls.String() + `	harnessResult, err := harnessjson.Marshal(` + fn.Name + `(` + harnessArgNames(fn) + `))
+	if err != nil {
+		harnessos.Stderr.WriteString("harness: " + err.Error() + "\n")
+		harnessos.Exit(2)
+	}
+	harnessos.Stdout.WriteString("\n" + string(harnessResult) + "\n")
+}
+
+func harnessDecode(args []string, i int, v any) {
+	if i >= len(args) || harnessjson.Unmarshal([]byte(args[i]), v) != nil {
+		harnessos.Stderr.WriteString("harness: invalid argument\n")
+		harnessos.Exit(2)
+	}
+}
+`
+}
+
+// sortedValues returns the values of a map ordered by key, so generated code is stable
+func sortedValues(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = m[k]
+	}
+	return values
+}
@@ -0,0 +1,311 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Scalar types of function parameters and return values. Any of them can be
+// made an array by appending "[]", up to maxTypeDimensions times.
+const (
+	TypeInt    = "int"    // 32-bit integer
+	TypeLong   = "long"   // 64-bit integer
+	TypeFloat  = "float"  // 64-bit floating point
+	TypeBool   = "bool"   // true or false
+	TypeString = "string" // UTF-8 text
+)
+
+const maxTypeDimensions = 3
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedIdentifiers can't be used as function or parameter names because
+// they are keywords or common builtins in one of the harness languages
+var reservedIdentifiers = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`
+		and as assert async await break case catch char class const continue def default del delete do
+		double elif else enum export extends false final finally float for from func function go goto
+		if import in instanceof int interface is lambda let long main map new nil none nonlocal not
+		null or package pass print private protected public raise range return select short signed
+		sizeof static std string struct super switch this throw true try type typeof union unsigned
+		using var void volatile while with yield`) {
+		reservedIdentifiers[word] = true
+	}
+}
+
+// FunctionParam is one typed parameter of a function question
+type FunctionParam struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// FunctionSignature declares the function students implement in a function
+// question. Every test case input has one line per parameter with its value
+// as JSON, and the expected output is the JSON of the return value.
+type FunctionSignature struct {
+	Name       string          `json:"name"`
+	Params     []FunctionParam `json:"params"`
+	ReturnType string          `json:"return_type"`
+}
+
+// Validate checks the names and types of the signature
+func (fn *FunctionSignature) Validate() error {
+	if err := validIdentifier(fn.Name); err != nil {
+		return fmt.Errorf("function name: %w", err)
+	}
+	seen := map[string]bool{}
+	for i, p := range fn.Params {
+		if err := validIdentifier(p.Name); err != nil {
+			return fmt.Errorf("parameter %d: %w", i+1, err)
+		}
+		if seen[p.Name] || p.Name == fn.Name {
+			return fmt.Errorf("parameter %d: duplicate name %q", i+1, p.Name)
+		}
+		seen[p.Name] = true
+		if _, _, err := splitType(p.Type); err != nil {
+			return fmt.Errorf("parameter %q: %w", p.Name, err)
+		}
+	}
+	if _, _, err := splitType(fn.ReturnType); err != nil {
+		return fmt.Errorf("return type: %w", err)
+	}
+	return nil
+}
+
+func validIdentifier(name string) error {
+	if !identifierPattern.MatchString(name) {
+		return fmt.Errorf("%q is not a valid identifier", name)
+	}
+	if reservedIdentifiers[strings.ToLower(name)] || strings.HasPrefix(strings.ToLower(name), "harness") {
+		return fmt.Errorf("%q is a reserved name", name)
+	}
+	return nil
+}
+
+// splitType splits a type such as "int[][]" into its scalar type and number of dimensions
+func splitType(typ string) (string, int, error) {
+	base := typ
+	dims := 0
+	for strings.HasSuffix(base, "[]") {
+		base = strings.TrimSuffix(base, "[]")
+		dims++
+	}
+	switch base {
+	case TypeInt, TypeLong, TypeFloat, TypeBool, TypeString:
+	default:
+		return "", 0, fmt.Errorf("unknown type %q", typ)
+	}
+	if dims > maxTypeDimensions {
+		return "", 0, fmt.Errorf("type %q has more than %d dimensions", typ, maxTypeDimensions)
+	}
+	return base, dims, nil
+}
+
+// CanonicalTestCase checks a test case against the signature and returns its
+// input and expected output in canonical JSON, which is what gets stored
+func (fn *FunctionSignature) CanonicalTestCase(input, expectedOutput string) (string, string, error) {
+	input, err := fn.CanonicalInput(input)
+	if err != nil {
+		return "", "", err
+	}
+
+	expected, err := canonicalJSON(fn.ReturnType, expectedOutput)
+	if err != nil {
+		return "", "", fmt.Errorf("expected output: %w", err)
+	}
+	return input, expected, nil
+}
+
+// CanonicalInput checks a test case input against the signature and returns
+// it in canonical JSON
+func (fn *FunctionSignature) CanonicalInput(input string) (string, error) {
+	lines := nonEmptyLines(input)
+	if len(lines) != len(fn.Params) {
+		return "", fmt.Errorf("input has %d lines but the function takes %d parameters", len(lines), len(fn.Params))
+	}
+	for i, p := range fn.Params {
+		canonical, err := canonicalJSON(p.Type, lines[i])
+		if err != nil {
+			return "", fmt.Errorf("parameter %q: %w", p.Name, err)
+		}
+		lines[i] = canonical
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// returnValue extracts the return value printed by a harness. The harness
+// prints it on the last line, so earlier lines may be the student's own
+// output. ok is false when the value is missing or has the wrong type.
+func (fn *FunctionSignature) returnValue(stdout string) (string, bool) {
+	lines := nonEmptyLines(stdout)
+	if len(lines) == 0 {
+		return "", false
+	}
+	canonical, err := canonicalJSON(fn.ReturnType, lines[len(lines)-1])
+	if err != nil {
+		return strings.TrimSpace(stdout), false
+	}
+	return canonical, true
+}
+
+// match compares two canonical return values. Float comparators compare
+// every number with their tolerance, other comparators see the JSON text.
+func (fn *FunctionSignature) match(c Comparator, actual, expected string) bool {
+	if c.Type != ComparatorFloatAbs && c.Type != ComparatorFloatRel {
+		return c.Match(actual, expected)
+	}
+
+	got, errGot := parseTyped(fn.ReturnType, actual)
+	want, errWant := parseTyped(fn.ReturnType, expected)
+	if errGot != nil || errWant != nil {
+		return false
+	}
+	return c.matchValues(got, want)
+}
+
+// matchValues compares two values of the same type, numbers within the tolerance
+func (c Comparator) matchValues(got, want any) bool {
+	switch want := want.(type) {
+	case []any:
+		got := got.([]any)
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range want {
+			if !c.matchValues(got[i], want[i]) {
+				return false
+			}
+		}
+		return true
+	case float64:
+		return c.floatsMatch(got.(float64), want)
+	}
+	return got == want
+}
+
+func nonEmptyLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// canonicalJSON re-encodes a JSON value of the given type in one fixed form,
+// so that outputs of different languages can be compared as text
+func canonicalJSON(typ, text string) (string, error) {
+	value, err := parseTyped(typ, text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// parseTyped decodes a single JSON value and checks it against the type.
+// Integers become int64, floats float64 and arrays []any.
+func parseTyped(typ, text string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var raw any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if dec.More() {
+		return nil, errors.New("expected a single JSON value")
+	}
+
+	base, dims, err := splitType(typ)
+	if err != nil {
+		return nil, err
+	}
+	return conformValue(base, dims, raw)
+}
+
+func conformValue(base string, dims int, raw any) (any, error) {
+	if dims > 0 {
+		items, ok := raw.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected an array of %s", base+strings.Repeat("[]", dims-1))
+		}
+		values := make([]any, len(items))
+		for i, item := range items {
+			value, err := conformValue(base, dims-1, item)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+
+	switch base {
+	case TypeInt, TypeLong:
+		n, ok := raw.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("expected %s", base)
+		}
+		bits := 64
+		if base == TypeInt {
+			bits = 32
+		}
+		v, err := strconv.ParseInt(n.String(), 10, bits)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid %s", n, base)
+		}
+		return v, nil
+	case TypeFloat:
+		n, ok := raw.(json.Number)
+		if !ok {
+			return nil, errors.New("expected a number")
+		}
+		v, err := n.Float64()
+		if err != nil || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%s is not a valid float", n)
+		}
+		return v, nil
+	case TypeBool:
+		v, ok := raw.(bool)
+		if !ok {
+			return nil, errors.New("expected true or false")
+		}
+		return v, nil
+	case TypeString:
+		v, ok := raw.(string)
+		if !ok {
+			return nil, errors.New("expected a string")
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", base)
+}
+
+// decodeFunctionSignature reads the signature stored on a question, nil for
+// questions that are not function questions
+func decodeFunctionSignature(stored sql.NullString) (*FunctionSignature, error) {
+	if !stored.Valid || stored.String == "" {
+		return nil, nil
+	}
+	var fn FunctionSignature
+	if err := json.Unmarshal([]byte(stored.String), &fn); err != nil {
+		return nil, fmt.Errorf("error decoding function signature: %w", err)
+	}
+	return &fn, nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Scoring policies for questions that allow several graded submissions
+const (
+	ScoringBest    = "best"    // the best score of any graded submission
+	ScoringLast    = "last"    // the score of the latest graded submission
+	ScoringPenalty = "penalty" // the best score after deducting Penalty per earlier wrong submission
+)
+
+// GradingPolicy decides how many graded submissions a student gets on a
+// question and how their scores combine. The attempt closes once a
+// submission is fully correct or MaxSubmissions have been graded.
+type GradingPolicy struct {
+	Scoring        string `json:"scoring"`         // ScoringBest when empty
+	MaxSubmissions int    `json:"max_submissions"` // 1 when zero
+	Penalty        int    `json:"penalty"`         // Percentage points, ScoringPenalty only
+}
+
+// Normalize fills in the defaults of an unset policy
+func (p GradingPolicy) Normalize() GradingPolicy {
+	if p.Scoring == "" {
+		p.Scoring = ScoringBest
+	}
+	if p.MaxSubmissions == 0 {
+		p.MaxSubmissions = 1
+	}
+	return p
+}
+
+// Validate checks a policy after Normalize
+func (p GradingPolicy) Validate() error {
+	switch p.Scoring {
+	case ScoringBest, ScoringLast:
+		if p.Penalty != 0 {
+			return fmt.Errorf("a penalty needs the %q scoring policy", ScoringPenalty)
+		}
+	case ScoringPenalty:
+		if p.Penalty <= 0 || p.Penalty > 100 {
+			return errors.New("penalty must be between 1 and 100 percentage points")
+		}
+	default:
+		return fmt.Errorf("unknown scoring policy %q", p.Scoring)
+	}
+	if p.MaxSubmissions < 1 || p.MaxSubmissions > 100 {
+		return errors.New("max_submissions must be between 1 and 100")
+	}
+	return nil
+}
+
+// attemptProgress is the graded state of an attempt before a new submission
+type attemptProgress struct {
+	Score     int // Score under the policy so far
+	Graded    int // Graded submissions so far
+	Wrong     int // Graded submissions that were not fully correct
+	Attempted bool
+}
+
+// apply adds a graded submission with the given score to the progress,
+// closing the attempt when no further submissions are allowed
+func (p GradingPolicy) apply(progress attemptProgress, score int, correct bool) attemptProgress {
+	first := progress.Graded == 0
+	switch p.Scoring {
+	case ScoringLast:
+		progress.Score = score
+	case ScoringPenalty:
+		score = max(0, score-p.Penalty*progress.Wrong)
+		fallthrough
+	default:
+		if first || score > progress.Score {
+			progress.Score = score
+		}
+	}
+
+	progress.Graded++
+	if !correct {
+		progress.Wrong++
+	}
+	progress.Attempted = correct || progress.Graded >= p.MaxSubmissions
+	return progress
+}
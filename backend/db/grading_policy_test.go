@@ -0,0 +1,140 @@
+package db
+
+import "testing"
+
+func TestGradingPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  GradingPolicy
+		wantErr bool
+	}{
+		{"defaults", GradingPolicy{}, false},
+		{"best of five", GradingPolicy{Scoring: ScoringBest, MaxSubmissions: 5}, false},
+		{"last", GradingPolicy{Scoring: ScoringLast, MaxSubmissions: 3}, false},
+		{"penalty", GradingPolicy{Scoring: ScoringPenalty, MaxSubmissions: 3, Penalty: 10}, false},
+		{"penalty without amount", GradingPolicy{Scoring: ScoringPenalty, MaxSubmissions: 3}, true},
+		{"penalty above 100", GradingPolicy{Scoring: ScoringPenalty, MaxSubmissions: 3, Penalty: 101}, true},
+		{"penalty on best", GradingPolicy{Scoring: ScoringBest, Penalty: 10}, true},
+		{"unknown scoring", GradingPolicy{Scoring: "average"}, true},
+		{"negative submissions", GradingPolicy{MaxSubmissions: -1}, true},
+		{"too many submissions", GradingPolicy{MaxSubmissions: 101}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Normalize().Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%+v) error = %v, want error %v", tt.policy, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGradingPolicyNormalize(t *testing.T) {
+	got := GradingPolicy{}.Normalize()
+	if got.Scoring != ScoringBest || got.MaxSubmissions != 1 {
+		t.Errorf("Normalize() = %+v, want best of one", got)
+	}
+
+	got = GradingPolicy{Scoring: ScoringLast, MaxSubmissions: 4}.Normalize()
+	if got.Scoring != ScoringLast || got.MaxSubmissions != 4 {
+		t.Errorf("Normalize() changed a set policy: %+v", got)
+	}
+}
+
+// submission is one graded submission fed to GradingPolicy.apply
+type submission struct {
+	score   int
+	correct bool
+}
+
+func TestGradingPolicyApply(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        GradingPolicy
+		submissions   []submission
+		wantScore     int
+		wantAttempted bool
+	}{
+		{
+			name:          "single submission closes the attempt",
+			policy:        GradingPolicy{},
+			submissions:   []submission{{40, false}},
+			wantScore:     40,
+			wantAttempted: true,
+		},
+		{
+			name:          "best keeps the highest score",
+			policy:        GradingPolicy{Scoring: ScoringBest, MaxSubmissions: 3},
+			submissions:   []submission{{60, false}, {20, false}},
+			wantScore:     60,
+			wantAttempted: false,
+		},
+		{
+			name:          "best closes on a correct submission",
+			policy:        GradingPolicy{Scoring: ScoringBest, MaxSubmissions: 3},
+			submissions:   []submission{{60, false}, {100, true}},
+			wantScore:     100,
+			wantAttempted: true,
+		},
+		{
+			name:          "best closes at the maximum",
+			policy:        GradingPolicy{Scoring: ScoringBest, MaxSubmissions: 2},
+			submissions:   []submission{{60, false}, {20, false}},
+			wantScore:     60,
+			wantAttempted: true,
+		},
+		{
+			name:          "first score counts even when zero",
+			policy:        GradingPolicy{Scoring: ScoringBest, MaxSubmissions: 3},
+			submissions:   []submission{{0, false}},
+			wantScore:     0,
+			wantAttempted: false,
+		},
+		{
+			name:          "last takes the latest score",
+			policy:        GradingPolicy{Scoring: ScoringLast, MaxSubmissions: 3},
+			submissions:   []submission{{80, false}, {30, false}},
+			wantScore:     30,
+			wantAttempted: false,
+		},
+		{
+			name:          "penalty per earlier wrong submission",
+			policy:        GradingPolicy{Scoring: ScoringPenalty, MaxSubmissions: 5, Penalty: 10},
+			submissions:   []submission{{50, false}, {70, false}, {100, true}},
+			wantScore:     80,
+			wantAttempted: true,
+		},
+		{
+			name:          "penalty keeps an earlier better score",
+			policy:        GradingPolicy{Scoring: ScoringPenalty, MaxSubmissions: 5, Penalty: 30},
+			submissions:   []submission{{90, false}, {100, true}},
+			wantScore:     90,
+			wantAttempted: true,
+		},
+		{
+			name:          "penalty never goes below zero",
+			policy:        GradingPolicy{Scoring: ScoringPenalty, MaxSubmissions: 5, Penalty: 50},
+			submissions:   []submission{{0, false}, {0, false}, {0, false}, {40, false}},
+			wantScore:     0,
+			wantAttempted: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy.Normalize()
+			var progress attemptProgress
+			for _, s := range tt.submissions {
+				progress = policy.apply(progress, s.score, s.correct)
+			}
+
+			if progress.Score != tt.wantScore || progress.Attempted != tt.wantAttempted {
+				t.Errorf("got score %d attempted %v, want %d attempted %v", progress.Score, progress.Attempted, tt.wantScore, tt.wantAttempted)
+			}
+			if progress.Graded != len(tt.submissions) {
+				t.Errorf("graded = %d, want %d", progress.Graded, len(tt.submissions))
+			}
+		})
+	}
+}
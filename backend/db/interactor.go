@@ -0,0 +1,94 @@
+package db
+
+import (
+	"errors"
+	"strings"
+)
+
+// Files the interactor finds in its working directory
+const (
+	interactorInputFile  = "input.txt"
+	interactorAnswerFile = "answer.txt"
+)
+
+// Interactor is a teacher-supplied program that talks to the submission of an
+// interactive question: its stdout is the submission's stdin and the other way
+// round. It reads the test case's input from input.txt and its expected output
+// from answer.txt. Once done it prints the verdict on stderr in the same form
+// as a Checker: "accept", "reject" or "partial <fraction>", then a message.
+type Interactor struct {
+	Code       string `json:"code"`
+	LanguageID int    `json:"language_id"`
+}
+
+// Validate checks that the interactor can be run
+func (in *Interactor) Validate() error {
+	if strings.TrimSpace(in.Code) == "" {
+		return errors.New("interactor code is required")
+	}
+	if in.LanguageID <= 0 {
+		return errors.New("interactor language_id is required")
+	}
+	return nil
+}
+
+// request builds the interactor run for one test case
+func (in *Interactor) request(tc evalTestCase) ExecutionRequest {
+	return ExecutionRequest{
+		SourceCode: in.Code,
+		LanguageID: in.LanguageID,
+		Files: map[string]string{
+			interactorInputFile:  tc.Input,
+			interactorAnswerFile: tc.ExpectedOutput,
+		},
+	}
+}
+
+// runInteractive runs the submission against the interactor of one test case
+func runInteractive(executor Executor, code string, languageID int, tc evalTestCase) (TestResult, error) {
+	interactive, ok := executor.(InteractiveExecutor)
+	if !ok {
+		return TestResult{}, errors.New("interactive questions are not supported by this code executor")
+	}
+
+	release := acquireExecSlot()
+	run, err := interactive.ExecuteInteractive(tc.request(code, languageID), tc.Interactor.request(tc))
+	release()
+	if err != nil {
+		return TestResult{}, err
+	}
+	return gradeInteractive(run, tc), nil
+}
+
+// gradeInteractive turns the outcome of an interactive run into a test result
+func gradeInteractive(run InteractiveResult, tc evalTestCase) TestResult {
+	solution, interactor := run.Solution, run.Interactor
+
+	// A crashed or timed out solution usually makes the interactor reject it
+	// on EOF, so the solution's own failure is the more useful verdict
+	if solution.StatusID != StatusAccepted {
+		testResult := gradeTestCase(solution, tc)
+		testResult.ActualOutput = "" // its stdout went to the interactor
+		return testResult
+	}
+
+	testResult := TestResult{
+		Status:   "FAIL",
+		IsHidden: tc.IsHidden,
+		Time:     solution.Time,
+		Memory:   solution.MemoryKB,
+	}
+	if !tc.IsHidden {
+		testResult.Input = tc.Input
+	}
+
+	if interactor.StatusID != StatusAccepted {
+		return checkerFailed(testResult, "Interactor failed", firstNonEmpty(interactor.CompileOutput, interactor.Stderr,
+			interactor.Message, interactor.StatusDescription))
+	}
+	credit, message, err := parseCheckerOutput(interactor.Stderr)
+	if err != nil {
+		return checkerFailed(testResult, "Interactor failed", err.Error())
+	}
+	return applyCredit(testResult, credit, message)
+}
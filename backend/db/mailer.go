@@ -0,0 +1,103 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Email is a plain text message to one recipient
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends the emails of account flows such as email verification and
+// password reset. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Email) error
+}
+
+// Mail is the mailer selected by InitMailer
+var Mail Mailer
+
+// InitMailer selects the mailer from MAILER in the environment: "log"
+// (default) writes emails to the server log, "file" writes them to MAIL_DIR
+// and "smtp" sends them through SMTP_HOST.
+func InitMailer() error {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("MAILER")))
+
+	switch backend {
+	case "", "log":
+		backend = "log"
+		Mail = LogMailer{}
+	case "file":
+		dir := strings.TrimSpace(os.Getenv("MAIL_DIR"))
+		if dir == "" {
+			dir = "mail"
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("error creating mail directory: %w", err)
+		}
+		Mail = &FileMailer{Dir: dir}
+	case "smtp":
+		smtp, err := NewSMTPMailerFromEnv()
+		if err != nil {
+			return err
+		}
+		Mail = smtp
+	default:
+		return fmt.Errorf("unknown MAILER %q", backend)
+	}
+
+	log.Printf("Using %s mailer", backend)
+	return nil
+}
+
+// LogMailer writes emails to the server log instead of sending them, for
+// local development
+type LogMailer struct{}
+
+func (LogMailer) Send(msg Email) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes every email to a .eml file in Dir instead of sending it,
+// for local development and tests
+type FileMailer struct {
+	Dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._@-]+`)
+
+func (m *FileMailer) Send(msg Email) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"),
+		unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	if err := os.WriteFile(filepath.Join(m.Dir, name), formatEmail("", msg), 0o644); err != nil {
+		return fmt.Errorf("error writing email: %w", err)
+	}
+	return nil
+}
+
+// formatEmail renders a message with its headers. Line breaks are removed
+// from header values so they can't add headers of their own.
+func formatEmail(from string, msg Email) []byte {
+	header := strings.NewReplacer("\r", "", "\n", "")
+	var b strings.Builder
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", header.Replace(from))
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", header.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
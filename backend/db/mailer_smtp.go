@@ -0,0 +1,55 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// SMTPMailer sends emails through an SMTP server. The connection is upgraded
+// with STARTTLS when the server offers it, and authentication is only used
+// when Username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPMailerFromEnv configures an SMTPMailer from SMTP_HOST, SMTP_PORT
+// (default 587), SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM
+func NewSMTPMailerFromEnv() (*SMTPMailer, error) {
+	m := &SMTPMailer{
+		Host:     strings.TrimSpace(os.Getenv("SMTP_HOST")),
+		Port:     strings.TrimSpace(os.Getenv("SMTP_PORT")),
+		Username: strings.TrimSpace(os.Getenv("SMTP_USERNAME")),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     strings.TrimSpace(os.Getenv("MAIL_FROM")),
+	}
+	if m.Host == "" {
+		return nil, errors.New("SMTP_HOST is required for the smtp mailer")
+	}
+	if m.From == "" {
+		return nil, errors.New("MAIL_FROM is required for the smtp mailer")
+	}
+	if m.Port == "" {
+		m.Port = "587"
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(msg Email) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	err := smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{msg.To}, formatEmail(m.From, msg))
+	if err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	return nil
+}
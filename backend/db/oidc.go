@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider is an OpenID Connect identity provider users can log in with,
+// such as Google Workspace or Keycloak. The issuer's discovery document is
+// fetched on first use, so the server starts even when the provider is down.
+type OIDCProvider struct {
+	Name         string // Used in the login and callback URLs
+	Label        string // Shown on the login button
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Roles        OIDCRoleMapping
+	// RoleIDClaim is the claim stored as the student or teacher ID of new users
+	RoleIDClaim string
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// OIDCRoleMapping decides whether an account from a provider is a teacher or
+// a student. The claim is checked first, then the email domain, then Default.
+// With none of them matching the user can't log in.
+type OIDCRoleMapping struct {
+	Claim          string // Claim with the user's groups or roles, dots for nested claims
+	TeacherValues  []string
+	StudentValues  []string
+	TeacherDomains []string
+	StudentDomains []string
+	Default        string
+}
+
+// ExternalIdentity is a user as the identity provider knows them
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string // Preferred username, may be empty
+	RoleID        string
+	Role          string // "teacher" or "student"
+}
+
+// OIDCProviders are the providers configured with InitOIDC, by name
+var OIDCProviders = map[string]*OIDCProvider{}
+
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// InitOIDC configures the providers listed in OIDC_PROVIDERS, such as
+// "google,keycloak". Each is configured with OIDC_<NAME>_* variables.
+func InitOIDC() error {
+	callbackBase := strings.TrimRight(strings.TrimSpace(os.Getenv("OIDC_CALLBACK_BASE_URL")), "/")
+	if callbackBase == "" {
+		callbackBase = "http://localhost:8080"
+	}
+
+	for _, name := range envList("OIDC_PROVIDERS") {
+		name = strings.ToLower(name)
+		if !oidcProviderName.MatchString(name) {
+			return fmt.Errorf("invalid OIDC provider name %q", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := &OIDCProvider{
+			Name:         name,
+			Label:        strings.TrimSpace(os.Getenv(prefix + "LABEL")),
+			Issuer:       strings.TrimSpace(os.Getenv(prefix + "ISSUER")),
+			ClientID:     strings.TrimSpace(os.Getenv(prefix + "CLIENT_ID")),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  callbackBase + "/auth/oidc/" + name + "/callback",
+			Scopes:       envList(prefix + "SCOPES"),
+			RoleIDClaim:  strings.TrimSpace(os.Getenv(prefix + "ROLE_ID_CLAIM")),
+			Roles: OIDCRoleMapping{
+				Claim:          strings.TrimSpace(os.Getenv(prefix + "ROLE_CLAIM")),
+				TeacherValues:  envList(prefix + "TEACHER_VALUES"),
+				StudentValues:  envList(prefix + "STUDENT_VALUES"),
+				TeacherDomains: envList(prefix + "TEACHER_DOMAINS"),
+				StudentDomains: envList(prefix + "STUDENT_DOMAINS"),
+				Default:        strings.ToLower(strings.TrimSpace(os.Getenv(prefix + "DEFAULT_ROLE"))),
+			},
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			return fmt.Errorf("%sISSUER and %sCLIENT_ID are required", prefix, prefix)
+		}
+		if p.Roles.Default != "" && p.Roles.Default != "student" && p.Roles.Default != "teacher" {
+			return fmt.Errorf("%sDEFAULT_ROLE must be 'student' or 'teacher'", prefix)
+		}
+		if p.Label == "" {
+			p.Label = name
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+		}
+		if p.RoleIDClaim == "" {
+			p.RoleIDClaim = "preferred_username"
+		}
+
+		OIDCProviders[name] = p
+		log.Printf("OIDC login enabled for %s", name)
+	}
+	return nil
+}
+
+// envList reads a comma separated list from the environment
+func envList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// discover returns the provider's endpoints, fetching them the first time
+func (p *OIDCProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(ctx, p.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("error discovering OIDC provider %s: %w", p.Name, err)
+		}
+		p.provider = provider
+	}
+	return p.provider, nil
+}
+
+func (p *OIDCProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.RedirectURL,
+		Scopes:       p.Scopes,
+	}
+}
+
+// AuthCodeURL returns the provider's login page for an authorization code
+// flow with PKCE. The state, nonce and verifier have to be kept for Exchange.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.oauth2Config(provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange trades the authorization code from the callback for the user's
+// verified identity and maps it to a role
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*ExternalIdentity, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config := p.oauth2Config(provider)
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging authorization code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("provider returned no ID token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("invalid ID token nonce")
+	}
+
+	claims := map[string]any{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token claims: %w", err)
+	}
+
+	// Keycloak leaves roles and groups out of the ID token unless told
+	// otherwise, so look in the user info as well
+	if p.Roles.Claim != "" && lookupClaim(claims, p.Roles.Claim) == nil {
+		userInfo, err := provider.UserInfo(ctx, config.TokenSource(ctx, token))
+		if err == nil {
+			extra := map[string]any{}
+			if userInfo.Claims(&extra) == nil {
+				for k, v := range extra {
+					if _, ok := claims[k]; !ok {
+						claims[k] = v
+					}
+				}
+			}
+		}
+	}
+
+	identity := p.identityFromClaims(idToken.Subject, claims)
+	if identity.Role, err = p.Roles.roleFor(claims, identity.Email, identity.EmailVerified); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// identityFromClaims reads the user's details from the ID token claims
+func (p *OIDCProvider) identityFromClaims(subject string, claims map[string]any) *ExternalIdentity {
+	identity := &ExternalIdentity{Provider: p.Name, Subject: subject}
+	identity.Email, _ = claims["email"].(string)
+	identity.Username, _ = claims["preferred_username"].(string)
+	// Google sends email_verified as a boolean, some providers as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = v
+	case string:
+		identity.EmailVerified = v == "true"
+	}
+
+	if v, ok := lookupClaim(claims, p.RoleIDClaim).(string); ok {
+		identity.RoleID = v
+	}
+	if identity.RoleID == "" {
+		identity.RoleID, _, _ = strings.Cut(identity.Email, "@")
+	}
+	return identity
+}
+
+// roleFor maps the claims and email of a user to "teacher" or "student".
+// Teacher matches win over student ones. The domain rules only apply to an
+// address the provider verified.
+func (m OIDCRoleMapping) roleFor(claims map[string]any, email string, emailVerified bool) (string, error) {
+	if m.Claim != "" {
+		values := claimValues(lookupClaim(claims, m.Claim))
+		for _, v := range values {
+			if slices.Contains(m.TeacherValues, v) {
+				return "teacher", nil
+			}
+		}
+		for _, v := range values {
+			if slices.Contains(m.StudentValues, v) {
+				return "student", nil
+			}
+		}
+	}
+
+	if _, domain, ok := strings.Cut(strings.ToLower(email), "@"); ok && emailVerified {
+		if domainMatches(domain, m.TeacherDomains) {
+			return "teacher", nil
+		}
+		if domainMatches(domain, m.StudentDomains) {
+			return "student", nil
+		}
+	}
+
+	if m.Default != "" {
+		return m.Default, nil
+	}
+	return "", errors.New("your account is not allowed to use ProCode")
+}
+
+// domainMatches reports whether a domain is one of the listed ones or a subdomain of one
+func domainMatches(domain string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "@"))
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupClaim follows a dotted path such as "realm_access.roles" into the claims
+func lookupClaim(claims map[string]any, path string) any {
+	var value any = claims
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// claimValues turns a string or list claim into a list of strings
+func claimValues(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(strings.ReplaceAll(v, ",", " "))
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var unsafeUsernameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// LoginWithIdentity returns the user an external identity belongs to. An
+// identity seen for the first time is linked to the user with the same
+// verified email address, or gets a new user with the role it was mapped to.
+// Admin accounts can't be used through SSO.
+func LoginWithIdentity(identity *ExternalIdentity) (*UserData, error) {
+	var userID int64
+	err := Con.QueryRow("SELECT user_id FROM user_identity WHERE provider = ? AND subject = ?",
+		identity.Provider, identity.Subject).Scan(&userID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("error finding identity: %w", err)
+	}
+
+	if err == sql.ErrNoRows {
+		if userID, err = linkIdentity(identity); err != nil {
+			return nil, err
+		}
+	} else {
+		_, err = Con.Exec("UPDATE user_identity SET email = NULLIF(?, ''), last_login_at = CURRENT_TIMESTAMP WHERE provider = ? AND subject = ?",
+			identity.Email, identity.Provider, identity.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("error updating identity: %w", err)
+		}
+	}
+
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == "admin" {
+		return nil, errors.New("admin accounts can't log in through SSO")
+	}
+	return user, nil
+}
+
+// linkIdentity links a new identity to an existing or a new user in one transaction
+func linkIdentity(identity *ExternalIdentity) (int64, error) {
+	tx, err := Con.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var existing *emailAccount
+	if identity.Email != "" {
+		var account emailAccount
+		err = tx.QueryRow("SELECT id, role, email_verified FROM user WHERE email = ? ORDER BY id LIMIT 1", identity.Email).Scan(
+			&account.ID, &account.Role, &account.EmailVerified)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, fmt.Errorf("error finding user by email: %w", err)
+		}
+		if err == nil {
+			existing = &account
+		}
+	}
+
+	userID, err := linkTarget(identity, existing)
+	if err != nil {
+		return 0, err
+	}
+	if userID == 0 {
+		username, err := availableUsername(tx, identity)
+		if err != nil {
+			return 0, err
+		}
+		userID, err = insertUser(tx, username, identity.Email, "", identity.Role, identity.RoleID, identity.EmailVerified)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_identity (user_id, provider, subject, email, last_login_at)
+		VALUES (?, ?, ?, NULLIF(?, ''), CURRENT_TIMESTAMP)`,
+		userID, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		return 0, fmt.Errorf("error linking identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return userID, nil
+}
+
+// emailAccount is the user already registered with an identity's email
+type emailAccount struct {
+	ID            int64
+	Role          string
+	EmailVerified bool
+}
+
+// linkTarget decides which user a new identity belongs to, given the user
+// with the same email if there is one. It returns 0 when a new user has to be
+// created. Both sides must have verified the address: the provider, so that
+// it's the same person, and the account, since anyone can sign up with an
+// address that isn't theirs and would then share the victim's SSO logins.
+func linkTarget(identity *ExternalIdentity, existing *emailAccount) (int64, error) {
+	if existing == nil {
+		return 0, nil
+	}
+	if !identity.EmailVerified || !existing.EmailVerified {
+		return 0, errors.New("an account with this email already exists, log in with your password")
+	}
+	if existing.Role == "admin" {
+		return 0, errors.New("admin accounts can't log in through SSO")
+	}
+	return existing.ID, nil
+}
+
+// availableUsername picks a username for a new SSO user from their preferred
+// username or email, adding a number when it's taken
+func availableUsername(tx *sql.Tx, identity *ExternalIdentity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = strings.Trim(unsafeUsernameChars.ReplaceAllString(base, "_"), "_")
+	if base == "" {
+		base = identity.Provider + "_user"
+	}
+	if len(base) > 90 {
+		base = base[:90]
+	}
+
+	username := base
+	for i := 2; ; i++ {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM user WHERE username = ?)", username).Scan(&exists); err != nil {
+			return "", fmt.Errorf("error checking username: %w", err)
+		}
+		if !exists {
+			return username, nil
+		}
+		username = base + "_" + strconv.Itoa(i)
+	}
+}
@@ -0,0 +1,386 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// mockIssuer is an OpenID Connect provider serving discovery, keys, tokens
+// and user info. It remembers the PKCE challenge and nonce of every
+// authorization code it hands out, like a real provider would.
+type mockIssuer struct {
+	*httptest.Server
+	t      *testing.T
+	key    *rsa.PrivateKey
+	claims map[string]any // Added to every ID token
+	// userInfo is served from the user info endpoint
+	userInfo map[string]any
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+type authorization struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{t: t, key: key, claims: map[string]any{}, userInfo: map[string]any{}, codes: map[string]authorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/keys",
+			"userinfo_endpoint":                     m.URL + "/userinfo",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", m.token)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, m.userInfo)
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// authorize plays the user logging in at the authorization URL and returns
+// the code the provider sends back
+func (m *mockIssuer) authorize(authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		m.t.Fatalf("authorization URL without an S256 PKCE challenge: %s", authURL)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code := "code-" + q.Get("state")
+	m.codes[code] = authorization{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	return code
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	auth, ok := m.codes[r.FormValue("code")]
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := map[string]any{
+		"iss":   m.URL,
+		"aud":   "procode",
+		"sub":   "user-1",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": auth.nonce,
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	writeJSON(w, map[string]any{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     m.sign(claims),
+	})
+}
+
+func (m *mockIssuer) sign(claims map[string]any) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: m.key, KeyID: "test"}},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	payload, _ := json.Marshal(claims)
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	token, err := jws.CompactSerialize()
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return token
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (m *mockIssuer) provider(roles OIDCRoleMapping) *OIDCProvider {
+	return &OIDCProvider{
+		Name:        "test",
+		Issuer:      m.URL,
+		ClientID:    "procode",
+		RedirectURL: "http://localhost:8080/auth/oidc/test/callback",
+		Scopes:      []string{"openid", "email"},
+		Roles:       roles,
+		RoleIDClaim: "preferred_username",
+	}
+}
+
+// login runs the authorization code flow up to the callback and returns the
+// code, with the nonce and verifier the server stored for the flow
+func login(t *testing.T, m *mockIssuer, p *OIDCProvider) (code, nonce, verifier string) {
+	nonce, verifier = "nonce-1", "verifier-with-enough-entropy-0123456789"
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if !strings.HasPrefix(authURL, m.URL+"/authorize?") {
+		t.Fatalf("authorization URL %s is not the issuer's", authURL)
+	}
+	return m.authorize(authURL), nonce, verifier
+}
+
+func TestOIDCExchange(t *testing.T) {
+	m := newMockIssuer(t)
+	m.claims = map[string]any{
+		"email":              "ada@staff.example.edu",
+		"email_verified":     true,
+		"preferred_username": "ada",
+	}
+	p := m.provider(OIDCRoleMapping{TeacherDomains: []string{"example.edu"}})
+
+	code, nonce, verifier := login(t, m, p)
+	identity, err := p.Exchange(context.Background(), code, nonce, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	want := ExternalIdentity{
+		Provider:      "test",
+		Subject:       "user-1",
+		Email:         "ada@staff.example.edu",
+		EmailVerified: true,
+		Username:      "ada",
+		RoleID:        "ada",
+		Role:          "teacher",
+	}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestOIDCExchangeChecksPKCEVerifier(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider(OIDCRoleMapping{Default: "student"})
+
+	code, nonce, _ := login(t, m, p)
+	_, err := p.Exchange(context.Background(), code, nonce, "some-other-verifier")
+	if err == nil || !strings.Contains(err.Error(), "error exchanging authorization code") {
+		t.Errorf("Exchange with the wrong verifier: err = %v, want the code exchange to fail", err)
+	}
+}
+
+func TestOIDCExchangeChecksNonce(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider(OIDCRoleMapping{Default: "student"})
+
+	code, _, verifier := login(t, m, p)
+	_, err := p.Exchange(context.Background(), code, "nonce-of-another-flow", verifier)
+	if err == nil || err.Error() != "invalid ID token nonce" {
+		t.Errorf("Exchange with the wrong nonce: err = %v, want invalid ID token nonce", err)
+	}
+}
+
+func TestOIDCExchangeRejectsForeignTokens(t *testing.T) {
+	m := newMockIssuer(t)
+	m.claims = map[string]any{"aud": "another-client"}
+	p := m.provider(OIDCRoleMapping{Default: "student"})
+
+	code, nonce, verifier := login(t, m, p)
+	_, err := p.Exchange(context.Background(), code, nonce, verifier)
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid ID token") {
+		t.Errorf("Exchange of a token for another client: err = %v, want invalid ID token", err)
+	}
+}
+
+func TestOIDCExchangeRoleFromUserInfo(t *testing.T) {
+	m := newMockIssuer(t)
+	m.claims = map[string]any{"email": "grace@example.com", "email_verified": true}
+	m.userInfo = map[string]any{
+		"sub":          "user-1",
+		"realm_access": map[string]any{"roles": []string{"offline_access", "procode-teacher"}},
+	}
+	p := m.provider(OIDCRoleMapping{Claim: "realm_access.roles", TeacherValues: []string{"procode-teacher"}})
+
+	code, nonce, verifier := login(t, m, p)
+	identity, err := p.Exchange(context.Background(), code, nonce, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Role != "teacher" {
+		t.Errorf("role = %q, want teacher from the user info roles", identity.Role)
+	}
+}
+
+func TestOIDCExchangeRefusesUnmappedUsers(t *testing.T) {
+	m := newMockIssuer(t)
+	m.claims = map[string]any{"email": "eve@elsewhere.com", "email_verified": true}
+	p := m.provider(OIDCRoleMapping{StudentDomains: []string{"example.edu"}})
+
+	code, nonce, verifier := login(t, m, p)
+	_, err := p.Exchange(context.Background(), code, nonce, verifier)
+	if err == nil || err.Error() != "your account is not allowed to use ProCode" {
+		t.Errorf("Exchange for an unmapped user: err = %v, want the account to be refused", err)
+	}
+}
+
+func TestOIDCRoleMapping(t *testing.T) {
+	keycloak := OIDCRoleMapping{
+		Claim:         "realm_access.roles",
+		TeacherValues: []string{"teacher"},
+		StudentValues: []string{"student"},
+	}
+	domains := OIDCRoleMapping{
+		TeacherDomains: []string{"@staff.example.edu"},
+		StudentDomains: []string{"example.edu"},
+	}
+
+	tests := []struct {
+		name       string
+		mapping    OIDCRoleMapping
+		claims     map[string]any
+		email      string
+		unverified bool
+		want       string
+		wantErr    bool
+	}{
+		{"nested list claim", keycloak, map[string]any{"realm_access": map[string]any{"roles": []any{"student"}}}, "", false, "student", false},
+		{"teacher value wins", keycloak, map[string]any{"realm_access": map[string]any{"roles": []any{"student", "teacher"}}}, "", false, "teacher", false},
+		{"space separated string claim", OIDCRoleMapping{Claim: "groups", TeacherValues: []string{"faculty"}}, map[string]any{"groups": "staff faculty"}, "", false, "teacher", false},
+		{"comma separated string claim", OIDCRoleMapping{Claim: "groups", StudentValues: []string{"cs101"}}, map[string]any{"groups": "cs100,cs101"}, "", false, "student", false},
+		{"claim missing", keycloak, map[string]any{}, "", false, "", true},
+		{"teacher domain", domains, nil, "ada@staff.example.edu", false, "teacher", false},
+		{"subdomain of student domain", domains, nil, "bob@cs.example.edu", false, "student", false},
+		{"domain is case insensitive", domains, nil, "bob@EXAMPLE.EDU", false, "student", false},
+		{"lookalike domain", domains, nil, "eve@notexample.edu", false, "", true},
+		{"unverified teacher domain", domains, nil, "eve@staff.example.edu", true, "", true},
+		{"unverified email falls back to the default", OIDCRoleMapping{TeacherDomains: []string{"example.edu"}, Default: "student"}, nil, "eve@example.edu", true, "student", false},
+		{"claim with unverified email", OIDCRoleMapping{Claim: "role", TeacherValues: []string{"teacher"}}, map[string]any{"role": "teacher"}, "ada@elsewhere.com", true, "teacher", false},
+		{"claim before domain", OIDCRoleMapping{Claim: "role", StudentValues: []string{"student"}, TeacherDomains: []string{"example.edu"}}, map[string]any{"role": "student"}, "ada@example.edu", false, "student", false},
+		{"default", OIDCRoleMapping{Default: "student"}, nil, "eve@elsewhere.com", false, "student", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.mapping.roleFor(tt.claims, tt.email, !tt.unverified)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("roleFor = %q, %v, want %q with error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCIdentityFromClaims(t *testing.T) {
+	p := &OIDCProvider{Name: "keycloak", RoleIDClaim: "attributes.student_id"}
+
+	identity := p.identityFromClaims("sub-1", map[string]any{
+		"email":          "bob@example.edu",
+		"email_verified": "true",
+		"attributes":     map[string]any{"student_id": "S-42"},
+	})
+	if !identity.EmailVerified || identity.RoleID != "S-42" {
+		t.Errorf("identity = %+v, want a verified email and the role ID from the claim", identity)
+	}
+
+	// Without the claim the role ID falls back to the email's local part
+	identity = p.identityFromClaims("sub-1", map[string]any{"email": "bob@example.edu"})
+	if identity.EmailVerified || identity.RoleID != "bob" {
+		t.Errorf("identity = %+v, want an unverified email and role ID bob", identity)
+	}
+}
+
+func TestLinkTarget(t *testing.T) {
+	student := &emailAccount{ID: 7, Role: "student", EmailVerified: true}
+	unverifiedStudent := &emailAccount{ID: 8, Role: "student"}
+	admin := &emailAccount{ID: 1, Role: "admin", EmailVerified: true}
+
+	tests := []struct {
+		name     string
+		verified bool
+		existing *emailAccount
+		want     int64
+		wantErr  string
+	}{
+		{"new user", true, nil, 0, ""},
+		{"new user with unverified email", false, nil, 0, ""},
+		{"linked by verified email", true, student, 7, ""},
+		{"unverified email is refused", false, student, 0, "an account with this email already exists, log in with your password"},
+		{"account that never verified the email is refused", true, unverifiedStudent, 0, "an account with this email already exists, log in with your password"},
+		{"admin is refused", true, admin, 0, "admin accounts can't log in through SSO"},
+		{"unverified admin email is refused", false, admin, 0, "an account with this email already exists, log in with your password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity := &ExternalIdentity{Provider: "test", Subject: "sub-1", Email: "bob@example.edu", EmailVerified: tt.verified}
+			got, err := linkTarget(identity, tt.existing)
+
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if got != tt.want || gotErr != tt.wantErr {
+				t.Errorf("linkTarget = %d, %q, want %d, %q", got, gotErr, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeIgnoresDomainOfUnverifiedEmail(t *testing.T) {
+	m := newMockIssuer(t)
+	m.claims = map[string]any{"email": "eve@staff.example.edu", "email_verified": false}
+	p := m.provider(OIDCRoleMapping{TeacherDomains: []string{"staff.example.edu"}, Default: "student"})
+
+	code, nonce, verifier := login(t, m, p)
+	identity, err := p.Exchange(context.Background(), code, nonce, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Role != "student" {
+		t.Errorf("role = %q, want the default for an unverified email", identity.Role)
+	}
+}
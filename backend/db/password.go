@@ -0,0 +1,133 @@
+package db
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password lengths accepted on signup or change. bcrypt ignores everything
+// past 72 bytes.
+const (
+	MinPasswordLength = 6
+	MaxPasswordLength = 72
+)
+
+// passwordHashCost is the bcrypt cost new hashes are made with. Hashes with a
+// lower cost are upgraded on the next login.
+const passwordHashCost = 12
+
+// defaultAdminPassword is the password the seeded admin account starts with
+const defaultAdminPassword = "admin123"
+
+// validatePassword checks the length of a new password
+func validatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return fmt.Errorf("password must be at most %d bytes", MaxPasswordLength)
+	}
+	return nil
+}
+
+// HashPassword hashes a plaintext password for storage
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// checkPassword verifies a plaintext password against a stored hash.
+// needsRehash is true when the hash should be replaced by a fresh one: for
+// the unsalted SHA-256 digests older versions stored, and bcrypt hashes made
+// with a lower cost.
+func checkPassword(storedHash, password string) (ok, needsRehash bool) {
+	if !strings.HasPrefix(storedHash, "$2") {
+		legacy := generateSHA256Hash(password)
+		return subtle.ConstantTimeCompare([]byte(legacy), []byte(strings.ToLower(storedHash))) == 1, true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(password)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(storedHash))
+	return true, err != nil || cost < passwordHashCost
+}
+
+// authenticate checks a username and plaintext password and returns the
+// user's ID and whether they must change their password. Hashes in an old
+// format are upgraded on the way.
+func authenticate(username, password string) (userID int64, mustChangePassword bool, err error) {
+	var storedHash string
+	err = Con.QueryRow("SELECT id, IFNULL(userpassword, ''), must_change_password FROM user WHERE username = ?",
+		username).Scan(&userID, &storedHash, &mustChangePassword)
+	if err != nil {
+		// Hash anyway so unknown usernames take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return 0, false, errors.New("invalid username or password")
+	}
+
+	ok, needsRehash := checkPassword(storedHash, password)
+	if !ok {
+		return 0, false, errors.New("invalid username or password")
+	}
+
+	if needsRehash {
+		hash, err := HashPassword(password)
+		if err == nil {
+			_, err = Con.Exec("UPDATE user SET userpassword = ? WHERE id = ?", hash, userID)
+		}
+		if err != nil {
+			// The old hash still works, so the login goes ahead
+			log.Printf("Error upgrading password hash of user %d: %v", userID, err)
+		}
+	}
+
+	return userID, mustChangePassword, nil
+}
+
+// dummyPasswordHash is compared against when the username doesn't exist. It is
+// made on first use, since every sandbox helper starts this binary too.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), passwordHashCost)
+	return hash
+})
+
+// ChangePassword replaces a user's password after checking the current one,
+// and lifts a forced password change
+func ChangePassword(username, currentPassword, newPassword string) error {
+	userID, _, err := authenticate(username, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+	if newPassword == currentPassword {
+		return errors.New("the new password must be different from the current one")
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	_, err = Con.Exec("UPDATE user SET userpassword = ?, must_change_password = FALSE WHERE id = ?", hash, userID)
+	if err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+
+	// Whoever knew the old password may still be logged in
+	if _, err := RevokeUserSessions(userID, "password_changed"); err != nil {
+		log.Printf("Error ending sessions of user %d after password change: %v", userID, err)
+	}
+	return nil
+}
@@ -2,11 +2,50 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 )
 
+// ResourceLimits are the execution limits of a question or test case.
+// nil fields fall back to the question default, then the executor default.
+type ResourceLimits struct {
+	CPUTimeLimit *float64 `json:"cpu_time_limit"` // seconds
+	MemoryLimit  *int     `json:"memory_limit"`   // KB
+	StackLimit   *int     `json:"stack_limit"`    // KB
+}
+
+// Or returns l with nil fields taken from fallback
+func (l ResourceLimits) Or(fallback ResourceLimits) ResourceLimits {
+	if l.CPUTimeLimit == nil {
+		l.CPUTimeLimit = fallback.CPUTimeLimit
+	}
+	if l.MemoryLimit == nil {
+		l.MemoryLimit = fallback.MemoryLimit
+	}
+	if l.StackLimit == nil {
+		l.StackLimit = fallback.StackLimit
+	}
+	return l
+}
+
+// executionLimits converts the limits for an ExecutionRequest
+func (l ResourceLimits) executionLimits() ExecutionLimits {
+	var limits ExecutionLimits
+	if l.CPUTimeLimit != nil {
+		limits.CPUTime = *l.CPUTimeLimit
+	}
+	if l.MemoryLimit != nil {
+		limits.MemoryKB = *l.MemoryLimit
+	}
+	if l.StackLimit != nil {
+		limits.StackKB = *l.StackLimit
+	}
+	return limits
+}
+
 type QuestionData struct {
 	ID          int64
 	TeacherID   int64
@@ -17,6 +56,13 @@ type QuestionData struct {
 	CreatedAt   time.Time
 	StartTime   *time.Time // Add StartTime field
 	EndTime     *time.Time // Add EndTime field
+	Limits      ResourceLimits
+	Comparator  Comparator
+	HasChecker  bool // The checker itself is never sent to students
+	Type        string
+	Signature   *FunctionSignature // Function questions only
+	Stubs       map[int]string     // Starting code of a function question by language ID
+	Grading     GradingPolicy
 }
 
 type TestCaseData struct {
@@ -25,6 +71,9 @@ type TestCaseData struct {
 	InputText      string
 	ExpectedOutput string
 	IsHidden       bool
+	Limits         ResourceLimits
+	Comparator     Comparator
+	Group          string
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 }
@@ -33,6 +82,9 @@ type TestCase struct {
 	InputText      string
 	ExpectedOutput string
 	IsHidden       bool
+	Limits         ResourceLimits
+	Comparator     Comparator
+	Group          string // Name of the TestGroup, empty when ungrouped
 }
 
 type QuestionBasicInfo struct {
@@ -44,6 +96,9 @@ type QuestionBasicInfo struct {
 	IsAttempted bool       `json:"isAttempted"` // New field to track if question is attempted
 	Status      string     `json:"status"`      // New field to track attempt status
 	Score       *int       `json:"score"`       // New field to track score of attempted question
+	// Graded submissions used so far out of the question's maximum
+	SubmissionsUsed int `json:"submissionsUsed"`
+	MaxSubmissions  int `json:"maxSubmissions"`
 }
 
 type QuestionWithTestCases struct {
@@ -53,15 +108,24 @@ type QuestionWithTestCases struct {
 
 // Add new structs to contain attempt information
 type AttemptInfo struct {
-	ID            int64     `json:"id"`
-	StartTime     time.Time `json:"startTime"`
-	TimeTakenSecs int       `json:"timeTakenSecs"`
-	Status        string    `json:"status"`
+	ID                int64     `json:"id"`
+	StartTime         time.Time `json:"startTime"`
+	TimeTakenSecs     int       `json:"timeTakenSecs"`
+	Status            string    `json:"status"`
+	Score             int       `json:"score"`             // Score under the grading policy so far
+	GradedSubmissions int       `json:"gradedSubmissions"` // Graded submissions made in this attempt
+	// When the attempt ends, from the time limit and the question's end time.
+	// SecondsLeft is measured on the server so clients need not trust their clock.
+	Deadline    *time.Time `json:"deadline"`
+	SecondsLeft *int       `json:"secondsLeft"`
+	// Latest autosaved editor contents, to restore when the question is reopened
+	Draft *AttemptDraft `json:"draft,omitempty"`
 }
 
 type QuestionWithTestCasesAndAttempt struct {
 	Question  QuestionData
 	TestCases []TestCaseData
+	Groups    []TestGroup
 	Attempt   *AttemptInfo
 }
 
@@ -72,7 +136,29 @@ type BatchWithQuestions struct {
 	Questions  []QuestionBasicInfo `json:"questions"`
 }
 
-func CreateQuestion(userID int64, batchID int64, title, description string, testCases []TestCase, timeLimit int, startTime, endTime *time.Time) (int64, error) {
+// Question types
+const (
+	QuestionTypeStandard    = "standard"    // output is compared with the expected output
+	QuestionTypeInteractive = "interactive" // the submission talks to an interactor
+	QuestionTypeFunction    = "function"    // the submission is a function called by a generated harness
+)
+
+// QuestionOptions are the optional grading settings of a question
+type QuestionOptions struct {
+	Type       string // QuestionTypeStandard when empty
+	Limits     ResourceLimits
+	Comparator Comparator
+	Checker    *Checker
+	Interactor *Interactor        // Required for interactive questions
+	Function   *FunctionSignature // Required for function questions
+	Groups     []TestGroup
+	Grading    GradingPolicy // One graded submission scored as is when unset
+	// Optional solution that fills in empty expected outputs and must pass
+	// every other test case
+	Reference *ReferenceSolution
+}
+
+func CreateQuestion(userID int64, batchID int64, title, description string, testCases []TestCase, timeLimit int, startTime, endTime *time.Time, opts QuestionOptions) (int64, error) {
 	var teacherID int64
 	err := Con.QueryRow("SELECT id FROM teacher WHERE user_id = ?", userID).Scan(&teacherID)
 	if err != nil {
@@ -82,13 +168,11 @@ func CreateQuestion(userID int64, batchID int64, title, description string, test
 		return 0, fmt.Errorf("error finding teacher: %w", err)
 	}
 
-	var exists bool
-	err = Con.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = ? AND teacher_id = ?)",
-		batchID, teacherID).Scan(&exists)
+	owned, err := TeacherOwnsBatch(userID, batchID)
 	if err != nil {
-		return 0, fmt.Errorf("error checking batch ownership: %w", err)
+		return 0, err
 	}
-	if !exists {
+	if !owned {
 		return 0, errors.New("batch not found or you don't have permission to add questions to it")
 	}
 
@@ -96,6 +180,111 @@ func CreateQuestion(userID int64, batchID int64, title, description string, test
 		return 0, errors.New("title and description are required")
 	}
 
+	limits, comparator := opts.Limits, opts.Comparator
+	if err := comparator.Validate(""); err != nil {
+		return 0, err
+	}
+	var checkerCode *string
+	var checkerLanguageID *int
+	if opts.Checker != nil {
+		if err := opts.Checker.Validate(); err != nil {
+			return 0, err
+		}
+		checkerCode, checkerLanguageID = &opts.Checker.Code, &opts.Checker.LanguageID
+	}
+	var referenceCode *string
+	var referenceLanguageID *int
+	if opts.Reference != nil {
+		if err := opts.Reference.Validate(); err != nil {
+			return 0, err
+		}
+		referenceCode, referenceLanguageID = &opts.Reference.Code, &opts.Reference.LanguageID
+	}
+	questionType := opts.Type
+	var interactorCode, functionSignature *string
+	var interactorLanguageID *int
+	if opts.Interactor != nil && questionType != QuestionTypeInteractive {
+		return 0, errors.New("only interactive questions can have an interactor")
+	}
+	if opts.Function != nil && questionType != QuestionTypeFunction {
+		return 0, errors.New("only function questions can have a function signature")
+	}
+	switch questionType {
+	case "", QuestionTypeStandard:
+		questionType = QuestionTypeStandard
+	case QuestionTypeFunction:
+		if opts.Function == nil {
+			return 0, errors.New("function questions need a function signature")
+		}
+		if err := opts.Function.Validate(); err != nil {
+			return 0, err
+		}
+		// Store test cases in the canonical form the harness output is compared with.
+		// Outputs the reference solution fills in are canonical already.
+		testCases = slices.Clone(testCases)
+		for i := range testCases {
+			input, expected, err := opts.Function.CanonicalTestCase(testCases[i].InputText, testCases[i].ExpectedOutput)
+			if opts.Reference != nil && testCases[i].ExpectedOutput == "" {
+				input, err = opts.Function.CanonicalInput(testCases[i].InputText)
+			}
+			if err != nil {
+				return 0, fmt.Errorf("test case %d: %w", i+1, err)
+			}
+			testCases[i].InputText, testCases[i].ExpectedOutput = input, expected
+		}
+		encoded, err := json.Marshal(opts.Function)
+		if err != nil {
+			return 0, fmt.Errorf("error encoding function signature: %w", err)
+		}
+		signature := string(encoded)
+		functionSignature = &signature
+	case QuestionTypeInteractive:
+		if opts.Interactor == nil {
+			return 0, errors.New("interactive questions need an interactor")
+		}
+		if err := opts.Interactor.Validate(); err != nil {
+			return 0, err
+		}
+		if opts.Checker != nil {
+			return 0, errors.New("interactive questions are judged by their interactor and cannot have a checker")
+		}
+		if _, ok := Exec.(InteractiveExecutor); !ok {
+			return 0, errors.New("interactive questions are not supported by this code executor")
+		}
+		if opts.Reference != nil {
+			return 0, errors.New("interactive questions are judged by their interactor and cannot have a reference solution")
+		}
+		interactorCode, interactorLanguageID = &opts.Interactor.Code, &opts.Interactor.LanguageID
+	default:
+		return 0, fmt.Errorf("unknown question type %q", questionType)
+	}
+	if opts.Reference != nil {
+		testCases, err = opts.Reference.complete(referenceQuestion{
+			Limits:     limits,
+			Comparator: comparator,
+			Checker:    opts.Checker,
+			Function:   opts.Function,
+		}, testCases)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for i, tc := range testCases {
+		if err := tc.checkSize(); err != nil {
+			return 0, fmt.Errorf("test case %d: %w", i+1, err)
+		}
+		if err := tc.Comparator.Or(comparator).Validate(tc.ExpectedOutput); err != nil {
+			return 0, fmt.Errorf("test case %d: %w", i+1, err)
+		}
+	}
+	if err := validateTestGroups(opts.Groups, testCases); err != nil {
+		return 0, err
+	}
+	grading := opts.Grading.Normalize()
+	if err := grading.Validate(); err != nil {
+		return 0, err
+	}
+
 	tx, err := Con.Begin()
 	if err != nil {
 		return 0, fmt.Errorf("error starting transaction: %w", err)
@@ -108,11 +297,19 @@ func CreateQuestion(userID int64, batchID int64, title, description string, test
 
 	// Update query to include start_time and end_time
 	questionQuery := `
-		INSERT INTO question (teacher_id, batch_id, title, description, time_limit, start_time, end_time)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO question (teacher_id, batch_id, title, description, time_limit, start_time, end_time,
+			cpu_time_limit, memory_limit, stack_limit, comparator, comparator_tolerance,
+			checker_code, checker_language_id, question_type, interactor_code, interactor_language_id,
+			function_signature, scoring_policy, max_submissions, submission_penalty,
+			reference_code, reference_language_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := tx.Exec(questionQuery, teacherID, batchID, title, description, timeLimit, startTime, endTime)
+	result, err := tx.Exec(questionQuery, teacherID, batchID, title, description, timeLimit, startTime, endTime,
+		limits.CPUTimeLimit, limits.MemoryLimit, limits.StackLimit, comparator.Type, comparator.Tolerance,
+		checkerCode, checkerLanguageID, questionType, interactorCode, interactorLanguageID,
+		functionSignature, grading.Scoring, grading.MaxSubmissions, grading.Penalty,
+		referenceCode, referenceLanguageID)
 	if err != nil {
 		return 0, fmt.Errorf("error creating question: %w", err)
 	}
@@ -122,13 +319,25 @@ func CreateQuestion(userID int64, batchID int64, title, description string, test
 		return 0, fmt.Errorf("error getting new question ID: %w", err)
 	}
 
+	groupIDs, err := insertTestGroups(tx, questionID, opts.Groups)
+	if err != nil {
+		return 0, err
+	}
+
 	if len(testCases) > 0 {
 		testCaseQuery := `
-			INSERT INTO test_case (question_id, input_text, expected_output, is_hidden)
-			VALUES (?, ?, ?, ?)
+			INSERT INTO test_case (question_id, input_text, expected_output, is_hidden,
+				cpu_time_limit, memory_limit, stack_limit, comparator, comparator_tolerance, group_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)
 		`
 		for _, tc := range testCases {
-			_, err = tx.Exec(testCaseQuery, questionID, tc.InputText, tc.ExpectedOutput, tc.IsHidden)
+			var groupID *int64
+			if id, ok := groupIDs[tc.Group]; ok {
+				groupID = &id
+			}
+			_, err = tx.Exec(testCaseQuery, questionID, tc.InputText, tc.ExpectedOutput, tc.IsHidden,
+				tc.Limits.CPUTimeLimit, tc.Limits.MemoryLimit, tc.Limits.StackLimit,
+				tc.Comparator.Type, tc.Comparator.Tolerance, groupID)
 			if err != nil {
 				return 0, fmt.Errorf("error creating test case: %w", err)
 			}
@@ -143,50 +352,9 @@ func CreateQuestion(userID int64, batchID int64, title, description string, test
 }
 
 func GetQuestionsByBatch(userID int64, batchID int64) (*BatchWithQuestions, error) {
-	// Check if the user is a teacher
-	var teacherID int64
-	err := Con.QueryRow("SELECT id FROM teacher WHERE user_id = ?", userID).Scan(&teacherID)
-	if err == nil {
-		// User is a teacher, check if they own the batch
-		var exists bool
-		err = Con.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = ? AND teacher_id = ?)",
-			batchID, teacherID).Scan(&exists)
-		if err != nil {
-			return nil, fmt.Errorf("error checking batch ownership: %w", err)
-		}
-		if !exists {
-			return nil, errors.New("batch not found or you don't have permission to access it")
-		}
-	} else if err != sql.ErrNoRows {
-		return nil, fmt.Errorf("error querying database: %w", err)
-	} else {
-		// User is not a teacher, check if they are a student in this batch
-		var studentID int64
-		err = Con.QueryRow("SELECT id FROM student WHERE user_id = ?", userID).Scan(&studentID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				return nil, errors.New("user is neither a teacher nor a student")
-			}
-			return nil, fmt.Errorf("error finding student: %w", err)
-		}
-
-		// Check if student is enrolled in the batch
-		var exists bool
-		err = Con.QueryRow(`
-			SELECT EXISTS(SELECT 1 FROM batch_student 
-			WHERE batch_id = ? AND student_id = ?)`,
-			batchID, studentID).Scan(&exists)
-		if err != nil {
-			return nil, fmt.Errorf("error checking batch enrollment: %w", err)
-		}
-		if !exists {
-			return nil, errors.New("you are not enrolled in this batch")
-		}
-	}
-
 	// Get batch name
 	var batchName string
-	err = Con.QueryRow("SELECT name FROM batch WHERE id = ?", batchID).Scan(&batchName)
+	err := Con.QueryRow("SELECT name FROM batch WHERE id = ?", batchID).Scan(&batchName)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving batch name: %w", err)
 	}
@@ -204,7 +372,7 @@ func GetQuestionsByBatch(userID int64, batchID int64) (*BatchWithQuestions, erro
 
 	// Changed from ORDER BY created_at DESC to order by start_time
 	rows, err := Con.Query(`
-		SELECT id, title, time_limit, start_time, end_time 
+		SELECT id, title, time_limit, start_time, end_time, max_submissions
 		FROM question 
 		WHERE batch_id = ? 
 		ORDER BY CASE WHEN start_time IS NULL THEN 0 ELSE 1 END, start_time DESC
@@ -217,23 +385,22 @@ func GetQuestionsByBatch(userID int64, batchID int64) (*BatchWithQuestions, erro
 	var questions []QuestionBasicInfo
 	for rows.Next() {
 		var q QuestionBasicInfo
-		if err := rows.Scan(&q.ID, &q.Title, &q.TimeLimit, &q.StartTime, &q.EndTime); err != nil {
+		if err := rows.Scan(&q.ID, &q.Title, &q.TimeLimit, &q.StartTime, &q.EndTime, &q.MaxSubmissions); err != nil {
 			return nil, fmt.Errorf("error scanning question row: %w", err)
 		}
 
-		// Check if the question has been attempted by this student
+		// Check if the question has been attempted by this student. The score
+		// is reported as soon as one graded submission has been made.
 		if isStudent {
 			var score int
 			err = Con.QueryRow(`
-				SELECT status, score FROM attempt 
+				SELECT status, score, attempted, graded_submissions FROM attempt 
 				WHERE student_id = ? AND question_id = ? 
-				AND attempted = TRUE
+				AND (attempted = TRUE OR graded_submissions > 0)
 				ORDER BY id DESC LIMIT 1
-			`, studentID, q.ID).Scan(&q.Status, &score)
+			`, studentID, q.ID).Scan(&q.Status, &score, &q.IsAttempted, &q.SubmissionsUsed)
 
 			if err == nil {
-				// Found a completed attempt
-				q.IsAttempted = true
 				q.Score = &score
 			} else if err != sql.ErrNoRows {
 				return nil, fmt.Errorf("error checking attempt status: %w", err)
@@ -265,19 +432,6 @@ func GetQuestionByID(userID int64, batchID int64, questionID int64) (*QuestionWi
 		return nil, fmt.Errorf("error finding student: %w", err)
 	}
 
-	// Check if student is enrolled in the batch
-	var exists bool
-	err = Con.QueryRow(`
-		SELECT EXISTS(SELECT 1 FROM batch_student 
-		WHERE batch_id = ? AND student_id = ?)`,
-		batchID, studentID).Scan(&exists)
-	if err != nil {
-		return nil, fmt.Errorf("error checking batch enrollment: %w", err)
-	}
-	if !exists {
-		return nil, errors.New("you are not enrolled in this batch")
-	}
-
 	// Check if the question has been already fully attempted and completed
 	var attemptExists bool
 	err = Con.QueryRow(`
@@ -296,6 +450,7 @@ func GetQuestionByID(userID int64, batchID int64, questionID int64) (*QuestionWi
 	}
 
 	// Validate question exists in the batch
+	var exists bool
 	err = Con.QueryRow("SELECT EXISTS(SELECT 1 FROM question WHERE id = ? AND batch_id = ?)",
 		questionID, batchID).Scan(&exists)
 	if err != nil {
@@ -306,51 +461,33 @@ func GetQuestionByID(userID int64, batchID int64, questionID int64) (*QuestionWi
 	}
 
 	// Get question details
-	var question QuestionData
-	err = Con.QueryRow(`
-		SELECT id, teacher_id, batch_id, title, description, time_limit, created_at, start_time, end_time 
-		FROM question 
-		WHERE id = ?`, questionID).Scan(
-		&question.ID, &question.TeacherID, &question.BatchID,
-		&question.Title, &question.Description, &question.TimeLimit, &question.CreatedAt, &question.StartTime, &question.EndTime)
+	question, err := loadQuestionData(questionID)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving question: %w", err)
+		return nil, err
 	}
 
 	// Get non-hidden test cases
-	rows, err := Con.Query(`
-		SELECT id, question_id, input_text, expected_output, is_hidden, created_at, updated_at
-		FROM test_case 
-		WHERE question_id = ? AND is_hidden = false`, questionID)
+	testCases, err := loadTestCaseData(questionID, false)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving test cases: %w", err)
-	}
-	defer rows.Close()
-
-	var testCases []TestCaseData
-	for rows.Next() {
-		var tc TestCaseData
-		if err := rows.Scan(&tc.ID, &tc.QuestionID, &tc.InputText, &tc.ExpectedOutput,
-			&tc.IsHidden, &tc.CreatedAt, &tc.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("error scanning test case row: %w", err)
-		}
-		testCases = append(testCases, tc)
+		return nil, err
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating test case rows: %w", err)
+	groups, err := loadTestGroups(questionID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check for an existing in-progress attempt
 	var attemptInfo AttemptInfo
 
 	err = Con.QueryRow(`
-		SELECT id, start_time, IFNULL(time_taken_seconds, 0), status
+		SELECT id, start_time, IFNULL(time_taken_seconds, 0), status, IFNULL(score, 0), graded_submissions
 		FROM attempt
 		WHERE student_id = ? AND question_id = ? AND status = 'in_progress'
 		ORDER BY id DESC
 		LIMIT 1
-	`, studentID, questionID).Scan(&attemptInfo.ID, &attemptInfo.StartTime, &attemptInfo.TimeTakenSecs, &attemptInfo.Status)
+	`, studentID, questionID).Scan(&attemptInfo.ID, &attemptInfo.StartTime, &attemptInfo.TimeTakenSecs, &attemptInfo.Status,
+		&attemptInfo.Score, &attemptInfo.GradedSubmissions)
 
 	if err != nil {
 		if err != sql.ErrNoRows {
@@ -380,9 +517,82 @@ func GetQuestionByID(userID int64, batchID int64, questionID int64) (*QuestionWi
 	}
 	// Note: If an attempt already exists, we use it without modification to preserve the original start time
 
+	if attemptInfo.Draft, err = loadDraft(attemptInfo.ID); err != nil {
+		return nil, err
+	}
+
+	attemptInfo.Deadline = attemptDeadline(attemptInfo.StartTime, question.TimeLimit, question.EndTime)
+	if attemptInfo.Deadline != nil {
+		secondsLeft := max(0, int(time.Until(*attemptInfo.Deadline).Seconds()))
+		attemptInfo.SecondsLeft = &secondsLeft
+	}
+
 	return &QuestionWithTestCasesAndAttempt{
-		Question:  question,
+		Question:  *question,
 		TestCases: testCases,
+		Groups:    groups,
 		Attempt:   &attemptInfo,
 	}, nil
 }
+
+// loadQuestionData loads a question without its test cases
+func loadQuestionData(questionID int64) (*QuestionData, error) {
+	var question QuestionData
+	var functionSignature sql.NullString
+	err := Con.QueryRow(`
+		SELECT id, teacher_id, batch_id, title, description, time_limit, created_at, start_time, end_time,
+			cpu_time_limit, memory_limit, stack_limit, IFNULL(comparator, ''), comparator_tolerance,
+			checker_code IS NOT NULL, question_type, function_signature,
+			IFNULL(scoring_policy, ''), max_submissions, submission_penalty
+		FROM question 
+		WHERE id = ?`, questionID).Scan(
+		&question.ID, &question.TeacherID, &question.BatchID,
+		&question.Title, &question.Description, &question.TimeLimit, &question.CreatedAt, &question.StartTime, &question.EndTime,
+		&question.Limits.CPUTimeLimit, &question.Limits.MemoryLimit, &question.Limits.StackLimit,
+		&question.Comparator.Type, &question.Comparator.Tolerance, &question.HasChecker, &question.Type, &functionSignature,
+		&question.Grading.Scoring, &question.Grading.MaxSubmissions, &question.Grading.Penalty)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving question: %w", err)
+	}
+	if question.Signature, err = decodeFunctionSignature(functionSignature); err != nil {
+		return nil, err
+	}
+	if question.Signature != nil {
+		question.Stubs = question.Signature.Stubs()
+	}
+	question.Grading = question.Grading.Normalize()
+	return &question, nil
+}
+
+// loadTestCaseData loads the test cases of a question, leaving out hidden ones
+// unless includeHidden is set
+func loadTestCaseData(questionID int64, includeHidden bool) ([]TestCaseData, error) {
+	rows, err := Con.Query(`
+		SELECT tc.id, tc.question_id, tc.input_text, tc.expected_output, tc.is_hidden,
+			tc.cpu_time_limit, tc.memory_limit, tc.stack_limit, IFNULL(tc.comparator, ''), tc.comparator_tolerance,
+			IFNULL(g.name, ''), tc.created_at, tc.updated_at
+		FROM test_case tc
+		LEFT JOIN test_group g ON g.id = tc.group_id
+		WHERE tc.question_id = ? AND (? OR tc.is_hidden = false)
+		ORDER BY tc.id`, questionID, includeHidden)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving test cases: %w", err)
+	}
+	defer rows.Close()
+
+	var testCases []TestCaseData
+	for rows.Next() {
+		var tc TestCaseData
+		if err := rows.Scan(&tc.ID, &tc.QuestionID, &tc.InputText, &tc.ExpectedOutput,
+			&tc.IsHidden, &tc.Limits.CPUTimeLimit, &tc.Limits.MemoryLimit, &tc.Limits.StackLimit,
+			&tc.Comparator.Type, &tc.Comparator.Tolerance, &tc.Group, &tc.CreatedAt, &tc.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning test case row: %w", err)
+		}
+		testCases = append(testCases, tc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating test case rows: %w", err)
+	}
+	return testCases, nil
+}
@@ -0,0 +1,315 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// QuestionEdit holds the settings of a question a teacher can change after
+// creating it. The type, checker, interactor, function signature and test
+// groups are fixed once students may have submitted against them.
+type QuestionEdit struct {
+	Title       string
+	Description string
+	TimeLimit   int // Time limit in minutes
+	StartTime   *time.Time
+	EndTime     *time.Time
+	Limits      ResourceLimits
+	Comparator  Comparator
+	Grading     GradingPolicy
+}
+
+// TeacherQuestion is a question with all of its test cases, hidden ones included
+type TeacherQuestion struct {
+	Question  QuestionData
+	TestCases []TestCaseData
+	Groups    []TestGroup
+	Reference *ReferenceSolution
+}
+
+// QuestionBatchID returns the ID of the batch the question belongs to
+func QuestionBatchID(questionID int64) (int64, error) {
+	var batchID int64
+	err := Con.QueryRow("SELECT batch_id FROM question WHERE id = ?", questionID).Scan(&batchID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, errors.New("question not found")
+		}
+		return 0, fmt.Errorf("error finding question batch: %w", err)
+	}
+	return batchID, nil
+}
+
+// GetQuestionForTeacher returns a question with every test case, for its teacher
+func GetQuestionForTeacher(questionID int64) (*TeacherQuestion, error) {
+	question, err := loadQuestionData(questionID)
+	if err != nil {
+		return nil, err
+	}
+	testCases, err := loadTestCaseData(questionID, true)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := loadTestGroups(questionID)
+	if err != nil {
+		return nil, err
+	}
+	reference, err := loadReferenceSolution(questionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TeacherQuestion{Question: *question, TestCases: testCases, Groups: groups, Reference: reference}, nil
+}
+
+// UpdateQuestion replaces the editable settings of a question
+func UpdateQuestion(questionID int64, edit QuestionEdit) error {
+	if edit.Title == "" || edit.Description == "" {
+		return errors.New("title and description are required")
+	}
+	if edit.StartTime != nil && edit.EndTime != nil && !edit.EndTime.After(*edit.StartTime) {
+		return errors.New("end time must be after start time")
+	}
+	if err := edit.Comparator.Validate(""); err != nil {
+		return err
+	}
+	grading := edit.Grading.Normalize()
+	if err := grading.Validate(); err != nil {
+		return err
+	}
+
+	// A new default comparator must still accept every test case that uses it
+	rows, err := Con.Query(`
+		SELECT expected_output, IFNULL(comparator, ''), comparator_tolerance
+		FROM test_case WHERE question_id = ? ORDER BY id`, questionID)
+	if err != nil {
+		return fmt.Errorf("error retrieving test cases: %w", err)
+	}
+	defer rows.Close()
+	for i := 1; rows.Next(); i++ {
+		var expected string
+		var comparator Comparator
+		if err := rows.Scan(&expected, &comparator.Type, &comparator.Tolerance); err != nil {
+			return fmt.Errorf("error scanning test case row: %w", err)
+		}
+		if err := comparator.Or(edit.Comparator).Validate(expected); err != nil {
+			return fmt.Errorf("test case %d: %w", i, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating test case rows: %w", err)
+	}
+
+	_, err = Con.Exec(`
+		UPDATE question
+		SET title = ?, description = ?, time_limit = ?, start_time = ?, end_time = ?,
+			cpu_time_limit = ?, memory_limit = ?, stack_limit = ?, comparator = NULLIF(?, ''), comparator_tolerance = ?,
+			scoring_policy = ?, max_submissions = ?, submission_penalty = ?
+		WHERE id = ?`,
+		edit.Title, edit.Description, edit.TimeLimit, edit.StartTime, edit.EndTime,
+		edit.Limits.CPUTimeLimit, edit.Limits.MemoryLimit, edit.Limits.StackLimit, edit.Comparator.Type, edit.Comparator.Tolerance,
+		grading.Scoring, grading.MaxSubmissions, grading.Penalty, questionID)
+	if err != nil {
+		return fmt.Errorf("error updating question: %w", err)
+	}
+	return nil
+}
+
+// DeleteQuestion deletes a question with its test cases, attempts and submissions
+func DeleteQuestion(questionID int64) error {
+	if _, err := Con.Exec("DELETE FROM question WHERE id = ?", questionID); err != nil {
+		return fmt.Errorf("error deleting question: %w", err)
+	}
+	return nil
+}
+
+// AddTestCase adds a test case to a question and returns its ID
+func AddTestCase(questionID int64, tc TestCase) (int64, error) {
+	tc, groupID, err := prepareTestCase(questionID, tc)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := Con.Exec(`
+		INSERT INTO test_case (question_id, input_text, expected_output, is_hidden,
+			cpu_time_limit, memory_limit, stack_limit, comparator, comparator_tolerance, group_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)`,
+		questionID, tc.InputText, tc.ExpectedOutput, tc.IsHidden,
+		tc.Limits.CPUTimeLimit, tc.Limits.MemoryLimit, tc.Limits.StackLimit,
+		tc.Comparator.Type, tc.Comparator.Tolerance, groupID)
+	if err != nil {
+		return 0, fmt.Errorf("error creating test case: %w", err)
+	}
+
+	testCaseID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting new test case ID: %w", err)
+	}
+	return testCaseID, nil
+}
+
+// UpdateTestCase replaces a test case of a question
+func UpdateTestCase(questionID, testCaseID int64, tc TestCase) error {
+	var exists bool
+	err := Con.QueryRow("SELECT EXISTS(SELECT 1 FROM test_case WHERE id = ? AND question_id = ?)",
+		testCaseID, questionID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking test case: %w", err)
+	}
+	if !exists {
+		return errors.New("test case not found")
+	}
+
+	tc, groupID, err := prepareTestCase(questionID, tc)
+	if err != nil {
+		return err
+	}
+
+	_, err = Con.Exec(`
+		UPDATE test_case
+		SET input_text = ?, expected_output = ?, is_hidden = ?, cpu_time_limit = ?, memory_limit = ?, stack_limit = ?,
+			comparator = NULLIF(?, ''), comparator_tolerance = ?, group_id = ?
+		WHERE id = ?`,
+		tc.InputText, tc.ExpectedOutput, tc.IsHidden, tc.Limits.CPUTimeLimit, tc.Limits.MemoryLimit, tc.Limits.StackLimit,
+		tc.Comparator.Type, tc.Comparator.Tolerance, groupID, testCaseID)
+	if err != nil {
+		return fmt.Errorf("error updating test case: %w", err)
+	}
+	return nil
+}
+
+// DeleteTestCase removes a test case from a question
+func DeleteTestCase(questionID, testCaseID int64) error {
+	result, err := Con.Exec("DELETE FROM test_case WHERE id = ? AND question_id = ?", testCaseID, questionID)
+	if err != nil {
+		return fmt.Errorf("error deleting test case: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return errors.New("test case not found")
+	}
+	return nil
+}
+
+// testCaseSettings holds what new test cases of a question are checked against
+type testCaseSettings struct {
+	referenceQuestion
+	Reference *ReferenceSolution
+	Groups    map[string]int64 // Test group IDs by name
+}
+
+// loadTestCaseSettings loads the settings of a question new test cases are checked against
+func loadTestCaseSettings(questionID int64) (*testCaseSettings, error) {
+	var settings testCaseSettings
+	var checkerCode, functionSignature sql.NullString
+	var checkerLanguageID sql.NullInt64
+	err := Con.QueryRow(`
+		SELECT cpu_time_limit, memory_limit, stack_limit, IFNULL(comparator, ''), comparator_tolerance,
+			checker_code, checker_language_id, function_signature
+		FROM question WHERE id = ?`, questionID).Scan(
+		&settings.Limits.CPUTimeLimit, &settings.Limits.MemoryLimit, &settings.Limits.StackLimit,
+		&settings.Comparator.Type, &settings.Comparator.Tolerance,
+		&checkerCode, &checkerLanguageID, &functionSignature)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving question: %w", err)
+	}
+	if checkerCode.Valid && checkerCode.String != "" {
+		settings.Checker = &Checker{Code: checkerCode.String, LanguageID: int(checkerLanguageID.Int64)}
+	}
+	if settings.Function, err = decodeFunctionSignature(functionSignature); err != nil {
+		return nil, err
+	}
+	if settings.Reference, err = loadReferenceSolution(questionID); err != nil {
+		return nil, err
+	}
+
+	rows, err := Con.Query("SELECT id, name FROM test_group WHERE question_id = ?", questionID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving test groups: %w", err)
+	}
+	defer rows.Close()
+	settings.Groups = map[string]int64{}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, fmt.Errorf("error scanning test group: %w", err)
+		}
+		settings.Groups[name] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating test groups: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// prepare validates test cases the way CreateQuestion does and returns them
+// as stored, with the ID of each one's group
+func (s *testCaseSettings) prepare(testCases []TestCase) ([]TestCase, []*int64, error) {
+	testCases = slices.Clone(testCases)
+
+	// Function questions store test cases in the canonical form the harness output is compared with
+	if s.Function != nil {
+		for i, tc := range testCases {
+			var err error
+			if s.Reference != nil && tc.ExpectedOutput == "" {
+				testCases[i].InputText, err = s.Function.CanonicalInput(tc.InputText)
+			} else {
+				testCases[i].InputText, testCases[i].ExpectedOutput, err = s.Function.CanonicalTestCase(tc.InputText, tc.ExpectedOutput)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("test case %d: %w", i+1, err)
+			}
+		}
+	}
+
+	if s.Reference != nil {
+		var err error
+		if testCases, err = s.Reference.complete(s.referenceQuestion, testCases); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	groupIDs := make([]*int64, len(testCases))
+	for i, tc := range testCases {
+		if err := tc.checkSize(); err != nil {
+			return nil, nil, fmt.Errorf("test case %d: %w", i+1, err)
+		}
+		if err := tc.Comparator.Or(s.Comparator).Validate(tc.ExpectedOutput); err != nil {
+			return nil, nil, fmt.Errorf("test case %d: %w", i+1, err)
+		}
+		if tc.Group == "" {
+			continue
+		}
+		id, ok := s.Groups[tc.Group]
+		if !ok {
+			return nil, nil, fmt.Errorf("test case %d is in unknown group %q", i+1, tc.Group)
+		}
+		groupIDs[i] = &id
+	}
+	return testCases, groupIDs, nil
+}
+
+// checkSize checks that the input and expected output fit in the database
+func (tc TestCase) checkSize() error {
+	if len(tc.InputText) > maxTestCaseText || len(tc.ExpectedOutput) > maxTestCaseText {
+		return fmt.Errorf("input and expected output are limited to %d MB each", maxTestCaseText>>20)
+	}
+	return nil
+}
+
+// prepareTestCase validates a single test case of a question and resolves its group
+func prepareTestCase(questionID int64, tc TestCase) (TestCase, *int64, error) {
+	settings, err := loadTestCaseSettings(questionID)
+	if err != nil {
+		return tc, nil, err
+	}
+	testCases, groupIDs, err := settings.prepare([]TestCase{tc})
+	if err != nil {
+		return tc, nil, err
+	}
+	return testCases[0], groupIDs[0], nil
+}
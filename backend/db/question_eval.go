@@ -1,17 +1,12 @@
 package db
 
 import (
-	"bytes"
-	"crypto/tls"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,14 +21,31 @@ import (
 // 		// Add more languages as needed
 // )
 
+// Verdicts reported for each executed test case
+const (
+	VerdictAccepted            = "AC"
+	VerdictWrongAnswer         = "WA"
+	VerdictTimeLimitExceeded   = "TLE"
+	VerdictMemoryLimitExceeded = "MLE"
+	VerdictRuntimeError        = "RE"
+	VerdictCompilationError    = "CE"
+	VerdictPartial             = "PC" // A checker gave partial credit
+	VerdictInternalError       = "IE" // The executor failed, not the submission
+)
+
 // TestResult represents the result of a single test case
 type TestResult struct {
-	Status         string `json:"status"`
-	Input          string `json:"input,omitempty"`
-	ExpectedOutput string `json:"expected_output,omitempty"`
-	ActualOutput   string `json:"actual_output"`
-	IsHidden       bool   `json:"is_hidden"`
-	Error          string `json:"error,omitempty"` // For runtime or compilation errors
+	Status         string  `json:"status"`
+	Verdict        string  `json:"verdict,omitempty"`
+	Input          string  `json:"input,omitempty"`
+	ExpectedOutput string  `json:"expected_output,omitempty"`
+	ActualOutput   string  `json:"actual_output"`
+	IsHidden       bool    `json:"is_hidden"`
+	Error          string  `json:"error,omitempty"`           // For runtime or compilation errors
+	CheckerMessage string  `json:"checker_message,omitempty"` // What the checker or interactor said about the output
+	Score          float64 `json:"score"`                     // Credit between 0 and 1
+	Time           float64 `json:"time"`                      // CPU seconds used
+	Memory         int     `json:"memory"`                    // Peak memory used in KB
 }
 
 // EvaluationResult represents the complete result of code evaluation
@@ -41,57 +53,110 @@ type EvaluationResult struct {
 	TotalTests  int          `json:"total_tests"`
 	PassedTests int          `json:"passed_tests"`
 	TestResults []TestResult `json:"test_results"`
+	Groups      []GroupScore `json:"groups,omitempty"` // Per-group breakdown when the question has test groups
 	Status      string       `json:"status"`
+	// Set for graded submissions: the attempt's score under the question's
+	// grading policy and how many graded submissions remain
+	AttemptScore    *int `json:"attempt_score,omitempty"`
+	SubmissionsLeft *int `json:"submissions_left,omitempty"`
 }
 
-// Judge0Submission represents the JSON structure for Judge0 API submission
-type Judge0Submission struct {
-	SourceCode string `json:"source_code"`
-	LanguageID int    `json:"language_id"`
-	Stdin      string `json:"stdin"`
+// evaluationTarget is the attempt a submission is graded against
+type evaluationTarget struct {
+	StudentID  int64
+	QuestionID int64
+	BatchID    int64
+	AttemptID  int64
+	StartTime  time.Time
+	TimeLimit  int
+	OpensAt    *time.Time // Question start time
+	ClosesAt   *time.Time // Question end time
+	Deadline   *time.Time // See attemptDeadline
+	TestCases  []evalTestCase
+	Groups     []TestGroup
+	Grading    GradingPolicy
+}
+
+// credit adds up the credit of every test case. Without a checker this is the
+// number of passed tests.
+func (r *EvaluationResult) credit() float64 {
+	var credit float64
+	for _, tr := range r.TestResults {
+		credit += tr.Score
+	}
+	return credit
 }
 
-// Judge0Response represents the JSON structure for Judge0 API response
-type Judge0Response struct {
-	Stdout        string `json:"stdout"`
-	Stderr        string `json:"stderr"`
-	CompileOutput string `json:"compile_output"`
-	Message       string `json:"message"`
-	Status        struct {
-		ID          int    `json:"id"`
-		Description string `json:"description"`
-	} `json:"status"`
+// score is the percentage the result earns, from group points when the
+// question has test groups
+func (r *EvaluationResult) score() int {
+	if len(r.Groups) > 0 {
+		return int(groupPercentage(r.Groups))
+	}
+	if r.TotalTests == 0 {
+		return 0
+	}
+	return int((r.credit() / float64(r.TotalTests)) * 100)
 }
 
-// EvaluateCode evaluates a code submission against test cases using Judge0 API
+// EvaluateCode evaluates a code submission against test cases using the configured executor
 func EvaluateCode(userID int64, questionID int64, code string, languageID int, calculateScore bool) (*EvaluationResult, error) {
-	// 1. Validate if the user is a student
+	studentID, err := studentIDForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := loadEvaluationTarget(studentID, questionID)
+	if err != nil {
+		return nil, err
+	}
+
+	submittedAt := time.Now()
+	if err := target.checkWindow(submittedAt); err != nil {
+		return nil, err
+	}
+
+	result, err := runEvaluation(Exec, code, languageID, target.TestCases, target.Groups, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := recordEvaluation(target, result, code, calculateScore, submittedAt); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// studentIDForUser validates that the user is a student and returns the student ID
+func studentIDForUser(userID int64) (int64, error) {
 	var studentID int64
 	err := Con.QueryRow("SELECT id FROM student WHERE user_id = ?", userID).Scan(&studentID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user is not a student")
+			return 0, errors.New("user is not a student")
 		}
-		return nil, fmt.Errorf("error finding student: %w", err)
+		return 0, fmt.Errorf("error finding student: %w", err)
 	}
+	return studentID, nil
+}
 
-	// 2. Find the batch to which the question belongs and get time limit
-	var batchID int64
-	var timeLimit int
-	err = Con.QueryRow("SELECT batch_id, time_limit FROM question WHERE id = ?", questionID).Scan(&batchID, &timeLimit)
+// loadEvaluationTarget checks that the student may submit for the question and
+// loads the open attempt and the test cases
+func loadEvaluationTarget(studentID int64, questionID int64) (*evaluationTarget, error) {
+	// 1. Load the question with its time and resource limits and test cases
+	target, err := loadQuestionTarget(questionID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("question not found")
-		}
-		return nil, fmt.Errorf("error finding question: %w", err)
+		return nil, err
 	}
+	target.StudentID = studentID
 
-	// 3. Check if the student is enrolled in the batch
+	// 2. Check if the student is enrolled in the batch
 	var enrolled bool
 	err = Con.QueryRow(`
-		SELECT EXISTS(SELECT 1 FROM batch_student 
+		SELECT EXISTS(SELECT 1 FROM batch_student
 		WHERE batch_id = ? AND student_id = ?)`,
-		batchID, studentID).Scan(&enrolled)
+		target.BatchID, studentID).Scan(&enrolled)
 	if err != nil {
 		return nil, fmt.Errorf("error checking batch enrollment: %w", err)
 	}
@@ -99,18 +164,15 @@ func EvaluateCode(userID int64, questionID int64, code string, languageID int, c
 		return nil, errors.New("student is not enrolled in the batch containing this question")
 	}
 
-	// 4. Check if a final submission has already been made
-	var attemptID int64
-	var endTimeExists bool
-	var startTime time.Time
+	// 3. Check if a final submission has already been made
 	var alreadyAttempted bool
 
 	err = Con.QueryRow(`
-		SELECT id, start_time, (end_time IS NOT NULL) as has_end_time, attempted
+		SELECT id, start_time, attempted
 		FROM attempt 
 		WHERE student_id = ? AND question_id = ?
 		ORDER BY id DESC LIMIT 1`,
-		studentID, questionID).Scan(&attemptID, &startTime, &endTimeExists, &alreadyAttempted)
+		studentID, questionID).Scan(&target.AttemptID, &target.StartTime, &alreadyAttempted)
 
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("error checking for existing attempt: %w", err)
@@ -121,235 +183,452 @@ func EvaluateCode(userID int64, questionID int64, code string, languageID int, c
 		return nil, errors.New("no attempt record found, please access the question details first")
 	}
 
-	// If end_time exists, no more submissions allowed
-	log.Println(attemptID, startTime, endTimeExists, alreadyAttempted)
-
 	// If this is a graded submission (calculateScore is true) and the attempt is already marked as attempted
 	if alreadyAttempted {
 		return nil, errors.New("this attempt has already been submitted for grading")
 	}
+	target.Deadline = attemptDeadline(target.StartTime, target.TimeLimit, target.ClosesAt)
+
+	return target, nil
+}
+
+// loadAttemptTarget loads the attempt a queued submission was made for. The
+// checks of loadEvaluationTarget already ran when it was queued, and
+// recordEvaluation refuses attempts that were closed since.
+func loadAttemptTarget(attemptID int64) (*evaluationTarget, error) {
+	var studentID, questionID int64
+	var startTime time.Time
+	err := Con.QueryRow("SELECT student_id, question_id, start_time FROM attempt WHERE id = ?", attemptID).Scan(
+		&studentID, &questionID, &startTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("attempt not found")
+		}
+		return nil, fmt.Errorf("error loading attempt: %w", err)
+	}
 
-	// 5. Fetch all test cases for the question
+	target, err := loadQuestionTarget(questionID)
+	if err != nil {
+		return nil, err
+	}
+	target.StudentID = studentID
+	target.AttemptID = attemptID
+	target.StartTime = startTime
+	target.Deadline = attemptDeadline(target.StartTime, target.TimeLimit, target.ClosesAt)
+	return target, nil
+}
+
+// loadQuestionTarget loads the grading settings and test cases of a question,
+// without any attempt
+func loadQuestionTarget(questionID int64) (*evaluationTarget, error) {
+	target := &evaluationTarget{QuestionID: questionID}
+
+	// Find the batch to which the question belongs and get time and resource limits
+	var questionLimits ResourceLimits
+	var questionComparator Comparator
+	var checkerCode, interactorCode, functionSignature sql.NullString
+	var checkerLanguageID, interactorLanguageID sql.NullInt64
+	err := Con.QueryRow(`
+		SELECT batch_id, time_limit, start_time, end_time, cpu_time_limit, memory_limit, stack_limit,
+			IFNULL(comparator, ''), comparator_tolerance, checker_code, checker_language_id,
+			interactor_code, interactor_language_id, function_signature,
+			IFNULL(scoring_policy, ''), max_submissions, submission_penalty
+		FROM question WHERE id = ?`, questionID).Scan(
+		&target.BatchID, &target.TimeLimit, &target.OpensAt, &target.ClosesAt,
+		&questionLimits.CPUTimeLimit, &questionLimits.MemoryLimit, &questionLimits.StackLimit,
+		&questionComparator.Type, &questionComparator.Tolerance, &checkerCode, &checkerLanguageID,
+		&interactorCode, &interactorLanguageID, &functionSignature,
+		&target.Grading.Scoring, &target.Grading.MaxSubmissions, &target.Grading.Penalty)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("question not found")
+		}
+		return nil, fmt.Errorf("error finding question: %w", err)
+	}
+	target.Grading = target.Grading.Normalize()
+
+	var checker *Checker
+	if checkerCode.Valid && checkerCode.String != "" {
+		checker = &Checker{Code: checkerCode.String, LanguageID: int(checkerLanguageID.Int64)}
+	}
+	var interactor *Interactor
+	if interactorCode.Valid && interactorCode.String != "" {
+		interactor = &Interactor{Code: interactorCode.String, LanguageID: int(interactorLanguageID.Int64)}
+	}
+	function, err := decodeFunctionSignature(functionSignature)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch all test cases for the question
 	rows, err := Con.Query(`
-		SELECT input_text, expected_output, is_hidden
-		FROM test_case 
-		WHERE question_id = ?`, questionID)
+		SELECT tc.input_text, tc.expected_output, tc.is_hidden, tc.cpu_time_limit, tc.memory_limit, tc.stack_limit,
+			IFNULL(tc.comparator, ''), tc.comparator_tolerance, IFNULL(g.name, '')
+		FROM test_case tc
+		LEFT JOIN test_group g ON g.id = tc.group_id
+		WHERE tc.question_id = ?
+		ORDER BY tc.id`, questionID)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving test cases: %w", err)
 	}
 	defer rows.Close()
 
-	// 5. Prepare test cases for evaluation
-	var testCases []struct {
-		Input          string
-		ExpectedOutput string
-		IsHidden       bool
-	}
-
 	for rows.Next() {
-		var tc struct {
-			Input          string
-			ExpectedOutput string
-			IsHidden       bool
-		}
-		if err := rows.Scan(&tc.Input, &tc.ExpectedOutput, &tc.IsHidden); err != nil {
+		var tc evalTestCase
+		if err := rows.Scan(&tc.Input, &tc.ExpectedOutput, &tc.IsHidden,
+			&tc.Limits.CPUTimeLimit, &tc.Limits.MemoryLimit, &tc.Limits.StackLimit,
+			&tc.Comparator.Type, &tc.Comparator.Tolerance, &tc.Group); err != nil {
 			return nil, fmt.Errorf("error scanning test case row: %w", err)
 		}
-		testCases = append(testCases, tc)
+		tc.Limits = tc.Limits.Or(questionLimits)
+		tc.Comparator = tc.Comparator.Or(questionComparator)
+		tc.Checker = checker
+		tc.Interactor = interactor
+		tc.Function = function
+		target.TestCases = append(target.TestCases, tc)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating test case rows: %w", err)
 	}
 
-	if len(testCases) == 0 {
+	if len(target.TestCases) == 0 {
 		return nil, errors.New("no test cases found for this question")
 	}
 
-	// 6. Setup Judge0 API
-	apiKey := os.Getenv("JUDGE0_API")
-	if apiKey == "" {
-		return nil, errors.New("Judge0 API key not found in environment")
+	if target.Groups, err = loadTestGroups(questionID); err != nil {
+		return nil, err
 	}
 
-	apiURL := "https://judge0-ce.p.rapidapi.com"
+	return target, nil
+}
+
+// runEvaluation runs the code against every test case. onProgress, when set,
+// is called with the index of the test case that just finished and the results
+// so far; cases that have not finished yet have status PENDING.
+func runEvaluation(executor Executor, code string, languageID int, testCases []evalTestCase, groups []TestGroup, onProgress func(i int, results []TestResult)) (*EvaluationResult, error) {
+	// Make sure a code execution backend is configured
+	if executor == nil {
+		return nil, errors.New("no code executor configured")
+	}
 
-	// 7. Evaluate code against each test case
 	result := EvaluationResult{
 		TotalTests:  len(testCases),
 		PassedTests: 0,
-		TestResults: make([]TestResult, 0, len(testCases)),
+		TestResults: make([]TestResult, len(testCases)),
+	}
+	for i, tc := range testCases {
+		result.TestResults[i] = redactedResult(tc, "PENDING", "")
 	}
 
-	// Run the first test case
-	if len(testCases) > 0 {
-		firstTestCase := testCases[0]
-		testResult, err := runTestCase(apiURL, apiKey, code, languageID,
-			firstTestCase.Input, firstTestCase.ExpectedOutput, firstTestCase.IsHidden)
-		if err != nil {
-			return nil, fmt.Errorf("error running test case: %w", err)
-		}
-
-		result.TestResults = append(result.TestResults, testResult)
+	var mu sync.Mutex
+	report := func(i int, testResult TestResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		result.TestResults[i] = testResult
 		if testResult.Status == "PASS" {
 			result.PassedTests++
 		}
+		if onProgress != nil {
+			onProgress(i, append([]TestResult(nil), result.TestResults...))
+		}
+	}
 
-		// If the first test case has an error, don't run the rest
-		if testResult.Error != "" {
-			// Add remaining test cases as NOT_EVALUATED
-			for i := 1; i < len(testCases); i++ {
-				tc := testCases[i]
-				notEvaluatedResult := TestResult{
-					Status:         "NOT_EVALUATED",
-					Input:          tc.Input,
-					ExpectedOutput: tc.ExpectedOutput,
-					IsHidden:       tc.IsHidden,
-					ActualOutput:   "",
-					Error:          "Not evaluated due to error in first test case",
-				}
-
-				// Don't include input and expected output for hidden test cases
-				if tc.IsHidden {
-					notEvaluatedResult.Input = ""
-					notEvaluatedResult.ExpectedOutput = ""
-				}
-
-				result.TestResults = append(result.TestResults, notEvaluatedResult)
-			}
-		} else {
-			// Process the remaining test cases only if the first one didn't have errors
+	// Function questions run the student's function inside a generated harness
+	if fn := testCases[0].Function; fn != nil {
+		harness, err := fn.Harness(code, languageID)
+		if err != nil {
+			result.TestResults[0] = redactedResult(testCases[0], "FAIL", err.Error())
+			result.TestResults[0].Verdict = VerdictCompilationError
 			for i := 1; i < len(testCases); i++ {
-				tc := testCases[i]
-				testResult, err := runTestCase(apiURL, apiKey, code, languageID, tc.Input, tc.ExpectedOutput, tc.IsHidden)
-				if err != nil {
-					return nil, fmt.Errorf("error running test case: %w", err)
-				}
-
-				result.TestResults = append(result.TestResults, testResult)
-				if testResult.Status == "PASS" {
-					result.PassedTests++
-				}
+				result.TestResults[i] = redactedResult(testCases[i], "NOT_EVALUATED", "Not evaluated due to error in first test case")
 			}
+			result.Status = "incorrect"
+			result.Groups = scoreGroups(groups, testCases, result.TestResults)
+			return &result, nil
+		}
+		code = harness
+	}
+
+	// Run the first test case
+	firstTestCase := testCases[0]
+	testResult, err := runTestCase(executor, code, languageID, firstTestCase)
+	if err != nil {
+		return nil, fmt.Errorf("error running test case: %w", err)
+	}
+	report(0, testResult)
+
+	// If the first test case couldn't run to completion, don't run the rest
+	if !testResult.completed() {
+		// Add remaining test cases as NOT_EVALUATED
+		for i := 1; i < len(testCases); i++ {
+			result.TestResults[i] = redactedResult(testCases[i], "NOT_EVALUATED", "Not evaluated due to error in first test case")
+		}
+	} else {
+		// Process the remaining test cases concurrently only if the first one didn't have errors
+		err := runTestCases(executor, code, languageID, testCases[1:], func(i int, testResult TestResult) {
+			report(i+1, testResult)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error running test case: %w", err)
 		}
 	}
 
-	// 8. Determine overall status
+	result.Groups = scoreGroups(groups, testCases, result.TestResults)
+
+	// Determine overall status
 	status := "incorrect"
 	if result.PassedTests == result.TotalTests {
 		status = "correct"
-	} else if result.PassedTests > 0 {
+	} else if result.PassedTests > 0 || result.credit() > 0 {
 		status = "partially_correct"
 	}
 	result.Status = status
 
-	// 9. Calculate score if flag is provided
-	score := 0
-	if calculateScore {
-		score = int((float64(result.PassedTests) / float64(result.TotalTests)) * 100)
+	return &result, nil
+}
+
+// recordEvaluation stores a graded submission on the attempt, combining its
+// score with earlier ones under the question's grading policy. Practice runs
+// (calculateScore false) don't touch the attempt table.
+func recordEvaluation(target *evaluationTarget, result *EvaluationResult, code string, calculateScore bool, submittedAt time.Time) error {
+	// 1. Update the attempt record only if this is a graded submission
+	if !calculateScore {
+		return nil
 	}
 
-	// 10. Handle timing using the retrieved start_time
-	endTime := time.Now()
-	var timeTaken int = 0
+	// 2. Handle timing. Late submissions are rejected before they are queued,
+	// so a graded submission made after the deadline is the sweeper grading
+	// the last code of an expired attempt; it counts as of the deadline.
+	endTime := submittedAt
+	timedOut := target.Deadline != nil && submittedAt.After(target.Deadline.Add(deadlineGrace))
+	if timedOut {
+		endTime = *target.Deadline
+		result.Status = "timed_out"
+	}
 
 	// Calculate time taken in seconds using the start_time from the existing attempt
-	if !startTime.IsZero() {
-		timeTaken = int(endTime.Sub(startTime).Seconds())
-
-		// Validate if time is within limits (with 10s relaxation)
-		// Convert timeLimit from minutes to seconds and add relaxation
-		maxAllowedTimeSeconds := (timeLimit * 60) + 10
-		if timeTaken > maxAllowedTimeSeconds {
-			status = "timed_out"
-			result.Status = status
-		}
+	var timeTaken int = 0
+	if !target.StartTime.IsZero() {
+		timeTaken = int(endTime.Sub(target.StartTime).Seconds())
 	}
 
-	// 11. Update the attempt record only if this is a final submission
-	if calculateScore {
-		// Final submission - update all fields including end_time
-		_, err = Con.Exec(`
-			UPDATE attempt 
-			SET submitted_code = ?, status = ?, score = ?, end_time = ?, time_taken_seconds = ?, attempted = ?
-			WHERE id = ?`,
-			code, status, score, endTime, timeTaken, calculateScore, attemptID)
-		if err != nil {
-			return nil, fmt.Errorf("error updating attempt: %w", err)
+	var groupScores []byte
+	if len(result.Groups) > 0 {
+		var err error
+		if groupScores, err = json.Marshal(result.Groups); err != nil {
+			return fmt.Errorf("error encoding group scores: %w", err)
 		}
 	}
-	// No else block - we don't update the attempt table at all when calculateScore is false
 
-	return &result, nil
+	// Lock the attempt so graded submissions finishing together are counted in order
+	tx, err := Con.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var progress attemptProgress
+	err = tx.QueryRow(`
+		SELECT IFNULL(score, 0), graded_submissions, wrong_submissions, attempted
+		FROM attempt WHERE id = ? FOR UPDATE`, target.AttemptID).Scan(
+		&progress.Score, &progress.Graded, &progress.Wrong, &progress.Attempted)
+	if err != nil {
+		return fmt.Errorf("error loading attempt: %w", err)
+	}
+
+	// Another graded submission for the same attempt closed it first
+	if progress.Attempted {
+		return errors.New("this attempt has already been submitted for grading")
+	}
+
+	progress = target.Grading.apply(progress, result.score(), result.Status == "correct")
+	if timedOut {
+		progress.Attempted = true
+	}
+
+	// The attempt stays in progress while graded submissions remain
+	status := "in_progress"
+	var attemptEnd *time.Time
+	if progress.Attempted {
+		status = result.Status
+		attemptEnd = &endTime
+	}
+
+	_, err = tx.Exec(`
+		UPDATE attempt 
+		SET submitted_code = ?, status = ?, score = ?, end_time = ?, time_taken_seconds = ?, attempted = ?, group_scores = ?,
+			graded_submissions = ?, wrong_submissions = ?
+		WHERE id = ?`,
+		code, status, progress.Score, attemptEnd, timeTaken, progress.Attempted, groupScores,
+		progress.Graded, progress.Wrong, target.AttemptID)
+	if err != nil {
+		return fmt.Errorf("error updating attempt: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing attempt: %w", err)
+	}
+
+	left := target.Grading.MaxSubmissions - progress.Graded
+	if progress.Attempted {
+		left = 0
+	}
+	result.AttemptScore = &progress.Score
+	result.SubmissionsLeft = &left
+	return nil
+}
+
+// redactedResult builds a result for a test case that produced no output,
+// leaving out the input and expected output of hidden test cases
+func redactedResult(tc evalTestCase, status, message string) TestResult {
+	result := TestResult{
+		Status:         status,
+		Input:          tc.Input,
+		ExpectedOutput: tc.ExpectedOutput,
+		IsHidden:       tc.IsHidden,
+		ActualOutput:   "",
+		Error:          message,
+	}
+
+	// Don't include input and expected output for hidden test cases
+	if tc.IsHidden {
+		result.Input = ""
+		result.ExpectedOutput = ""
+	}
+
+	return result
+}
+
+// completed reports whether the program ran to the end and produced output
+// that was judged, whatever the judgement was
+func (r TestResult) completed() bool {
+	switch r.Verdict {
+	case VerdictAccepted, VerdictWrongAnswer, VerdictPartial:
+		return true
+	}
+	return false
+}
+
+// evalTestCase is a test case as loaded for evaluation
+type evalTestCase struct {
+	Input          string
+	ExpectedOutput string
+	IsHidden       bool
+	// Limits and Comparator already include the question defaults
+	Limits     ResourceLimits
+	Comparator Comparator
+	// Checker, when set, judges the output instead of Comparator
+	Checker *Checker
+	// Interactor, when set, talks to the submission and gives the verdict
+	Interactor *Interactor
+	// Function, when set, is the signature the submission implements. The
+	// code run is then its harness and the output is a canonical JSON value.
+	Function *FunctionSignature
+	Group    string
 }
 
-// runTestCase executes a single test case against the Judge0 API
-func runTestCase(apiURL, apiKey, code string, languageID int, input, expectedOutput string, isHidden bool) (TestResult, error) {
-	submission := Judge0Submission{
+func (tc evalTestCase) request(code string, languageID int) ExecutionRequest {
+	return ExecutionRequest{
 		SourceCode: code,
 		LanguageID: languageID,
-		Stdin:      input,
+		Stdin:      tc.Input,
+		Limits:     tc.Limits.executionLimits(),
 	}
+}
 
-	jsonData, err := json.Marshal(submission)
-	if err != nil {
-		return TestResult{}, fmt.Errorf("error marshaling submission: %w", err)
+// runTestCase executes a single test case on the given executor
+func runTestCase(executor Executor, code string, languageID int, tc evalTestCase) (TestResult, error) {
+	if tc.Interactor != nil {
+		return runInteractive(executor, code, languageID, tc)
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/submissions", apiURL), bytes.NewBuffer(jsonData))
+	result, err := executeLimited(executor, tc.request(code, languageID))
 	if err != nil {
-		return TestResult{}, fmt.Errorf("error creating request: %w", err)
+		return TestResult{}, err
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-RapidAPI-Host", "judge0-ce.p.rapidapi.com")
-	req.Header.Set("X-RapidAPI-Key", apiKey)
+	testResult := gradeTestCase(result, tc)
+	if tc.Checker == nil || result.StatusID != StatusAccepted {
+		return testResult, nil
+	}
 
-	// Add query parameters
-	q := req.URL.Query()
-	q.Add("base64_encoded", "false")
-	q.Add("wait", "true")
-	req.URL.RawQuery = q.Encode()
+	checkerRun, err := executeLimited(executor, tc.Checker.request(tc, result.Stdout))
+	if err != nil {
+		return TestResult{}, fmt.Errorf("error running checker: %w", err)
+	}
+	return applyChecker(testResult, checkerRun), nil
+}
 
-	// Create a custom HTTP client with a modified TLS configuration that accepts all certificates
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, // Skip certificate verification - use with caution
-			},
-		},
+// runTestCases executes the test cases concurrently. onResult is called with
+// the index and result of each test case as it finishes, never concurrently.
+func runTestCases(executor Executor, code string, languageID int, testCases []evalTestCase, onResult func(i int, result TestResult)) error {
+	if len(testCases) > 0 && testCases[0].Interactor != nil {
+		var mu sync.Mutex
+		return forEachConcurrent(len(testCases), func(i int) error {
+			testResult, err := runInteractive(executor, code, languageID, testCases[i])
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			onResult(i, testResult)
+			return nil
+		})
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return TestResult{}, fmt.Errorf("error sending request: %w", err)
+	reqs := make([]ExecutionRequest, len(testCases))
+	for i, tc := range testCases {
+		reqs[i] = tc.request(code, languageID)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return TestResult{}, fmt.Errorf("error reading response: %w", err)
+	// Outputs that a checker has to judge are collected and checked in a second pass
+	var checked []int
+	var pending = map[int]ExecutionResult{}
+	err := executeAll(executor, reqs, func(i int, result ExecutionResult) {
+		tc := testCases[i]
+		if tc.Checker != nil && result.StatusID == StatusAccepted {
+			checked = append(checked, i)
+			pending[i] = result
+			return
+		}
+		onResult(i, gradeTestCase(result, tc))
+	})
+	if err != nil || len(checked) == 0 {
+		return err
 	}
 
-	var result Judge0Response
-	if err := json.Unmarshal(body, &result); err != nil {
-		return TestResult{}, fmt.Errorf("error unmarshaling response: %w", err)
+	checkerReqs := make([]ExecutionRequest, len(checked))
+	for j, i := range checked {
+		checkerReqs[j] = testCases[i].Checker.request(testCases[i], pending[i].Stdout)
 	}
 
+	err = executeAll(executor, checkerReqs, func(j int, checkerRun ExecutionResult) {
+		i := checked[j]
+		onResult(i, applyChecker(gradeTestCase(pending[i], testCases[i]), checkerRun))
+	})
+	if err != nil {
+		return fmt.Errorf("error running checker: %w", err)
+	}
+	return nil
+}
+
+// gradeTestCase compares an execution result with the expected output
+func gradeTestCase(result ExecutionResult, tc evalTestCase) TestResult {
 	// Process the result
 	actualOutput := strings.TrimSpace(result.Stdout)
-	expectedOutput = strings.TrimSpace(expectedOutput)
+	expectedOutput := strings.TrimSpace(tc.ExpectedOutput)
 
 	// Create the test result
 	testResult := TestResult{
 		ActualOutput: actualOutput,
-		IsHidden:     isHidden,
+		IsHidden:     tc.IsHidden,
+		Time:         result.Time,
+		Memory:       result.MemoryKB,
 	}
 
 	// Check for compilation or runtime errors
-	if result.Status.ID != 3 { // 3 is the status ID for "Accepted" in Judge0
+	if result.StatusID != StatusAccepted {
 		// There was some error
 		errorOutput := ""
 
@@ -361,26 +640,72 @@ func runTestCase(apiURL, apiKey, code string, languageID int, input, expectedOut
 		} else if result.Message != "" {
 			errorOutput = result.Message
 		} else {
-			errorOutput = "Execution error: " + result.Status.Description
+			errorOutput = "Execution error: " + result.StatusDescription
 		}
 
 		testResult.Status = "FAIL"
+		testResult.Verdict = errorVerdict(result, tc.Limits)
 		testResult.Error = errorOutput
-		return testResult, nil
+		return testResult
 	}
 
 	// No errors, check if output matches expected
-	if actualOutput == expectedOutput {
+	matched := false
+	if tc.Function != nil {
+		var ok bool
+		actualOutput, ok = tc.Function.returnValue(result.Stdout)
+		matched = ok && tc.Function.match(tc.Comparator, actualOutput, expectedOutput)
+	} else {
+		matched = tc.Comparator.Match(actualOutput, expectedOutput)
+	}
+	testResult.ActualOutput = actualOutput
+
+	if matched {
 		testResult.Status = "PASS"
+		testResult.Verdict = VerdictAccepted
+		testResult.Score = 1
 	} else {
 		testResult.Status = "FAIL"
+		testResult.Verdict = VerdictWrongAnswer
 	}
 
 	// Only include input and expected output for non-hidden test cases
-	if !isHidden {
-		testResult.Input = input
+	if !tc.IsHidden {
+		testResult.Input = tc.Input
 		testResult.ExpectedOutput = expectedOutput
 	}
 
-	return testResult, nil
+	return testResult
+}
+
+// memoryErrorMarkers are printed by common runtimes when an allocation fails
+var memoryErrorMarkers = []string{
+	"MemoryError",
+	"std::bad_alloc",
+	"OutOfMemoryError",
+	"JavaScript heap out of memory",
+	"out of memory",
+}
+
+// errorVerdict classifies a run that did not finish with status Accepted
+func errorVerdict(result ExecutionResult, limits ResourceLimits) string {
+	switch {
+	case result.StatusID == StatusCompilationError:
+		return VerdictCompilationError
+	case result.StatusID == StatusTimeLimitExceeded:
+		return VerdictTimeLimitExceeded
+	case result.StatusID >= StatusRuntimeSIGSEGV && result.StatusID <= StatusRuntimeOther:
+		// Neither Judge0 nor rlimits report memory exhaustion directly. The
+		// program either crashes near the limit or its runtime says so.
+		if limits.MemoryLimit != nil && result.MemoryKB >= *limits.MemoryLimit*95/100 {
+			return VerdictMemoryLimitExceeded
+		}
+		for _, marker := range memoryErrorMarkers {
+			if strings.Contains(result.Stderr, marker) {
+				return VerdictMemoryLimitExceeded
+			}
+		}
+		return VerdictRuntimeError
+	}
+	return VerdictInternalError
 }
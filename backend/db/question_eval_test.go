@@ -0,0 +1,298 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func memoryLimit(kb int) *int { return &kb }
+
+func TestGradeTestCase(t *testing.T) {
+	limited := ResourceLimits{MemoryLimit: memoryLimit(65536)}
+
+	tests := []struct {
+		name        string
+		result      ExecutionResult
+		tc          evalTestCase
+		wantStatus  string
+		wantVerdict string
+		wantError   string
+	}{
+		{
+			name:        "accepted",
+			result:      ExecutionResult{StatusID: StatusAccepted, Stdout: "42\n"},
+			tc:          evalTestCase{ExpectedOutput: "42"},
+			wantStatus:  "PASS",
+			wantVerdict: VerdictAccepted,
+		},
+		{
+			name:        "wrong answer",
+			result:      ExecutionResult{StatusID: StatusAccepted, Stdout: "41\n"},
+			tc:          evalTestCase{ExpectedOutput: "42"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictWrongAnswer,
+		},
+		{
+			name:        "comparator of the test case",
+			result:      ExecutionResult{StatusID: StatusAccepted, Stdout: "3.14159\n"},
+			tc:          evalTestCase{ExpectedOutput: "3.1416", Comparator: Comparator{Type: ComparatorFloatAbs, Tolerance: tolerance(1e-3)}},
+			wantStatus:  "PASS",
+			wantVerdict: VerdictAccepted,
+		},
+		{
+			name:        "compilation error",
+			result:      ExecutionResult{StatusID: StatusCompilationError, CompileOutput: "main.c:1: error", Stderr: "ignored"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictCompilationError,
+			wantError:   "main.c:1: error",
+		},
+		{
+			name:        "time limit exceeded",
+			result:      ExecutionResult{StatusID: StatusTimeLimitExceeded, StatusDescription: "Time Limit Exceeded"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictTimeLimitExceeded,
+			wantError:   "Execution error: Time Limit Exceeded",
+		},
+		{
+			name:        "runtime error",
+			result:      ExecutionResult{StatusID: StatusRuntimeSIGSEGV, Stderr: "Segmentation fault", MemoryKB: 1024},
+			tc:          evalTestCase{Limits: limited},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictRuntimeError,
+			wantError:   "Segmentation fault",
+		},
+		{
+			name:        "crash near the memory limit",
+			result:      ExecutionResult{StatusID: StatusRuntimeSIGABRT, MemoryKB: 65000, Message: "Aborted"},
+			tc:          evalTestCase{Limits: limited},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictMemoryLimitExceeded,
+			wantError:   "Aborted",
+		},
+		{
+			name:        "runtime reports out of memory",
+			result:      ExecutionResult{StatusID: StatusRuntimeNZEC, Stderr: "Traceback (most recent call last):\nMemoryError"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictMemoryLimitExceeded,
+			wantError:   "Traceback (most recent call last):\nMemoryError",
+		},
+		{
+			name:        "executor internal error",
+			result:      ExecutionResult{StatusID: StatusInternalError, StatusDescription: "Internal Error"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictInternalError,
+			wantError:   "Execution error: Internal Error",
+		},
+		{
+			name:        "exec format error",
+			result:      ExecutionResult{StatusID: StatusExecFormatError, Message: "Exec format error"},
+			wantStatus:  "FAIL",
+			wantVerdict: VerdictInternalError,
+			wantError:   "Exec format error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := gradeTestCase(tt.result, tt.tc)
+			if got.Status != tt.wantStatus || got.Verdict != tt.wantVerdict {
+				t.Errorf("got %s %s, want %s %s", got.Status, got.Verdict, tt.wantStatus, tt.wantVerdict)
+			}
+			if got.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", got.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestGradeTestCaseHidesHiddenCases(t *testing.T) {
+	tc := evalTestCase{Input: "secret input", ExpectedOutput: "secret output", IsHidden: true}
+
+	got := gradeTestCase(ExecutionResult{StatusID: StatusAccepted, Stdout: "wrong"}, tc)
+	if got.Input != "" || got.ExpectedOutput != "" || !got.IsHidden {
+		t.Errorf("hidden test case leaked its data: %+v", got)
+	}
+
+	tc.IsHidden = false
+	got = gradeTestCase(ExecutionResult{StatusID: StatusAccepted, Stdout: "wrong"}, tc)
+	if got.Input != "secret input" || got.ExpectedOutput != "secret output" {
+		t.Errorf("visible test case should show its data: %+v", got)
+	}
+}
+
+// echoCases are test cases for a program that echoes its input
+func echoCases(outputs ...string) []evalTestCase {
+	testCases := make([]evalTestCase, len(outputs))
+	for i, output := range outputs {
+		testCases[i] = evalTestCase{Input: output, ExpectedOutput: output}
+	}
+	return testCases
+}
+
+func TestRunEvaluation(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      func(req ExecutionRequest) (ExecutionResult, error)
+		testCases    []evalTestCase
+		wantStatus   string
+		wantPassed   int
+		wantVerdicts []string
+		wantRuns     int
+	}{
+		{
+			name:         "all correct",
+			testCases:    echoCases("1", "2", "3"),
+			wantStatus:   "correct",
+			wantPassed:   3,
+			wantVerdicts: []string{VerdictAccepted, VerdictAccepted, VerdictAccepted},
+			wantRuns:     3,
+		},
+		{
+			name: "wrong answer keeps going",
+			handler: func(req ExecutionRequest) (ExecutionResult, error) {
+				return ExecutionResult{StatusID: StatusAccepted, Stdout: "2"}, nil
+			},
+			testCases:    echoCases("1", "2", "3"),
+			wantStatus:   "partially_correct",
+			wantPassed:   1,
+			wantVerdicts: []string{VerdictWrongAnswer, VerdictAccepted, VerdictWrongAnswer},
+			wantRuns:     3,
+		},
+		{
+			name: "compilation error stops the run",
+			handler: func(req ExecutionRequest) (ExecutionResult, error) {
+				return ExecutionResult{StatusID: StatusCompilationError, CompileOutput: "syntax error"}, nil
+			},
+			testCases:    echoCases("1", "2", "3"),
+			wantStatus:   "incorrect",
+			wantVerdicts: []string{VerdictCompilationError, "", ""},
+			wantRuns:     1,
+		},
+		{
+			name: "time limit on the first case stops the run",
+			handler: func(req ExecutionRequest) (ExecutionResult, error) {
+				return ExecutionResult{StatusID: StatusTimeLimitExceeded}, nil
+			},
+			testCases:    echoCases("1", "2"),
+			wantStatus:   "incorrect",
+			wantVerdicts: []string{VerdictTimeLimitExceeded, ""},
+			wantRuns:     1,
+		},
+		{
+			name: "runtime error after the first case",
+			handler: func(req ExecutionRequest) (ExecutionResult, error) {
+				if req.Stdin == "2" {
+					return ExecutionResult{StatusID: StatusRuntimeNZEC, Stderr: "exit status 1"}, nil
+				}
+				return ExecutionResult{StatusID: StatusAccepted, Stdout: req.Stdin}, nil
+			},
+			testCases:    echoCases("1", "2", "3"),
+			wantStatus:   "partially_correct",
+			wantPassed:   2,
+			wantVerdicts: []string{VerdictAccepted, VerdictRuntimeError, VerdictAccepted},
+			wantRuns:     3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &FakeExecutor{Handler: tt.handler}
+			result, err := runEvaluation(executor, "code", 71, tt.testCases, nil, nil)
+			if err != nil {
+				t.Fatalf("runEvaluation: %v", err)
+			}
+
+			if result.Status != tt.wantStatus || result.PassedTests != tt.wantPassed {
+				t.Errorf("got %s with %d passed, want %s with %d", result.Status, result.PassedTests, tt.wantStatus, tt.wantPassed)
+			}
+			for i, want := range tt.wantVerdicts {
+				got := result.TestResults[i]
+				if got.Verdict != want {
+					t.Errorf("test case %d verdict = %q, want %q", i+1, got.Verdict, want)
+				}
+				if want == "" && got.Status != "NOT_EVALUATED" {
+					t.Errorf("test case %d status = %s, want NOT_EVALUATED", i+1, got.Status)
+				}
+			}
+			if runs := len(executor.Requests()); runs != tt.wantRuns {
+				t.Errorf("executor ran %d times, want %d", runs, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestRunEvaluationWithChecker(t *testing.T) {
+	checker := &Checker{Code: "checker", LanguageID: 71}
+	executor := &FakeExecutor{Handler: func(req ExecutionRequest) (ExecutionResult, error) {
+		if req.SourceCode != "checker" {
+			return ExecutionResult{StatusID: StatusAccepted, Stdout: "any order"}, nil
+		}
+		// The contestant output is the last section of the checker's stdin
+		if strings.HasSuffix(req.Stdin, "any order") {
+			return ExecutionResult{StatusID: StatusAccepted, Stdout: "partial 0.5\nhalf the pairs"}, nil
+		}
+		return ExecutionResult{StatusID: StatusAccepted, Stdout: "reject"}, nil
+	}}
+
+	testCases := echoCases("1", "2")
+	for i := range testCases {
+		testCases[i].Checker = checker
+	}
+
+	result, err := runEvaluation(executor, "code", 71, testCases, nil, nil)
+	if err != nil {
+		t.Fatalf("runEvaluation: %v", err)
+	}
+	for i, got := range result.TestResults {
+		if got.Verdict != VerdictPartial || got.Score != 0.5 || got.CheckerMessage != "half the pairs" {
+			t.Errorf("test case %d = %s %v %q, want partial credit from the checker", i+1, got.Verdict, got.Score, got.CheckerMessage)
+		}
+	}
+	if result.Status != "partially_correct" || result.score() != 50 {
+		t.Errorf("got %s scoring %d, want partially_correct scoring 50", result.Status, result.score())
+	}
+	// Two submission runs and two checker runs
+	if runs := len(executor.Requests()); runs != 4 {
+		t.Errorf("executor ran %d times, want 4", runs)
+	}
+}
+
+func TestRunEvaluationProgress(t *testing.T) {
+	var reported []int
+	var pending int
+	onProgress := func(i int, results []TestResult) {
+		reported = append(reported, i)
+		for _, r := range results {
+			if r.Status == "PENDING" {
+				pending++
+			}
+		}
+	}
+
+	if _, err := runEvaluation(&FakeExecutor{}, "code", 71, echoCases("1", "2", "3"), nil, onProgress); err != nil {
+		t.Fatalf("runEvaluation: %v", err)
+	}
+	if len(reported) != 3 || reported[0] != 0 {
+		t.Errorf("progress reported for %v, want every test case starting with the first", reported)
+	}
+	// 2 pending after the first case, 1 after the second, 0 after the last
+	if pending != 3 {
+		t.Errorf("saw %d pending results across progress reports, want 3", pending)
+	}
+}
+
+func TestRunEvaluationExecutorError(t *testing.T) {
+	executor := &FakeExecutor{Handler: func(req ExecutionRequest) (ExecutionResult, error) {
+		return ExecutionResult{}, unavailableError{errors.New("connection refused")}
+	}}
+
+	_, err := runEvaluation(executor, "code", 71, echoCases("1"), nil, nil)
+	if !isExecutorUnavailable(err) {
+		t.Errorf("error = %v, want the executor to be reported unavailable", err)
+	}
+
+	if _, err := runEvaluation(nil, "code", 71, echoCases("1"), nil, nil); err == nil {
+		t.Error("expected an error without an executor")
+	}
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -9,14 +10,18 @@ import (
 
 // QuestionAttemptStatus represents the status of a student's attempt on a question
 type QuestionAttemptStatus struct {
-	AttemptID     int64      `json:"attemptId"`
-	Status        string     `json:"status"`
-	Score         int        `json:"score"`
-	StartTime     *time.Time `json:"startTime"`
-	EndTime       *time.Time `json:"endTime"`
-	TimeTaken     int        `json:"timeTaken"`
-	SubmittedCode string     `json:"submittedCode"`
-	IsAttempted   bool       `json:"isAttempted"`
+	AttemptID     int64        `json:"attemptId"`
+	Status        string       `json:"status"`
+	Score         int          `json:"score"`
+	StartTime     *time.Time   `json:"startTime"`
+	EndTime       *time.Time   `json:"endTime"`
+	TimeTaken     int          `json:"timeTaken"`
+	SubmittedCode string       `json:"submittedCode"`
+	IsAttempted   bool         `json:"isAttempted"`
+	Groups        []GroupScore `json:"groups,omitempty"` // Per-group breakdown of the graded submission
+	// Graded submissions made so far; the attempt stays open until it is
+	// fully correct or the question's maximum is reached
+	GradedSubmissions int `json:"gradedSubmissions"`
 }
 
 // StudentAttemptStatus represents a student and their attempt status
@@ -39,33 +44,16 @@ type BatchQuestionStatus struct {
 
 // GetQuestionStatus fetches the attempt status of all students for a question in a batch
 // This is a teacher-only endpoint
-func GetQuestionStatus(userID, batchID, questionID int64) (*BatchQuestionStatus, error) {
-	// Check if user is a teacher
-	var teacherID int64
-	err := Con.QueryRow("SELECT id FROM teacher WHERE user_id = ?", userID).Scan(&teacherID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("only teachers can access this endpoint")
-		}
-		return nil, fmt.Errorf("error checking teacher status: %w", err)
-	}
-
-	// Verify batch ownership
-	var batchOwned bool
+func GetQuestionStatus(batchID, questionID int64) (*BatchQuestionStatus, error) {
 	var batchName string
-	err = Con.QueryRow("SELECT EXISTS(SELECT 1 FROM batch WHERE id = ? AND teacher_id = ?), name FROM batch WHERE id = ?",
-		batchID, teacherID, batchID).Scan(&batchOwned, &batchName)
-	if err != nil {
-		return nil, fmt.Errorf("error checking batch ownership: %w", err)
-	}
-	if !batchOwned {
-		return nil, errors.New("you don't have permission to access this batch")
+	if err := Con.QueryRow("SELECT name FROM batch WHERE id = ?", batchID).Scan(&batchName); err != nil {
+		return nil, fmt.Errorf("error retrieving batch name: %w", err)
 	}
 
 	// Check if question exists in the batch
 	var questionExists bool
 	var questionTitle string
-	err = Con.QueryRow("SELECT EXISTS(SELECT 1 FROM question WHERE id = ? AND batch_id = ?), title FROM question WHERE id = ?",
+	err := Con.QueryRow("SELECT EXISTS(SELECT 1 FROM question WHERE id = ? AND batch_id = ?), title FROM question WHERE id = ?",
 		questionID, batchID, questionID).Scan(&questionExists, &questionTitle)
 	if err != nil {
 		return nil, fmt.Errorf("error checking question: %w", err)
@@ -103,16 +91,18 @@ func GetQuestionStatus(userID, batchID, questionID int64) (*BatchQuestionStatus,
 		}
 
 		// Get attempt details for each student
+		var groupScores sql.NullString
 		err = Con.QueryRow(`
 			SELECT id, status, score, start_time, end_time, 
-				   time_taken_seconds, submitted_code, attempted
+				   time_taken_seconds, submitted_code, attempted, group_scores, graded_submissions
 			FROM attempt
 			WHERE student_id = ? AND question_id = ?
 			ORDER BY id DESC LIMIT 1
 		`, student.StudentID, questionID).Scan(
 			&student.Attempt.AttemptID, &student.Attempt.Status, &student.Attempt.Score,
 			&student.Attempt.StartTime, &student.Attempt.EndTime, &student.Attempt.TimeTaken,
-			&student.Attempt.SubmittedCode, &student.Attempt.IsAttempted,
+			&student.Attempt.SubmittedCode, &student.Attempt.IsAttempted, &groupScores,
+			&student.Attempt.GradedSubmissions,
 		)
 
 		// If there's no attempt record, we use the default "not_attempted" status
@@ -120,6 +110,12 @@ func GetQuestionStatus(userID, batchID, questionID int64) (*BatchQuestionStatus,
 			return nil, fmt.Errorf("error retrieving attempt details for student %d: %w", student.StudentID, err)
 		}
 
+		if groupScores.Valid && groupScores.String != "" {
+			if err := json.Unmarshal([]byte(groupScores.String), &student.Attempt.Groups); err != nil {
+				return nil, fmt.Errorf("error decoding group scores for student %d: %w", student.StudentID, err)
+			}
+		}
+
 		students = append(students, student)
 	}
 
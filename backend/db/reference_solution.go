@@ -0,0 +1,126 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ReferenceSolution is the teacher's own solution to a question. Test cases
+// given without an expected output get the output of the reference solution,
+// and every other test case must be accepted when it is judged like a
+// submission.
+type ReferenceSolution struct {
+	Code       string `json:"code"`
+	LanguageID int    `json:"language_id"`
+}
+
+// Validate checks that the reference solution can be run
+func (r *ReferenceSolution) Validate() error {
+	if strings.TrimSpace(r.Code) == "" {
+		return errors.New("reference solution code is required")
+	}
+	if r.LanguageID <= 0 {
+		return errors.New("reference solution language_id is required")
+	}
+	return nil
+}
+
+// referenceQuestion holds the question settings the reference solution runs with
+type referenceQuestion struct {
+	Limits     ResourceLimits
+	Comparator Comparator
+	Checker    *Checker
+	Function   *FunctionSignature
+}
+
+// complete runs the reference solution on every test case. Empty expected
+// outputs are filled in with its output, and the other test cases must pass.
+func (r *ReferenceSolution) complete(q referenceQuestion, testCases []TestCase) ([]TestCase, error) {
+	if Exec == nil {
+		return nil, errors.New("no code executor configured")
+	}
+
+	code := r.Code
+	if q.Function != nil {
+		harness, err := q.Function.Harness(code, r.LanguageID)
+		if err != nil {
+			return nil, fmt.Errorf("reference solution: %w", err)
+		}
+		code = harness
+	}
+
+	evalCases := make([]evalTestCase, len(testCases))
+	reqs := make([]ExecutionRequest, len(testCases))
+	for i, tc := range testCases {
+		evalCases[i] = evalTestCase{
+			Input:          tc.InputText,
+			ExpectedOutput: tc.ExpectedOutput,
+			Limits:         tc.Limits.Or(q.Limits),
+			Comparator:     tc.Comparator.Or(q.Comparator),
+			Checker:        q.Checker,
+			Function:       q.Function,
+		}
+		reqs[i] = evalCases[i].request(code, r.LanguageID)
+	}
+
+	results := make([]ExecutionResult, len(testCases))
+	err := executeAll(Exec, reqs, func(i int, result ExecutionResult) {
+		results[i] = result
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error running reference solution: %w", err)
+	}
+
+	testCases = slices.Clone(testCases)
+	for i, result := range results {
+		if result.StatusID != StatusAccepted {
+			return nil, fmt.Errorf("test case %d: reference solution failed with verdict %s",
+				i+1, errorVerdict(result, evalCases[i].Limits))
+		}
+
+		if testCases[i].ExpectedOutput == "" {
+			output := strings.TrimSpace(result.Stdout)
+			if q.Function != nil {
+				var ok bool
+				if output, ok = q.Function.returnValue(result.Stdout); !ok {
+					return nil, fmt.Errorf("test case %d: reference solution did not return a %s", i+1, q.Function.ReturnType)
+				}
+			}
+			testCases[i].ExpectedOutput = output
+			continue
+		}
+
+		testResult := gradeTestCase(result, evalCases[i])
+		if q.Checker != nil {
+			checkerRun, err := executeLimited(Exec, q.Checker.request(evalCases[i], result.Stdout))
+			if err != nil {
+				return nil, fmt.Errorf("error running checker: %w", err)
+			}
+			testResult = applyChecker(testResult, checkerRun)
+		}
+		if testResult.Status != "PASS" {
+			return nil, fmt.Errorf("test case %d: expected output does not match the reference solution's output %q",
+				i+1, testResult.ActualOutput)
+		}
+	}
+	return testCases, nil
+}
+
+// loadReferenceSolution returns the reference solution of a question, or nil
+// if it has none
+func loadReferenceSolution(questionID int64) (*ReferenceSolution, error) {
+	var code sql.NullString
+	var languageID sql.NullInt64
+	err := Con.QueryRow("SELECT reference_code, reference_language_id FROM question WHERE id = ?", questionID).Scan(
+		&code, &languageID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading reference solution: %w", err)
+	}
+	if !code.Valid || code.String == "" {
+		return nil, nil
+	}
+	return &ReferenceSolution{Code: code.String, LanguageID: int(languageID.Int64)}, nil
+}
@@ -0,0 +1,469 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Rejudge jobs run one at a time so they never starve the submission workers
+var rejudgeQueue chan int64
+
+// RejudgeScope selects the attempts a rejudge job re-runs
+type RejudgeScope struct {
+	BatchID    int64
+	QuestionID int64 // 0 for every question of the batch
+	StudentID  int64 // 0 for every student of the batch
+}
+
+// RejudgeJob is a background rejudge and its progress
+type RejudgeJob struct {
+	ID         int64           `json:"id"`
+	BatchID    int64           `json:"batchId"`
+	QuestionID *int64          `json:"questionId"`
+	StudentID  *int64          `json:"studentId"`
+	Status     string          `json:"status"` // queued, running, done or failed
+	Total      int             `json:"total"`
+	Processed  int             `json:"processed"`
+	Changed    int             `json:"changed"` // Attempts whose score or status changed
+	Failed     int             `json:"failed"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	StartedAt  *time.Time      `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt"`
+	Results    []RejudgeResult `json:"results"`
+}
+
+// RejudgeResult is the old and new grade of one rejudged attempt
+type RejudgeResult struct {
+	AttemptID  int64  `json:"attemptId"`
+	StudentID  int64  `json:"studentId"`
+	Username   string `json:"username"`
+	QuestionID int64  `json:"questionId"`
+	OldScore   int    `json:"oldScore"`
+	NewScore   *int   `json:"newScore"` // nil when the rejudge of this attempt failed
+	OldStatus  string `json:"oldStatus"`
+	NewStatus  string `json:"newStatus,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// StartRejudgeWorker starts the rejudge worker and requeues the jobs a restart
+// interrupted. Attempts they already rejudged are not run again.
+func StartRejudgeWorker() error {
+	if _, err := Con.Exec("UPDATE rejudge_job SET status = ? WHERE status = ?", SubmissionQueued, SubmissionRunning); err != nil {
+		return fmt.Errorf("error recovering running rejudge jobs: %w", err)
+	}
+
+	rows, err := Con.Query("SELECT id FROM rejudge_job WHERE status = ? ORDER BY id", SubmissionQueued)
+	if err != nil {
+		return fmt.Errorf("error retrieving queued rejudge jobs: %w", err)
+	}
+	var pending []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning rejudge job: %w", err)
+		}
+		pending = append(pending, id)
+	}
+	rows.Close()
+
+	rejudgeQueue = make(chan int64, 256)
+	go func() {
+		for jobID := range rejudgeQueue {
+			runRejudgeJob(jobID)
+		}
+	}()
+	for _, id := range pending {
+		queueRejudge(id)
+	}
+	return nil
+}
+
+// queueRejudge hands a job to the worker without blocking the caller
+func queueRejudge(jobID int64) {
+	select {
+	case rejudgeQueue <- jobID:
+	default:
+		go func() { rejudgeQueue <- jobID }()
+	}
+}
+
+// StartRejudge creates a rejudge job for the scope and queues it. This is a
+// teacher-only endpoint.
+func StartRejudge(userID int64, scope RejudgeScope) (*RejudgeJob, error) {
+	if rejudgeQueue == nil {
+		return nil, errors.New("rejudge worker is not running")
+	}
+
+	batchOwned, err := TeacherOwnsBatch(userID, scope.BatchID)
+	if err != nil {
+		return nil, err
+	}
+	if !batchOwned {
+		return nil, errors.New("you don't have permission to access this batch")
+	}
+
+	var questionID, studentID *int64
+	if scope.QuestionID != 0 {
+		var exists bool
+		err = Con.QueryRow("SELECT EXISTS(SELECT 1 FROM question WHERE id = ? AND batch_id = ?)",
+			scope.QuestionID, scope.BatchID).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("error checking question: %w", err)
+		}
+		if !exists {
+			return nil, errors.New("question not found in this batch")
+		}
+		questionID = &scope.QuestionID
+	}
+	if scope.StudentID != 0 {
+		var exists bool
+		err = Con.QueryRow("SELECT EXISTS(SELECT 1 FROM batch_student WHERE batch_id = ? AND student_id = ?)",
+			scope.BatchID, scope.StudentID).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("error checking student: %w", err)
+		}
+		if !exists {
+			return nil, errors.New("student not found in this batch")
+		}
+		studentID = &scope.StudentID
+	}
+
+	result, err := Con.Exec(`
+		INSERT INTO rejudge_job (batch_id, question_id, student_id, requested_by, status)
+		VALUES (?, ?, ?, ?, ?)`,
+		scope.BatchID, questionID, studentID, userID, SubmissionQueued)
+	if err != nil {
+		return nil, fmt.Errorf("error creating rejudge job: %w", err)
+	}
+
+	jobID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error getting rejudge job ID: %w", err)
+	}
+
+	queueRejudge(jobID)
+	return &RejudgeJob{
+		ID:         jobID,
+		BatchID:    scope.BatchID,
+		QuestionID: questionID,
+		StudentID:  studentID,
+		Status:     SubmissionQueued,
+		CreatedAt:  time.Now(),
+		Results:    []RejudgeResult{},
+	}, nil
+}
+
+// GetRejudgeJob returns the progress of a rejudge job and the attempts it has
+// rejudged so far. This is a teacher-only endpoint.
+func GetRejudgeJob(userID, jobID int64) (*RejudgeJob, error) {
+	var job RejudgeJob
+	var questionID, studentID sql.NullInt64
+	var jobError sql.NullString
+	var startedAt, finishedAt sql.NullTime
+	err := Con.QueryRow(`
+		SELECT j.id, j.batch_id, j.question_id, j.student_id, j.status, j.total_attempts,
+			j.processed_attempts, j.changed_attempts, j.failed_attempts, j.error,
+			j.created_at, j.started_at, j.finished_at
+		FROM rejudge_job j
+		JOIN batch b ON b.id = j.batch_id
+		JOIN teacher t ON t.id = b.teacher_id
+		WHERE j.id = ? AND t.user_id = ?`, jobID, userID).Scan(
+		&job.ID, &job.BatchID, &questionID, &studentID, &job.Status, &job.Total,
+		&job.Processed, &job.Changed, &job.Failed, &jobError,
+		&job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("rejudge job not found")
+		}
+		return nil, fmt.Errorf("error retrieving rejudge job: %w", err)
+	}
+	if questionID.Valid {
+		job.QuestionID = &questionID.Int64
+	}
+	if studentID.Valid {
+		job.StudentID = &studentID.Int64
+	}
+	job.Error = jobError.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	rows, err := Con.Query(`
+		SELECT r.attempt_id, r.student_id, u.username, r.question_id, r.old_score, r.new_score,
+			r.old_status, IFNULL(r.new_status, ''), IFNULL(r.error, '')
+		FROM rejudge_result r
+		JOIN student s ON s.id = r.student_id
+		JOIN user u ON u.id = s.user_id
+		WHERE r.job_id = ?
+		ORDER BY r.id`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving rejudge results: %w", err)
+	}
+	defer rows.Close()
+
+	job.Results = []RejudgeResult{}
+	for rows.Next() {
+		var r RejudgeResult
+		var newScore sql.NullInt64
+		if err := rows.Scan(&r.AttemptID, &r.StudentID, &r.Username, &r.QuestionID, &r.OldScore, &newScore,
+			&r.OldStatus, &r.NewStatus, &r.Error); err != nil {
+			return nil, fmt.Errorf("error scanning rejudge result: %w", err)
+		}
+		if newScore.Valid {
+			score := int(newScore.Int64)
+			r.NewScore = &score
+		}
+		job.Results = append(job.Results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rejudge results: %w", err)
+	}
+
+	return &job, nil
+}
+
+// runRejudgeJob rejudges every attempt in the job's scope that it has not
+// rejudged yet, recording each result as it goes
+func runRejudgeJob(jobID int64) {
+	result, err := Con.Exec("UPDATE rejudge_job SET status = ?, started_at = IFNULL(started_at, NOW()) WHERE id = ? AND status = ?",
+		SubmissionRunning, jobID, SubmissionQueued)
+	if err != nil {
+		log.Printf("Error claiming rejudge job %d: %v", jobID, err)
+		return
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return
+	}
+
+	if err := rejudgeJobAttempts(jobID); err != nil {
+		log.Printf("Rejudge job %d failed: %v", jobID, err)
+		_, err = Con.Exec("UPDATE rejudge_job SET status = ?, error = ?, finished_at = NOW() WHERE id = ?",
+			SubmissionFailed, err.Error(), jobID)
+		if err != nil {
+			log.Printf("Error failing rejudge job %d: %v", jobID, err)
+		}
+		return
+	}
+
+	if _, err := Con.Exec("UPDATE rejudge_job SET status = ?, finished_at = NOW() WHERE id = ?", SubmissionDone, jobID); err != nil {
+		log.Printf("Error finishing rejudge job %d: %v", jobID, err)
+	}
+}
+
+func rejudgeJobAttempts(jobID int64) error {
+	var scope RejudgeScope
+	var questionID, studentID sql.NullInt64
+	err := Con.QueryRow("SELECT batch_id, question_id, student_id FROM rejudge_job WHERE id = ?", jobID).Scan(
+		&scope.BatchID, &questionID, &studentID)
+	if err != nil {
+		return fmt.Errorf("error loading rejudge job: %w", err)
+	}
+	scope.QuestionID, scope.StudentID = questionID.Int64, studentID.Int64
+
+	// Only attempts with a finished graded submission have a grade to fix
+	rows, err := Con.Query(`
+		SELECT a.id, a.student_id, a.question_id, IFNULL(a.score, 0), a.status
+		FROM attempt a
+		JOIN question q ON q.id = a.question_id
+		WHERE q.batch_id = ? AND (? = 0 OR a.question_id = ?) AND (? = 0 OR a.student_id = ?)
+			AND EXISTS (SELECT 1 FROM submission s
+				WHERE s.attempt_id = a.id AND s.calculate_score = TRUE AND s.status = ?)
+			AND NOT EXISTS (SELECT 1 FROM rejudge_result r WHERE r.job_id = ? AND r.attempt_id = a.id)
+		ORDER BY a.question_id, a.id`,
+		scope.BatchID, scope.QuestionID, scope.QuestionID, scope.StudentID, scope.StudentID,
+		SubmissionDone, jobID)
+	if err != nil {
+		return fmt.Errorf("error retrieving attempts: %w", err)
+	}
+	var pending []RejudgeResult
+	for rows.Next() {
+		var r RejudgeResult
+		if err := rows.Scan(&r.AttemptID, &r.StudentID, &r.QuestionID, &r.OldScore, &r.OldStatus); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning attempt: %w", err)
+		}
+		pending = append(pending, r)
+	}
+	rows.Close()
+
+	_, err = Con.Exec(`
+		UPDATE rejudge_job
+		SET total_attempts = ? + (SELECT COUNT(*) FROM rejudge_result WHERE job_id = ?)
+		WHERE id = ?`, len(pending), jobID, jobID)
+	if err != nil {
+		return fmt.Errorf("error updating rejudge progress: %w", err)
+	}
+
+	questions := make(map[int64]*evaluationTarget)
+	for _, r := range pending {
+		question, ok := questions[r.QuestionID]
+		if !ok {
+			if question, err = loadQuestionTarget(r.QuestionID); err != nil {
+				return err
+			}
+			questions[r.QuestionID] = question
+		}
+
+		var newScore *int
+		var newStatus, rejudgeError *string
+		score, status, err := rejudgeAttempt(question, r.AttemptID)
+		if err != nil {
+			message := err.Error()
+			rejudgeError = &message
+		} else {
+			newScore, newStatus = &score, &status
+		}
+
+		_, err = Con.Exec(`
+			INSERT INTO rejudge_result (job_id, attempt_id, student_id, question_id, old_score, new_score, old_status, new_status, error)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			jobID, r.AttemptID, r.StudentID, r.QuestionID, r.OldScore, newScore, r.OldStatus, newStatus, rejudgeError)
+		if err != nil {
+			return fmt.Errorf("error saving rejudge result: %w", err)
+		}
+
+		// The counters are recomputed from the results so a resumed job stays exact
+		_, err = Con.Exec(`
+			UPDATE rejudge_job SET
+				processed_attempts = (SELECT COUNT(*) FROM rejudge_result WHERE job_id = ?),
+				changed_attempts = (SELECT COUNT(*) FROM rejudge_result
+					WHERE job_id = ? AND (new_score <> old_score OR new_status <> old_status)),
+				failed_attempts = (SELECT COUNT(*) FROM rejudge_result WHERE job_id = ? AND error IS NOT NULL)
+			WHERE id = ?`, jobID, jobID, jobID, jobID)
+		if err != nil {
+			return fmt.Errorf("error updating rejudge progress: %w", err)
+		}
+	}
+	return nil
+}
+
+// gradedSubmission is a graded submission being rejudged
+type gradedSubmission struct {
+	ID         int64
+	Code       string
+	LanguageID int
+	CreatedAt  time.Time
+}
+
+// rejudgeAttempt re-runs the graded submissions of an attempt in order and
+// replays them through the grading policy, returning the new score and
+// status. Closed attempts stay closed and open ones stay open; only the
+// scores and statuses change.
+func rejudgeAttempt(question *evaluationTarget, attemptID int64) (int, string, error) {
+	var startTime sql.NullTime
+	var oldScore int
+	var oldStatus string
+	err := Con.QueryRow("SELECT start_time, IFNULL(score, 0), status FROM attempt WHERE id = ?", attemptID).Scan(
+		&startTime, &oldScore, &oldStatus)
+	if err != nil {
+		return 0, "", fmt.Errorf("error loading attempt: %w", err)
+	}
+	deadline := attemptDeadline(startTime.Time, question.TimeLimit, question.ClosesAt)
+
+	rows, err := Con.Query(`
+		SELECT id, code, language_id, created_at FROM submission
+		WHERE attempt_id = ? AND calculate_score = TRUE AND status = ?
+		ORDER BY id`, attemptID, SubmissionDone)
+	if err != nil {
+		return 0, "", fmt.Errorf("error retrieving graded submissions: %w", err)
+	}
+	var submissions []gradedSubmission
+	for rows.Next() {
+		var s gradedSubmission
+		if err := rows.Scan(&s.ID, &s.Code, &s.LanguageID, &s.CreatedAt); err != nil {
+			rows.Close()
+			return 0, "", fmt.Errorf("error scanning graded submission: %w", err)
+		}
+		submissions = append(submissions, s)
+	}
+	rows.Close()
+	if len(submissions) == 0 {
+		return oldScore, oldStatus, nil
+	}
+
+	var progress attemptProgress
+	var last *EvaluationResult
+	results := make([]*EvaluationResult, len(submissions))
+	for i, s := range submissions {
+		result, err := runEvaluation(Exec, s.Code, s.LanguageID, question.TestCases, question.Groups, nil)
+		if err != nil {
+			return 0, "", fmt.Errorf("error evaluating submission %d: %w", s.ID, err)
+		}
+		// Submissions made after the deadline are the sweeper closing the attempt
+		if deadline != nil && s.CreatedAt.After(deadline.Add(deadlineGrace)) {
+			result.Status = "timed_out"
+		}
+		progress = question.Grading.apply(progress, result.score(), result.Status == "correct")
+		results[i], last = result, result
+	}
+
+	var groupScores []byte
+	if len(last.Groups) > 0 {
+		if groupScores, err = json.Marshal(last.Groups); err != nil {
+			return 0, "", fmt.Errorf("error encoding group scores: %w", err)
+		}
+	}
+
+	tx, err := Con.Begin()
+	if err != nil {
+		return 0, "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A graded submission that arrived meanwhile was scored on top of the old
+	// results, so replaying without it would lose it
+	var attempted, newer bool
+	var status string
+	err = tx.QueryRow("SELECT attempted, status FROM attempt WHERE id = ? FOR UPDATE", attemptID).Scan(&attempted, &status)
+	if err == nil {
+		err = tx.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM submission
+			WHERE attempt_id = ? AND calculate_score = TRUE AND id > ?)`,
+			attemptID, submissions[len(submissions)-1].ID).Scan(&newer)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("error locking attempt: %w", err)
+	}
+	if newer {
+		return 0, "", errors.New("the attempt received a graded submission during the rejudge")
+	}
+
+	// Open attempts stay in progress, and attempts the sweeper closed stay timed out
+	if attempted && status != "timed_out" {
+		status = last.Status
+	}
+
+	for i, s := range submissions {
+		resultJSON, err := json.Marshal(results[i])
+		if err != nil {
+			return 0, "", fmt.Errorf("error encoding submission result: %w", err)
+		}
+		_, err = tx.Exec("UPDATE submission SET result = ?, score = ? WHERE id = ?",
+			string(resultJSON), results[i].score(), s.ID)
+		if err != nil {
+			return 0, "", fmt.Errorf("error saving submission result: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE attempt SET status = ?, score = ?, group_scores = ?, graded_submissions = ?, wrong_submissions = ?
+		WHERE id = ?`,
+		status, progress.Score, groupScores, progress.Graded, progress.Wrong, attemptID)
+	if err != nil {
+		return 0, "", fmt.Errorf("error updating attempt: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", fmt.Errorf("error committing rejudge: %w", err)
+	}
+	return progress.Score, status, nil
+}
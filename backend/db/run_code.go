@@ -0,0 +1,106 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// MaxRunStdinBytes is the largest custom input RunCode accepts
+const MaxRunStdinBytes = 64 * 1024
+
+// RunResult is the outcome of running code on custom input
+type RunResult struct {
+	Stdout        string  `json:"stdout"`
+	Stderr        string  `json:"stderr"`
+	CompileOutput string  `json:"compile_output,omitempty"`
+	Message       string  `json:"message,omitempty"`
+	Status        string  `json:"status"`            // Status description reported by the executor
+	Verdict       string  `json:"verdict,omitempty"` // Set when the run did not finish normally
+	Time          float64 `json:"time"`              // CPU seconds
+	Memory        int     `json:"memory"`            // Peak memory in KB
+}
+
+// RunCode runs code on stdin supplied by the student. When questionID is set
+// the question's resource limits apply and function questions run inside
+// their harness. Nothing is recorded, so it needs no attempt.
+func RunCode(userID, questionID int64, code string, languageID int, stdin string) (*RunResult, error) {
+	if Exec == nil {
+		return nil, errors.New("no code executor configured")
+	}
+	if len(stdin) > MaxRunStdinBytes {
+		return nil, fmt.Errorf("input is larger than %d bytes", MaxRunStdinBytes)
+	}
+
+	var limits ResourceLimits
+	if questionID > 0 {
+		studentID, err := studentIDForUser(userID)
+		if err != nil {
+			return nil, err
+		}
+
+		var function *FunctionSignature
+		limits, function, err = loadRunSettings(studentID, questionID)
+		if err != nil {
+			return nil, err
+		}
+		if function != nil {
+			if code, err = function.Harness(code, languageID); err != nil {
+				return &RunResult{
+					CompileOutput: err.Error(),
+					Status:        "Compilation Error",
+					Verdict:       VerdictCompilationError,
+				}, nil
+			}
+		}
+	}
+
+	result, err := executeLimited(Exec, ExecutionRequest{
+		SourceCode: code,
+		LanguageID: languageID,
+		Stdin:      stdin,
+		Limits:     limits.executionLimits(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error running code: %w", err)
+	}
+
+	run := &RunResult{
+		Stdout:        result.Stdout,
+		Stderr:        result.Stderr,
+		CompileOutput: result.CompileOutput,
+		Message:       result.Message,
+		Status:        result.StatusDescription,
+		Time:          result.Time,
+		Memory:        result.MemoryKB,
+	}
+	if result.StatusID != StatusAccepted {
+		run.Verdict = errorVerdict(result, limits)
+	}
+	return run, nil
+}
+
+// loadRunSettings checks that the student can see the question and returns
+// its resource limits and, for function questions, its signature
+func loadRunSettings(studentID, questionID int64) (ResourceLimits, *FunctionSignature, error) {
+	var limits ResourceLimits
+	var functionSignature sql.NullString
+	var enrolled bool
+	err := Con.QueryRow(`
+		SELECT q.cpu_time_limit, q.memory_limit, q.stack_limit, q.function_signature,
+			EXISTS(SELECT 1 FROM batch_student bs WHERE bs.batch_id = q.batch_id AND bs.student_id = ?)
+		FROM question q WHERE q.id = ?`, studentID, questionID).Scan(
+		&limits.CPUTimeLimit, &limits.MemoryLimit, &limits.StackLimit, &functionSignature, &enrolled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return limits, nil, errors.New("question not found")
+		}
+		return limits, nil, fmt.Errorf("error finding question: %w", err)
+	}
+	if !enrolled {
+		return limits, nil, errors.New("student is not enrolled in the batch containing this question")
+	}
+
+	function, err := decodeFunctionSignature(functionSignature)
+	return limits, function, err
+}
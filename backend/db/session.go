@@ -0,0 +1,172 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SessionLifetime is how long a login lasts without logging in again. Every
+// refresh rotates the refresh token but keeps the original expiry.
+const SessionLifetime = 7 * 24 * time.Hour
+
+// refreshReuseGrace is how long the refresh token a rotation replaced still
+// gets an access token, so two tabs refreshing at once don't look like a
+// stolen token being replayed. It never gets a new refresh token.
+const refreshReuseGrace = 30 * time.Second
+
+// SessionRotation is the result of presenting a refresh token
+type SessionRotation struct {
+	UserID     int64
+	Generation int  // Generation of the refresh token to hand out
+	Rotated    bool // false when the token was the one just replaced, in the grace period
+}
+
+// CreateSession starts a session, one refresh token family, for a user who
+// just logged in and returns its ID. The first refresh token has generation 0.
+func CreateSession(userID int64, userAgent, ip string) (int64, error) {
+	// Expired sessions of the user are of no use anymore
+	if _, err := Con.Exec("DELETE FROM session WHERE user_id = ? AND expires_at < ?", userID, time.Now()); err != nil {
+		return 0, fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	result, err := Con.Exec(`
+		INSERT INTO session (user_id, expires_at, user_agent, ip_address)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''))`,
+		userID, time.Now().Add(SessionLifetime), userAgent, ip)
+	if err != nil {
+		return 0, fmt.Errorf("error creating session: %w", err)
+	}
+
+	sessionID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting new session ID: %w", err)
+	}
+	return sessionID, nil
+}
+
+// RotateSession checks a refresh token of the session and moves the session
+// on to the next generation. Presenting an older generation means the token
+// was copied, so the whole session is revoked.
+func RotateSession(sessionID int64, generation int) (*SessionRotation, error) {
+	tx, err := Con.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var rotation SessionRotation
+	var session sessionState
+	err = tx.QueryRow(`
+		SELECT user_id, generation, rotated_at, expires_at, revoked_at IS NOT NULL
+		FROM session WHERE id = ? FOR UPDATE`, sessionID).Scan(
+		&rotation.UserID, &session.Generation, &session.RotatedAt, &session.ExpiresAt, &session.Revoked)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("session expired or revoked")
+		}
+		return nil, fmt.Errorf("error loading session: %w", err)
+	}
+
+	now := time.Now()
+	step, err := rotationFor(session, generation, now)
+	if err != nil {
+		return nil, err
+	}
+
+	switch step {
+	case rotateToken:
+		_, err = tx.Exec("UPDATE session SET generation = generation + 1, rotated_at = ? WHERE id = ?", now, sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("error rotating session: %w", err)
+		}
+		rotation.Generation, rotation.Rotated = session.Generation+1, true
+	case reuseInGrace:
+		rotation.Generation = session.Generation
+	case revokeForReuse:
+		_, err = tx.Exec("UPDATE session SET revoked_at = ?, revoked_reason = 'token_reuse' WHERE id = ?", now, sessionID)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error revoking session: %w", err)
+		}
+		return nil, errors.New("refresh token reuse detected, please log in again")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing session: %w", err)
+	}
+	return &rotation, nil
+}
+
+// sessionState is the part of a session row that decides a rotation
+type sessionState struct {
+	Generation int
+	RotatedAt  sql.NullTime
+	ExpiresAt  time.Time
+	Revoked    bool
+}
+
+// rotationStep is what presenting a refresh token does to its session
+type rotationStep int
+
+const (
+	rotateToken    rotationStep = iota // The newest token, moved on to the next generation
+	reuseInGrace                       // The token just replaced, still good for an access token
+	revokeForReuse                     // Any other token, so the session is revoked
+)
+
+// rotationFor decides what presenting the refresh token of the given
+// generation at now does to a session
+func rotationFor(session sessionState, generation int, now time.Time) (rotationStep, error) {
+	if session.Revoked || now.After(session.ExpiresAt) {
+		return 0, errors.New("session expired or revoked")
+	}
+	switch {
+	case generation == session.Generation:
+		return rotateToken, nil
+	case generation == session.Generation-1 && session.RotatedAt.Valid && now.Sub(session.RotatedAt.Time) < refreshReuseGrace:
+		return reuseInGrace, nil
+	default:
+		return revokeForReuse, nil
+	}
+}
+
+// SessionActive reports whether a session has been neither revoked nor expired
+func SessionActive(sessionID int64) (bool, error) {
+	var active bool
+	err := Con.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM session WHERE id = ? AND revoked_at IS NULL AND expires_at > ?)`,
+		sessionID, time.Now()).Scan(&active)
+	if err != nil {
+		return false, fmt.Errorf("error checking session: %w", err)
+	}
+	return active, nil
+}
+
+// RevokeSession ends one session of a user, as on logout
+func RevokeSession(userID, sessionID int64) error {
+	_, err := Con.Exec(`
+		UPDATE session SET revoked_at = ?, revoked_reason = 'logout'
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL`, time.Now(), sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions ends every active session of a user and returns how many there were
+func RevokeUserSessions(userID int64, reason string) (int64, error) {
+	result, err := Con.Exec(`
+		UPDATE session SET revoked_at = ?, revoked_reason = ?
+		WHERE user_id = ? AND revoked_at IS NULL`, time.Now(), reason, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
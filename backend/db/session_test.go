@@ -0,0 +1,52 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestRotationFor(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(SessionLifetime)
+	rotatedAt := func(ago time.Duration) sql.NullTime {
+		return sql.NullTime{Time: now.Add(-ago), Valid: true}
+	}
+
+	tests := []struct {
+		name       string
+		session    sessionState
+		generation int
+		want       rotationStep
+		wantErr    string
+	}{
+		{"first refresh", sessionState{Generation: 0, ExpiresAt: expires}, 0, rotateToken, ""},
+		{"newest token", sessionState{Generation: 3, RotatedAt: rotatedAt(time.Hour), ExpiresAt: expires}, 3, rotateToken, ""},
+		{"replaced token in the grace period", sessionState{Generation: 3, RotatedAt: rotatedAt(time.Second), ExpiresAt: expires}, 2, reuseInGrace, ""},
+		{"replaced token after the grace period", sessionState{Generation: 3, RotatedAt: rotatedAt(refreshReuseGrace), ExpiresAt: expires}, 2, revokeForReuse, ""},
+		{"older token in the grace period", sessionState{Generation: 3, RotatedAt: rotatedAt(time.Second), ExpiresAt: expires}, 1, revokeForReuse, ""},
+		{"first token replayed", sessionState{Generation: 3, RotatedAt: rotatedAt(time.Hour), ExpiresAt: expires}, 0, revokeForReuse, ""},
+		{"previous generation never rotated", sessionState{Generation: 1, ExpiresAt: expires}, 0, revokeForReuse, ""},
+		{"future generation", sessionState{Generation: 3, ExpiresAt: expires}, 4, revokeForReuse, ""},
+		{"revoked", sessionState{Generation: 3, ExpiresAt: expires, Revoked: true}, 3, 0, "session expired or revoked"},
+		{"revoked and replayed", sessionState{Generation: 3, RotatedAt: rotatedAt(time.Second), ExpiresAt: expires, Revoked: true}, 2, 0, "session expired or revoked"},
+		{"expired", sessionState{Generation: 3, ExpiresAt: now.Add(-time.Second)}, 3, 0, "session expired or revoked"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rotationFor(tt.session, tt.generation, now)
+
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Fatalf("rotationFor error = %q, want %q", gotErr, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("rotationFor = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
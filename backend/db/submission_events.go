@@ -0,0 +1,65 @@
+package db
+
+import "sync"
+
+// Event types sent to submission subscribers
+const (
+	EventStatus     = "status"
+	EventTestResult = "test_result"
+	EventResult     = "result"
+	EventError      = "error"
+)
+
+// SubmissionEvent is a progress update for one submission. TestResult is set
+// for test_result events, Result for the final result event.
+type SubmissionEvent struct {
+	Type       string            `json:"-"`
+	Status     string            `json:"status,omitempty"`
+	Index      int               `json:"index"`
+	TestResult *TestResult       `json:"test_result,omitempty"`
+	Result     *EvaluationResult `json:"result,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// submissionSubscribers holds the listeners of submissions evaluated by this process
+var submissionSubscribers = struct {
+	sync.Mutex
+	byID map[int64]map[chan SubmissionEvent]struct{}
+}{byID: map[int64]map[chan SubmissionEvent]struct{}{}}
+
+// SubscribeSubmission returns a channel receiving the events of a submission
+// and a function that must be called to stop listening. Events are dropped
+// for subscribers that fall behind, so the final state should still be read
+// with GetSubmission once the stream goes quiet.
+func SubscribeSubmission(submissionID int64) (<-chan SubmissionEvent, func()) {
+	ch := make(chan SubmissionEvent, 64)
+
+	submissionSubscribers.Lock()
+	if submissionSubscribers.byID[submissionID] == nil {
+		submissionSubscribers.byID[submissionID] = map[chan SubmissionEvent]struct{}{}
+	}
+	submissionSubscribers.byID[submissionID][ch] = struct{}{}
+	submissionSubscribers.Unlock()
+
+	return ch, func() {
+		submissionSubscribers.Lock()
+		defer submissionSubscribers.Unlock()
+		delete(submissionSubscribers.byID[submissionID], ch)
+		if len(submissionSubscribers.byID[submissionID]) == 0 {
+			delete(submissionSubscribers.byID, submissionID)
+		}
+	}
+}
+
+// publishSubmissionEvent sends the event to every subscriber of the submission without blocking
+func publishSubmissionEvent(submissionID int64, event SubmissionEvent) {
+	submissionSubscribers.Lock()
+	defer submissionSubscribers.Unlock()
+
+	for ch := range submissionSubscribers.byID[submissionID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SubmissionSummary is one entry of a student's submission history
+type SubmissionSummary struct {
+	ID             int64      `json:"id"`
+	LanguageID     int        `json:"language_id"`
+	CalculateScore bool       `json:"calculate_score"` // Graded submit rather than a practice run
+	Status         string     `json:"status"`
+	Score          *int       `json:"score"`
+	PassedTests    int        `json:"passed_tests"`
+	TotalTests     int        `json:"total_tests"`
+	Verdicts       []string   `json:"verdicts"` // Verdict of each test case, in order
+	CreatedAt      time.Time  `json:"created_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+}
+
+// SubmissionDetail is a submission with its code and full result
+type SubmissionDetail struct {
+	SubmissionSummary
+	Code   string            `json:"code"`
+	Result *EvaluationResult `json:"result,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// StudentSubmissions is a student's submission history for one question
+type StudentSubmissions struct {
+	QuestionID    int64               `json:"questionId"`
+	QuestionTitle string              `json:"questionTitle"`
+	StudentID     int64               `json:"studentId"`
+	Username      string              `json:"username"`
+	Submissions   []SubmissionSummary `json:"submissions"`
+}
+
+// SubmissionDiff compares the code of two submissions
+type SubmissionDiff struct {
+	From           SubmissionSummary `json:"from"`
+	To             SubmissionSummary `json:"to"`
+	ElapsedSeconds int               `json:"elapsedSeconds"` // Time between the two submissions
+	LinesAdded     int               `json:"linesAdded"`
+	LinesRemoved   int               `json:"linesRemoved"`
+	Diff           string            `json:"diff"` // Unified diff, empty when the code is unchanged
+}
+
+// ListStudentSubmissions returns every run and graded submit of a student for
+// a question, oldest first. This is a teacher-only endpoint.
+func ListStudentSubmissions(batchID, questionID, studentID int64) (*StudentSubmissions, error) {
+	history, err := submissionHistoryTarget(batchID, questionID, studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := Con.Query(`
+		SELECT id, language_id, calculate_score, status, score, result, created_at, finished_at
+		FROM submission
+		WHERE question_id = ? AND student_id = ?
+		ORDER BY created_at, id`, questionID, studentID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving submissions: %w", err)
+	}
+	defer rows.Close()
+
+	history.Submissions = []SubmissionSummary{}
+	for rows.Next() {
+		var summary SubmissionSummary
+		var score sql.NullInt64
+		var resultJSON sql.NullString
+		if err := rows.Scan(&summary.ID, &summary.LanguageID, &summary.CalculateScore, &summary.Status,
+			&score, &resultJSON, &summary.CreatedAt, &summary.FinishedAt); err != nil {
+			return nil, fmt.Errorf("error scanning submission: %w", err)
+		}
+
+		result, err := decodeSubmissionResult(resultJSON)
+		if err != nil {
+			return nil, err
+		}
+		summary.fill(score, result)
+		history.Submissions = append(history.Submissions, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating submissions: %w", err)
+	}
+
+	return history, nil
+}
+
+// GetStudentSubmission returns one submission of a student, including its code.
+// This is a teacher-only endpoint.
+func GetStudentSubmission(batchID, questionID, studentID, submissionID int64) (*SubmissionDetail, error) {
+	if _, err := submissionHistoryTarget(batchID, questionID, studentID); err != nil {
+		return nil, err
+	}
+	return loadSubmissionDetail(questionID, studentID, submissionID)
+}
+
+// DiffStudentSubmissions compares the code of two submissions of a student for
+// the same question. This is a teacher-only endpoint.
+func DiffStudentSubmissions(batchID, questionID, studentID, fromID, toID int64) (*SubmissionDiff, error) {
+	if _, err := submissionHistoryTarget(batchID, questionID, studentID); err != nil {
+		return nil, err
+	}
+
+	from, err := loadSubmissionDetail(questionID, studentID, fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := loadSubmissionDetail(questionID, studentID, toID)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, added, removed := unifiedDiff(
+		fmt.Sprintf("submission/%d", from.ID), fmt.Sprintf("submission/%d", to.ID), from.Code, to.Code)
+
+	return &SubmissionDiff{
+		From:           from.SubmissionSummary,
+		To:             to.SubmissionSummary,
+		ElapsedSeconds: int(to.CreatedAt.Sub(from.CreatedAt).Seconds()),
+		LinesAdded:     added,
+		LinesRemoved:   removed,
+		Diff:           diff,
+	}, nil
+}
+
+// submissionHistoryTarget checks that the question belongs to the batch and
+// that the student is enrolled in it
+func submissionHistoryTarget(batchID, questionID, studentID int64) (*StudentSubmissions, error) {
+	history := &StudentSubmissions{QuestionID: questionID, StudentID: studentID}
+	err := Con.QueryRow("SELECT title FROM question WHERE id = ? AND batch_id = ?",
+		questionID, batchID).Scan(&history.QuestionTitle)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("question not found in this batch")
+		}
+		return nil, fmt.Errorf("error checking question: %w", err)
+	}
+
+	err = Con.QueryRow(`
+		SELECT u.username
+		FROM batch_student bs
+		JOIN student s ON bs.student_id = s.id
+		JOIN user u ON s.user_id = u.id
+		WHERE bs.batch_id = ? AND s.id = ?`,
+		batchID, studentID).Scan(&history.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("student not found in this batch")
+		}
+		return nil, fmt.Errorf("error checking student: %w", err)
+	}
+
+	return history, nil
+}
+
+// loadSubmissionDetail loads a submission of the student for the question
+func loadSubmissionDetail(questionID, studentID, submissionID int64) (*SubmissionDetail, error) {
+	var detail SubmissionDetail
+	var score sql.NullInt64
+	var resultJSON, errorText sql.NullString
+	err := Con.QueryRow(`
+		SELECT id, language_id, calculate_score, status, score, result, error, code, created_at, finished_at
+		FROM submission
+		WHERE id = ? AND question_id = ? AND student_id = ?`,
+		submissionID, questionID, studentID).Scan(
+		&detail.ID, &detail.LanguageID, &detail.CalculateScore, &detail.Status, &score,
+		&resultJSON, &errorText, &detail.Code, &detail.CreatedAt, &detail.FinishedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("submission not found")
+		}
+		return nil, fmt.Errorf("error retrieving submission: %w", err)
+	}
+
+	detail.Result, err = decodeSubmissionResult(resultJSON)
+	if err != nil {
+		return nil, err
+	}
+	detail.fill(score, detail.Result)
+	detail.Error = errorText.String
+
+	return &detail, nil
+}
+
+// decodeSubmissionResult decodes the stored result JSON of a submission, which
+// is empty until the submission has started
+func decodeSubmissionResult(resultJSON sql.NullString) (*EvaluationResult, error) {
+	if !resultJSON.Valid || resultJSON.String == "" {
+		return nil, nil
+	}
+	var result EvaluationResult
+	if err := json.Unmarshal([]byte(resultJSON.String), &result); err != nil {
+		return nil, fmt.Errorf("error decoding submission result: %w", err)
+	}
+	return &result, nil
+}
+
+// fill sets the score and per-test verdicts of the summary
+func (s *SubmissionSummary) fill(score sql.NullInt64, result *EvaluationResult) {
+	if score.Valid {
+		value := int(score.Int64)
+		s.Score = &value
+	}
+
+	s.Verdicts = []string{}
+	if result == nil {
+		return
+	}
+	s.PassedTests = result.PassedTests
+	s.TotalTests = result.TotalTests
+	for _, tr := range result.TestResults {
+		s.Verdicts = append(s.Verdicts, tr.Verdict)
+	}
+}
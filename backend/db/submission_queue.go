@@ -0,0 +1,303 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Submission states stored in submission.status
+const (
+	SubmissionQueued  = "queued"
+	SubmissionRunning = "running"
+	SubmissionDone    = "done"
+	SubmissionFailed  = "failed"
+)
+
+// Queue settings, overridable with SUBMISSION_WORKERS and SUBMISSION_MAX_RETRIES
+var (
+	SubmissionWorkers    = 4
+	SubmissionMaxRetries = 3
+
+	submissionSweepInterval = 30 * time.Second
+	submissionQueue         chan int64
+)
+
+// SubmissionStatus is what GetSubmission reports about a queued submission.
+// Result holds the partial test results while the submission is running.
+type SubmissionStatus struct {
+	ID             int64             `json:"id"`
+	QuestionID     int64             `json:"question_id"`
+	LanguageID     int               `json:"language_id"`
+	CalculateScore bool              `json:"calculate_score"`
+	Status         string            `json:"status"`
+	Result         *EvaluationResult `json:"result,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	StartedAt      *time.Time        `json:"started_at"`
+	FinishedAt     *time.Time        `json:"finished_at"`
+}
+
+// StartSubmissionWorkers starts the background workers that evaluate queued
+// submissions. Submissions left running by a previous process are queued again.
+func StartSubmissionWorkers() error {
+	SubmissionWorkers = int(envInt("SUBMISSION_WORKERS", int64(SubmissionWorkers)))
+	SubmissionMaxRetries = int(envInt("SUBMISSION_MAX_RETRIES", int64(SubmissionMaxRetries)))
+
+	// Jobs interrupted by a restart never finished, run them again
+	if _, err := Con.Exec("UPDATE submission SET status = ? WHERE status = ?", SubmissionQueued, SubmissionRunning); err != nil {
+		return fmt.Errorf("error recovering running submissions: %w", err)
+	}
+
+	submissionQueue = make(chan int64, 1024)
+	for i := 0; i < SubmissionWorkers; i++ {
+		go submissionWorker()
+	}
+
+	go func() {
+		for {
+			sweepQueuedSubmissions()
+			time.Sleep(submissionSweepInterval)
+		}
+	}()
+
+	log.Printf("Started %d submission workers", SubmissionWorkers)
+	return nil
+}
+
+// EnqueueSubmission validates the submission, stores it and hands it to the
+// worker pool. It returns the new submission ID.
+func EnqueueSubmission(userID int64, questionID int64, code string, languageID int, calculateScore bool) (int64, error) {
+	if submissionQueue == nil {
+		return 0, errors.New("submission workers are not running")
+	}
+
+	studentID, err := studentIDForUser(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Reject submissions that can never be evaluated before queueing them
+	target, err := loadEvaluationTarget(studentID, questionID)
+	if err != nil {
+		return 0, err
+	}
+	if err := target.checkWindow(time.Now()); err != nil {
+		return 0, err
+	}
+
+	result, err := Con.Exec(`
+		INSERT INTO submission (student_id, question_id, attempt_id, code, language_id, calculate_score, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		studentID, questionID, target.AttemptID, code, languageID, calculateScore, SubmissionQueued)
+	if err != nil {
+		return 0, fmt.Errorf("error creating submission: %w", err)
+	}
+
+	submissionID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting new submission ID: %w", err)
+	}
+
+	queueSubmission(submissionID)
+	return submissionID, nil
+}
+
+// GetSubmission returns the status of a submission
+func GetSubmission(submissionID int64) (*SubmissionStatus, error) {
+	var status SubmissionStatus
+	var resultJSON, errorText sql.NullString
+	err := Con.QueryRow(`
+		SELECT id, question_id, language_id, calculate_score, status, result, error, created_at, started_at, finished_at
+		FROM submission
+		WHERE id = ?`,
+		submissionID).Scan(
+		&status.ID, &status.QuestionID, &status.LanguageID, &status.CalculateScore, &status.Status,
+		&resultJSON, &errorText, &status.CreatedAt, &status.StartedAt, &status.FinishedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("submission not found")
+		}
+		return nil, fmt.Errorf("error retrieving submission: %w", err)
+	}
+
+	status.Result, err = decodeSubmissionResult(resultJSON)
+	if err != nil {
+		return nil, err
+	}
+	status.Error = errorText.String
+
+	return &status, nil
+}
+
+// queueSubmission hands a submission to the workers without blocking. If the
+// queue is full the row stays queued and the sweeper picks it up later.
+func queueSubmission(submissionID int64) {
+	select {
+	case submissionQueue <- submissionID:
+	default:
+		log.Printf("Submission queue full, submission %d will be picked up by the sweeper", submissionID)
+	}
+}
+
+// sweepQueuedSubmissions queues every submission that is due to run
+func sweepQueuedSubmissions() {
+	rows, err := Con.Query(`
+		SELECT id FROM submission
+		WHERE status = ? AND (run_after IS NULL OR run_after <= ?)
+		ORDER BY id`, SubmissionQueued, time.Now())
+	if err != nil {
+		log.Println("Error sweeping queued submissions:", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Println("Error scanning queued submission:", err)
+			return
+		}
+		queueSubmission(id)
+	}
+}
+
+func submissionWorker() {
+	for id := range submissionQueue {
+		if err := processSubmission(id); err != nil {
+			log.Printf("Error processing submission %d: %v", id, err)
+		}
+	}
+}
+
+// processSubmission claims a queued submission and evaluates it. The same ID
+// may be queued more than once; only the worker that claims it runs it.
+func processSubmission(submissionID int64) error {
+	now := time.Now()
+	claimed, err := Con.Exec(`
+		UPDATE submission SET status = ?, started_at = ?
+		WHERE id = ? AND status = ? AND (run_after IS NULL OR run_after <= ?)`,
+		SubmissionRunning, now, submissionID, SubmissionQueued, now)
+	if err != nil {
+		return fmt.Errorf("error claiming submission: %w", err)
+	}
+	if affected, err := claimed.RowsAffected(); err != nil || affected == 0 {
+		return err
+	}
+
+	var (
+		attemptID           sql.NullInt64
+		code                string
+		languageID, retries int
+		calculateScore      bool
+		createdAt           time.Time
+	)
+	err = Con.QueryRow(`
+		SELECT attempt_id, code, language_id, calculate_score, retries, created_at
+		FROM submission WHERE id = ?`, submissionID).Scan(
+		&attemptID, &code, &languageID, &calculateScore, &retries, &createdAt)
+	if err != nil {
+		return fmt.Errorf("error loading submission: %w", err)
+	}
+	if !attemptID.Valid {
+		return failSubmission(submissionID, errors.New("submission has no attempt"))
+	}
+
+	// Grade the attempt the submission was queued for, even if the student has
+	// opened a newer one since
+	target, err := loadAttemptTarget(attemptID.Int64)
+	if err != nil {
+		return failSubmission(submissionID, err)
+	}
+	publishSubmissionEvent(submissionID, SubmissionEvent{Type: EventStatus, Status: SubmissionRunning})
+
+	result, err := runEvaluation(Exec, code, languageID, target.TestCases, target.Groups, func(i int, results []TestResult) {
+		saveSubmissionProgress(submissionID, results)
+		publishSubmissionEvent(submissionID, SubmissionEvent{Type: EventTestResult, Index: i, TestResult: &results[i]})
+	})
+	if err != nil {
+		// Judge0 being unreachable or rate limited may pass, anything else won't
+		if isExecutorUnavailable(err) && retries < SubmissionMaxRetries {
+			return retrySubmission(submissionID, retries, err)
+		}
+		return failSubmission(submissionID, err)
+	}
+
+	// Score against the time the student pressed submit, not when a worker got to it
+	if err := recordEvaluation(target, result, code, calculateScore, createdAt); err != nil {
+		return failSubmission(submissionID, err)
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error encoding submission result: %w", err)
+	}
+
+	_, err = Con.Exec(`
+		UPDATE submission SET status = ?, result = ?, score = ?, error = NULL, finished_at = ?
+		WHERE id = ?`,
+		SubmissionDone, string(resultJSON), result.score(), time.Now(), submissionID)
+	if err != nil {
+		return fmt.Errorf("error saving submission result: %w", err)
+	}
+
+	publishSubmissionEvent(submissionID, SubmissionEvent{Type: EventResult, Status: SubmissionDone, Result: result})
+	return nil
+}
+
+// saveSubmissionProgress stores the partial results of a running submission
+func saveSubmissionProgress(submissionID int64, results []TestResult) {
+	partial := EvaluationResult{
+		TotalTests:  len(results),
+		TestResults: results,
+		Status:      SubmissionRunning,
+	}
+	for _, r := range results {
+		if r.Status == "PASS" {
+			partial.PassedTests++
+		}
+	}
+
+	resultJSON, err := json.Marshal(partial)
+	if err != nil {
+		log.Printf("Error encoding progress of submission %d: %v", submissionID, err)
+		return
+	}
+	if _, err := Con.Exec("UPDATE submission SET result = ? WHERE id = ?", string(resultJSON), submissionID); err != nil {
+		log.Printf("Error saving progress of submission %d: %v", submissionID, err)
+	}
+}
+
+// retrySubmission puts the submission back in the queue with exponential backoff
+func retrySubmission(submissionID int64, retries int, cause error) error {
+	backoff := time.Duration(1<<retries) * 2 * time.Second
+	_, err := Con.Exec(`
+		UPDATE submission SET status = ?, retries = retries + 1, run_after = ?, result = NULL, error = ?
+		WHERE id = ?`,
+		SubmissionQueued, time.Now().Add(backoff), cause.Error(), submissionID)
+	if err != nil {
+		return fmt.Errorf("error requeueing submission: %w", err)
+	}
+
+	publishSubmissionEvent(submissionID, SubmissionEvent{Type: EventStatus, Status: SubmissionQueued})
+	log.Printf("Submission %d failed (%v), retrying in %s", submissionID, cause, backoff)
+	time.AfterFunc(backoff, func() { queueSubmission(submissionID) })
+	return nil
+}
+
+// failSubmission marks the submission as failed with the given cause
+func failSubmission(submissionID int64, cause error) error {
+	_, err := Con.Exec(`
+		UPDATE submission SET status = ?, error = ?, finished_at = ?
+		WHERE id = ?`,
+		SubmissionFailed, cause.Error(), time.Now(), submissionID)
+	if err != nil {
+		return fmt.Errorf("error marking submission as failed: %w", err)
+	}
+
+	publishSubmissionEvent(submissionID, SubmissionEvent{Type: EventError, Status: SubmissionFailed, Error: cause.Error()})
+	return nil
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 )
 
 // Teacher represents a teacher's data with status information
@@ -61,9 +62,19 @@ func ApproveTeacher(teacherID string) error {
 	return updateTeacherStatus(teacherID, "approved")
 }
 
-// RevokeTeacher changes a teacher's status to 'revoked'
+// RevokeTeacher changes a teacher's status to 'revoked' and logs them out
+// everywhere
 func RevokeTeacher(teacherID string) error {
-	return updateTeacherStatus(teacherID, "revoked")
+	if err := updateTeacherStatus(teacherID, "revoked"); err != nil {
+		return err
+	}
+
+	var userID int64
+	if err := Con.QueryRow("SELECT user_id FROM teacher WHERE id = ?", teacherID).Scan(&userID); err != nil {
+		return fmt.Errorf("error retrieving teacher data: %w", err)
+	}
+	_, err := RevokeUserSessions(userID, "teacher_revoked")
+	return err
 }
 
 // SetTeacherPending sets a teacher's status back to 'pending'
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits on uploaded test archives
+const (
+	MaxTestArchiveBytes   = 32 << 20  // Size of the uploaded archive
+	maxTestArchiveContent = 128 << 20 // Total size of the extracted files
+	maxArchiveTestCases   = 500
+	// maxTestCaseText is the size of the input or the expected output of one
+	// test case. The columns are MEDIUMTEXT, but a test case at this size also
+	// stays within MariaDB's default 16 MB max_allowed_packet when inserted.
+	maxTestCaseText = 4 << 20
+)
+
+// testManifestName is the optional file in a test archive that marks hidden
+// cases and groups
+const testManifestName = "manifest.json"
+
+// testManifest marks hidden test cases and groups in a test archive:
+//
+//	{"hidden": true, "tests": {"01": {"hidden": false}, "07": {"group": "large"}}}
+//
+// hidden is the default for tests the manifest doesn't list, false when unset.
+type testManifest struct {
+	Hidden bool                         `json:"hidden"`
+	Tests  map[string]testManifestEntry `json:"tests"`
+}
+
+type testManifestEntry struct {
+	Hidden *bool  `json:"hidden"`
+	Group  string `json:"group"`
+}
+
+// archiveTest is a test case found in an archive, named after its files
+type archiveTest struct {
+	input, output    string
+	hasIn, hasOutput bool
+}
+
+// ImportTestCases adds the test cases of a zip or tar archive to a question
+// in one transaction and returns how many there were. Tests are NN.in files
+// with the expected output in NN.out (or NN.ans), in any directory; the output
+// may be left out when the question has a reference solution. With replace,
+// the existing test cases are deleted first.
+func ImportTestCases(questionID int64, archiveName string, archive []byte, replace bool) (int, error) {
+	settings, err := loadTestCaseSettings(questionID)
+	if err != nil {
+		return 0, err
+	}
+
+	testCases, err := parseTestArchive(archiveName, archive, settings.Reference != nil)
+	if err != nil {
+		return 0, err
+	}
+
+	testCases, groupIDs, err := settings.prepare(testCases)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := Con.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.Exec("DELETE FROM test_case WHERE question_id = ?", questionID); err != nil {
+			return 0, fmt.Errorf("error deleting test cases: %w", err)
+		}
+	}
+
+	for i, tc := range testCases {
+		_, err := tx.Exec(`
+			INSERT INTO test_case (question_id, input_text, expected_output, is_hidden,
+				cpu_time_limit, memory_limit, stack_limit, comparator, comparator_tolerance, group_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)`,
+			questionID, tc.InputText, tc.ExpectedOutput, tc.IsHidden,
+			tc.Limits.CPUTimeLimit, tc.Limits.MemoryLimit, tc.Limits.StackLimit,
+			tc.Comparator.Type, tc.Comparator.Tolerance, groupIDs[i])
+		if err != nil {
+			return 0, fmt.Errorf("error creating test case: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return len(testCases), nil
+}
+
+// parseTestArchive reads the test cases of an archive, ordered by name with
+// numeric names in numeric order
+func parseTestArchive(archiveName string, archive []byte, outputOptional bool) ([]TestCase, error) {
+	if len(archive) > MaxTestArchiveBytes {
+		return nil, fmt.Errorf("archive is larger than %d MB", MaxTestArchiveBytes>>20)
+	}
+
+	tests := map[string]*archiveTest{}
+	var manifest *testManifest
+	budget := int64(maxTestArchiveContent)
+	addFile := func(name string, r io.Reader) error {
+		// Nothing is extracted, but a name leaving the archive is never a test
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive has an unsafe file name %q", name)
+		}
+		base := path.Base(name)
+		ext := path.Ext(base)
+		stem := strings.TrimSuffix(base, ext)
+		// Hidden files such as the ._ resource forks macOS adds to zips are not tests
+		if strings.HasPrefix(base, ".") || strings.HasPrefix(name, "__MACOSX/") {
+			return nil
+		}
+		if base != testManifestName && ext != ".in" && ext != ".out" && ext != ".ans" {
+			return nil
+		}
+
+		data, err := io.ReadAll(io.LimitReader(r, min(budget, maxTestCaseText)+1))
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", name, err)
+		}
+		if len(data) > maxTestCaseText {
+			return fmt.Errorf("%s is larger than the %d MB limit for one test file", name, maxTestCaseText>>20)
+		}
+		if budget -= int64(len(data)); budget < 0 {
+			return fmt.Errorf("archive contents are larger than %d MB", maxTestArchiveContent>>20)
+		}
+
+		if base == testManifestName {
+			manifest = &testManifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return fmt.Errorf("invalid %s: %w", testManifestName, err)
+			}
+			return nil
+		}
+
+		test, ok := tests[stem]
+		if !ok {
+			if len(tests) == maxArchiveTestCases {
+				return fmt.Errorf("archive has more than %d test cases", maxArchiveTestCases)
+			}
+			test = &archiveTest{}
+			tests[stem] = test
+		}
+		if ext == ".in" {
+			if test.hasIn {
+				return fmt.Errorf("test %s has more than one input file", stem)
+			}
+			test.input, test.hasIn = string(data), true
+		} else {
+			if test.hasOutput {
+				return fmt.Errorf("test %s has more than one output file", stem)
+			}
+			test.output, test.hasOutput = string(data), true
+		}
+		return nil
+	}
+
+	lower := strings.ToLower(archiveName)
+	var err error
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		err = readZipArchive(archive, addFile)
+	case strings.HasSuffix(lower, ".tar"):
+		err = readTarArchive(bytes.NewReader(archive), addFile)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(bytes.NewReader(archive)); err == nil {
+			err = readTarArchive(gz, addFile)
+		}
+	default:
+		return nil, errors.New("archive must be a .zip, .tar, .tar.gz or .tgz file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(tests) == 0 {
+		return nil, errors.New("archive has no test cases")
+	}
+
+	names := make([]string, 0, len(tests))
+	for name := range tests {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, errA := strconv.Atoi(names[i])
+		b, errB := strconv.Atoi(names[j])
+		if errA == nil && errB == nil && a != b {
+			return a < b
+		}
+		if (errA == nil) != (errB == nil) {
+			return errA == nil
+		}
+		return names[i] < names[j]
+	})
+
+	if manifest == nil {
+		manifest = &testManifest{}
+	}
+	for name := range manifest.Tests {
+		if _, ok := tests[name]; !ok {
+			return nil, fmt.Errorf("%s lists unknown test %q", testManifestName, name)
+		}
+	}
+
+	testCases := make([]TestCase, len(names))
+	for i, name := range names {
+		test := tests[name]
+		if !test.hasIn {
+			return nil, fmt.Errorf("test %s has no .in file", name)
+		}
+		if !test.hasOutput && !outputOptional {
+			return nil, fmt.Errorf("test %s has no .out file", name)
+		}
+
+		entry := manifest.Tests[name]
+		hidden := manifest.Hidden
+		if entry.Hidden != nil {
+			hidden = *entry.Hidden
+		}
+		testCases[i] = TestCase{
+			InputText:      test.input,
+			ExpectedOutput: test.output,
+			IsHidden:       hidden,
+			Group:          entry.Group,
+		}
+	}
+	return testCases, nil
+}
+
+// readZipArchive calls addFile with every regular file of a zip archive
+func readZipArchive(archive []byte, addFile func(name string, r io.Reader) error) error {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("error opening %s: %w", f.Name, err)
+		}
+		err = addFile(f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTarArchive calls addFile with every regular file of a tar archive
+func readTarArchive(r io.Reader, addFile func(name string, r io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := addFile(hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
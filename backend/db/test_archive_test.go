@@ -0,0 +1,315 @@
+package db
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// archiveFile is a file to put in a test archive, a symbolic link to content
+// when symlink is set
+type archiveFile struct {
+	name, content string
+	symlink       bool
+}
+
+func zipArchive(t *testing.T, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &zip.FileHeader{Name: f.name, Method: zip.Deflate}
+		if f.symlink {
+			hdr.SetMode(os.ModeSymlink | 0o777)
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, compress bool, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	}
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		if f.symlink {
+			hdr = &tar.Header{Name: f.name, Mode: 0o777, Linkname: f.content, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if !f.symlink {
+			if _, err := tw.Write([]byte(f.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// testFiles returns the .in and .out files of the named tests
+func testFiles(dir string, names ...string) []archiveFile {
+	var files []archiveFile
+	for _, name := range names {
+		files = append(files,
+			archiveFile{name: dir + name + ".in", content: "in " + name},
+			archiveFile{name: dir + name + ".out", content: "out " + name})
+	}
+	return files
+}
+
+// archiveCases returns the test cases testFiles makes
+func archiveCases(names ...string) []TestCase {
+	testCases := make([]TestCase, len(names))
+	for i, name := range names {
+		testCases[i] = TestCase{InputText: "in " + name, ExpectedOutput: "out " + name}
+	}
+	return testCases
+}
+
+// sizedFiles returns count .in files of size bytes each
+func sizedFiles(count, size int) []archiveFile {
+	content := strings.Repeat("1", size)
+	files := make([]archiveFile, count)
+	for i := range files {
+		files[i] = archiveFile{name: fmt.Sprintf("%d.in", i+1), content: content}
+	}
+	return files
+}
+
+func TestParseTestArchive(t *testing.T) {
+	withManifest := append(testFiles("", "1", "2", "3"), archiveFile{
+		name:    "manifest.json",
+		content: `{"hidden": true, "tests": {"1": {"hidden": false}, "2": {"group": "large"}}}`,
+	})
+
+	tests := []struct {
+		name           string
+		archiveName    string
+		archive        []byte
+		outputOptional bool
+		want           []TestCase
+		wantErr        string
+	}{
+		{
+			name:        "numeric names in numeric order before other names",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, testFiles("", "b", "10", "2", "a", "1")...),
+			want:        archiveCases("1", "2", "10", "a", "b"),
+		},
+		{
+			name:        "tar in a directory",
+			archiveName: "tests.tar",
+			archive:     tarArchive(t, false, testFiles("tests/", "2", "1")...),
+			want:        archiveCases("1", "2"),
+		},
+		{
+			name:        "gzipped tar",
+			archiveName: "Tests.TGZ",
+			archive:     tarArchive(t, true, testFiles("", "1")...),
+			want:        archiveCases("1"),
+		},
+		{
+			name:        "ans output",
+			archiveName: "tests.tar.gz",
+			archive:     tarArchive(t, true, archiveFile{name: "1.in", content: "in 1"}, archiveFile{name: "1.ans", content: "out 1"}),
+			want:        archiveCases("1"),
+		},
+		{
+			name:        "hidden and unrelated files are skipped",
+			archiveName: "tests.zip",
+			archive: zipArchive(t, append(testFiles("", "1"),
+				archiveFile{name: "__MACOSX/._1.in", content: "resource fork"},
+				archiveFile{name: "tests/._2.in", content: "resource fork"},
+				archiveFile{name: ".hidden.in", content: "dotfile"},
+				archiveFile{name: "README.md", content: "readme"},
+				archiveFile{name: "solution.cpp", content: "int main() {}"})...),
+			want: archiveCases("1"),
+		},
+		{
+			name:        "zip symlinks are skipped",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, append(testFiles("", "1"), archiveFile{name: "2.in", content: "/etc/passwd", symlink: true})...),
+			want:        archiveCases("1"),
+		},
+		{
+			name:        "tar symlinks are skipped",
+			archiveName: "tests.tar",
+			archive:     tarArchive(t, false, append(testFiles("", "1"), archiveFile{name: "2.in", content: "/etc/passwd", symlink: true})...),
+			want:        archiveCases("1"),
+		},
+		{
+			name:        "zip entry outside the archive",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, append(testFiles("", "1"), archiveFile{name: "../2.in", content: "in 2"})...),
+			wantErr:     `archive has an unsafe file name "../2.in"`,
+		},
+		{
+			name:        "tar entry escaping a directory",
+			archiveName: "tests.tar",
+			archive:     tarArchive(t, false, archiveFile{name: "tests/../../1.in", content: "in 1"}),
+			wantErr:     `archive has an unsafe file name "tests/../../1.in"`,
+		},
+		{
+			name:        "tar entry with an absolute path",
+			archiveName: "tests.tar",
+			archive:     tarArchive(t, false, archiveFile{name: "/etc/cron.d/1.in", content: "in 1"}),
+			wantErr:     `archive has an unsafe file name "/etc/cron.d/1.in"`,
+		},
+		{
+			name:        "manifest",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, withManifest...),
+			want: []TestCase{
+				{InputText: "in 1", ExpectedOutput: "out 1"},
+				{InputText: "in 2", ExpectedOutput: "out 2", IsHidden: true, Group: "large"},
+				{InputText: "in 3", ExpectedOutput: "out 3", IsHidden: true},
+			},
+		},
+		{
+			name:        "manifest with an unknown test",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, append(testFiles("", "1"), archiveFile{name: "manifest.json", content: `{"tests": {"01": {}}}`})...),
+			wantErr:     `manifest.json lists unknown test "01"`,
+		},
+		{
+			name:        "invalid manifest",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, append(testFiles("", "1"), archiveFile{name: "manifest.json", content: `{"hidden": "yes"}`})...),
+			wantErr:     "invalid manifest.json: ",
+		},
+		{
+			name:        "missing output",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, archiveFile{name: "1.in", content: "in 1"}),
+			wantErr:     "test 1 has no .out file",
+		},
+		{
+			name:           "missing output with a reference solution",
+			archiveName:    "tests.zip",
+			archive:        zipArchive(t, archiveFile{name: "1.in", content: "in 1"}),
+			outputOptional: true,
+			want:           []TestCase{{InputText: "in 1"}},
+		},
+		{
+			name:           "missing input",
+			archiveName:    "tests.zip",
+			archive:        zipArchive(t, archiveFile{name: "1.out", content: "out 1"}),
+			outputOptional: true,
+			wantErr:        "test 1 has no .in file",
+		},
+		{
+			name:        "two outputs",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, append(testFiles("", "1"), archiveFile{name: "1.ans", content: "out 1"})...),
+			wantErr:     "test 1 has more than one output file",
+		},
+		{
+			name:        "same test in two directories",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, append(testFiles("a/", "1"), testFiles("b/", "1")...)...),
+			wantErr:     "test 1 has more than one input file",
+		},
+		{
+			name:           "largest test file",
+			archiveName:    "tests.zip",
+			archive:        zipArchive(t, sizedFiles(1, maxTestCaseText)...),
+			outputOptional: true,
+			want:           []TestCase{{InputText: strings.Repeat("1", maxTestCaseText)}},
+		},
+		{
+			name:        "test file too large",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, sizedFiles(1, maxTestCaseText+1)...),
+			wantErr:     "1.in is larger than the 4 MB limit for one test file",
+		},
+		{
+			name:        "contents too large",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, sizedFiles(maxTestArchiveContent/maxTestCaseText+1, maxTestCaseText)...),
+			wantErr:     "archive contents are larger than 128 MB",
+		},
+		{
+			name:        "too many tests",
+			archiveName: "tests.tar.gz",
+			archive:     tarArchive(t, true, sizedFiles(maxArchiveTestCases+1, 1)...),
+			wantErr:     "archive has more than 500 test cases",
+		},
+		{
+			name:        "archive too large",
+			archiveName: "tests.zip",
+			archive:     make([]byte, MaxTestArchiveBytes+1),
+			wantErr:     "archive is larger than 32 MB",
+		},
+		{
+			name:        "unsupported format",
+			archiveName: "tests.rar",
+			archive:     []byte("Rar!"),
+			wantErr:     "archive must be a .zip, .tar, .tar.gz or .tgz file",
+		},
+		{
+			name:        "corrupt zip",
+			archiveName: "tests.zip",
+			archive:     []byte("not a zip"),
+			wantErr:     "invalid zip archive: ",
+		},
+		{
+			name:        "no tests",
+			archiveName: "tests.zip",
+			archive:     zipArchive(t, archiveFile{name: "README.md", content: "readme"}),
+			wantErr:     "archive has no test cases",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTestArchive(tt.archiveName, tt.archive, tt.outputOptional)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTestArchive: %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d test cases, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("test case %d = %.20q %.20q hidden %v group %q, want %.20q %.20q hidden %v group %q", i+1,
+						got[i].InputText, got[i].ExpectedOutput, got[i].IsHidden, got[i].Group,
+						tt.want[i].InputText, tt.want[i].ExpectedOutput, tt.want[i].IsHidden, tt.want[i].Group)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Scoring modes of a test group
+const (
+	GroupScoringAllOrNothing = "all_or_nothing" // full points only if every test case passes
+	GroupScoringProportional = "proportional"   // points in proportion to the credit earned
+)
+
+// TestGroup is a subtask: a set of test cases worth Points together. A group
+// only scores if every group in DependsOn was fully solved. When a question
+// has groups, test cases outside any group are samples worth no points.
+type TestGroup struct {
+	Name      string   `json:"name"`
+	Points    int      `json:"points"`
+	Scoring   string   `json:"scoring"`
+	DependsOn []string `json:"depends_on"`
+}
+
+// GroupScore is the result of one test group in an evaluation.
+// A group is fully solved when Passed equals Total.
+type GroupScore struct {
+	Name    string  `json:"name"`
+	Points  int     `json:"points"`
+	Earned  float64 `json:"earned"`
+	Passed  int     `json:"passed"`
+	Total   int     `json:"total"`
+	Skipped bool    `json:"skipped,omitempty"` // A dependency was not fully solved
+}
+
+// validateTestGroups checks group definitions and the group names used by test cases
+func validateTestGroups(groups []TestGroup, testCases []TestCase) error {
+	if len(groups) == 0 {
+		for _, tc := range testCases {
+			if tc.Group != "" {
+				return fmt.Errorf("test case is in group %q but the question has no groups", tc.Group)
+			}
+		}
+		return nil
+	}
+
+	totalPoints := 0
+	for _, g := range groups {
+		totalPoints += g.Points
+	}
+	if totalPoints == 0 {
+		return errors.New("test groups must be worth at least one point in total")
+	}
+
+	seen := map[string]bool{}
+	for i, g := range groups {
+		if strings.TrimSpace(g.Name) == "" {
+			return fmt.Errorf("test group %d needs a name", i+1)
+		}
+		if seen[g.Name] {
+			return fmt.Errorf("duplicate test group %q", g.Name)
+		}
+		if g.Points < 0 {
+			return fmt.Errorf("test group %q has negative points", g.Name)
+		}
+		switch g.Scoring {
+		case "", GroupScoringAllOrNothing, GroupScoringProportional:
+		default:
+			return fmt.Errorf("test group %q has unknown scoring %q", g.Name, g.Scoring)
+		}
+		// Only earlier groups can be dependencies, which also rules out cycles
+		for _, dep := range g.DependsOn {
+			if !seen[dep] {
+				return fmt.Errorf("test group %q depends on %q, which must be defined before it", g.Name, dep)
+			}
+		}
+		seen[g.Name] = true
+	}
+
+	for i, tc := range testCases {
+		if tc.Group != "" && !seen[tc.Group] {
+			return fmt.Errorf("test case %d is in unknown group %q", i+1, tc.Group)
+		}
+	}
+	return nil
+}
+
+// insertTestGroups stores the groups of a new question and returns their IDs by name
+func insertTestGroups(tx *sql.Tx, questionID int64, groups []TestGroup) (map[string]int64, error) {
+	ids := map[string]int64{}
+	for position, g := range groups {
+		scoring := g.Scoring
+		if scoring == "" {
+			scoring = GroupScoringAllOrNothing
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO test_group (question_id, name, points, scoring, position)
+			VALUES (?, ?, ?, ?, ?)`,
+			questionID, g.Name, g.Points, scoring, position)
+		if err != nil {
+			return nil, fmt.Errorf("error creating test group: %w", err)
+		}
+		if ids[g.Name], err = result.LastInsertId(); err != nil {
+			return nil, fmt.Errorf("error getting new test group ID: %w", err)
+		}
+
+		for _, dep := range g.DependsOn {
+			_, err := tx.Exec(`
+				INSERT INTO test_group_dependency (group_id, depends_on_group_id)
+				VALUES (?, ?)`, ids[g.Name], ids[dep])
+			if err != nil {
+				return nil, fmt.Errorf("error creating test group dependency: %w", err)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// loadTestGroups returns the groups of a question in definition order
+func loadTestGroups(questionID int64) ([]TestGroup, error) {
+	rows, err := Con.Query(`
+		SELECT g.name, g.points, g.scoring, IFNULL(d.name, '')
+		FROM test_group g
+		LEFT JOIN test_group_dependency gd ON gd.group_id = g.id
+		LEFT JOIN test_group d ON d.id = gd.depends_on_group_id
+		WHERE g.question_id = ?
+		ORDER BY g.position, d.position`, questionID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving test groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []TestGroup
+	for rows.Next() {
+		var g TestGroup
+		var dep string
+		if err := rows.Scan(&g.Name, &g.Points, &g.Scoring, &dep); err != nil {
+			return nil, fmt.Errorf("error scanning test group row: %w", err)
+		}
+
+		// One row per dependency, so consecutive rows may belong to the same group
+		if n := len(groups); n > 0 && groups[n-1].Name == g.Name {
+			groups[n-1].DependsOn = append(groups[n-1].DependsOn, dep)
+			continue
+		}
+		if dep != "" {
+			g.DependsOn = []string{dep}
+		}
+		groups = append(groups, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating test group rows: %w", err)
+	}
+	return groups, nil
+}
+
+// scoreGroups computes the points earned in every group
+func scoreGroups(groups []TestGroup, testCases []evalTestCase, results []TestResult) []GroupScore {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	scores := make([]GroupScore, len(groups))
+	index := map[string]int{}
+	credit := make([]float64, len(groups))
+	for i, g := range groups {
+		scores[i] = GroupScore{Name: g.Name, Points: g.Points}
+		index[g.Name] = i
+	}
+
+	for i, tc := range testCases {
+		gi, ok := index[tc.Group]
+		if !ok {
+			continue
+		}
+		scores[gi].Total++
+		credit[gi] += results[i].Score
+		if results[i].Status == "PASS" {
+			scores[gi].Passed++
+		}
+	}
+
+	// Groups only depend on earlier ones, so one pass in order is enough
+	for i, g := range groups {
+		s := &scores[i]
+		for _, dep := range g.DependsOn {
+			d := scores[index[dep]]
+			if d.Skipped || d.Passed < d.Total {
+				s.Skipped = true
+			}
+		}
+		if s.Skipped || s.Total == 0 {
+			continue
+		}
+
+		if g.Scoring == GroupScoringProportional {
+			s.Earned = float64(g.Points) * credit[i] / float64(s.Total)
+		} else if s.Passed == s.Total {
+			s.Earned = float64(g.Points)
+		}
+	}
+	return scores
+}
+
+// groupPercentage converts group scores into a 0-100 score
+func groupPercentage(scores []GroupScore) float64 {
+	var earned, total float64
+	for _, s := range scores {
+		earned += s.Earned
+		total += float64(s.Points)
+	}
+	if total == 0 {
+		return 0
+	}
+	return earned / total * 100
+}
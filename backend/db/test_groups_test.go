@@ -0,0 +1,92 @@
+package db
+
+import "testing"
+
+func TestScoreGroups(t *testing.T) {
+	groups := []TestGroup{
+		{Name: "small", Points: 30},
+		{Name: "large", Points: 50, Scoring: GroupScoringProportional, DependsOn: []string{"small"}},
+		{Name: "extra", Points: 20, DependsOn: []string{"large"}},
+	}
+	testCases := []evalTestCase{
+		{Group: ""}, // sample, worth no points
+		{Group: "small"},
+		{Group: "small"},
+		{Group: "large"},
+		{Group: "large"},
+		{Group: "extra"},
+	}
+
+	pass := TestResult{Status: "PASS", Score: 1}
+	fail := TestResult{Status: "FAIL"}
+	partial := TestResult{Status: "FAIL", Score: 0.5}
+
+	tests := []struct {
+		name        string
+		results     []TestResult
+		wantEarned  []float64
+		wantSkipped []bool
+		wantPercent float64
+	}{
+		{
+			name:        "everything solved",
+			results:     []TestResult{fail, pass, pass, pass, pass, pass},
+			wantEarned:  []float64{30, 50, 20},
+			wantSkipped: []bool{false, false, false},
+			wantPercent: 100,
+		},
+		{
+			name:        "all or nothing group failed",
+			results:     []TestResult{pass, pass, fail, pass, pass, pass},
+			wantEarned:  []float64{0, 0, 0},
+			wantSkipped: []bool{false, true, true},
+			wantPercent: 0,
+		},
+		{
+			name:        "proportional credit",
+			results:     []TestResult{pass, pass, pass, pass, partial, pass},
+			wantEarned:  []float64{30, 37.5, 0},
+			wantSkipped: []bool{false, false, true},
+			wantPercent: 67.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores := scoreGroups(groups, testCases, tt.results)
+			if len(scores) != len(groups) {
+				t.Fatalf("got %d group scores, want %d", len(scores), len(groups))
+			}
+			for i, s := range scores {
+				if s.Earned != tt.wantEarned[i] || s.Skipped != tt.wantSkipped[i] {
+					t.Errorf("group %s earned %v skipped %v, want %v skipped %v", s.Name, s.Earned, s.Skipped, tt.wantEarned[i], tt.wantSkipped[i])
+				}
+			}
+			if got := groupPercentage(scores); got != tt.wantPercent {
+				t.Errorf("groupPercentage = %v, want %v", got, tt.wantPercent)
+			}
+		})
+	}
+}
+
+func TestScoreGroupsCounts(t *testing.T) {
+	groups := []TestGroup{{Name: "a", Points: 10}, {Name: "empty", Points: 10}}
+	testCases := []evalTestCase{{Group: "a"}, {Group: "a"}}
+	results := []TestResult{{Status: "PASS", Score: 1}, {Status: "FAIL"}}
+
+	scores := scoreGroups(groups, testCases, results)
+	if scores[0].Passed != 1 || scores[0].Total != 2 {
+		t.Errorf("group a passed %d of %d, want 1 of 2", scores[0].Passed, scores[0].Total)
+	}
+	// A group without test cases earns nothing rather than dividing by zero
+	if scores[1].Total != 0 || scores[1].Earned != 0 {
+		t.Errorf("empty group = %+v, want no points", scores[1])
+	}
+
+	if scoreGroups(nil, testCases, results) != nil {
+		t.Error("questions without groups should have no group scores")
+	}
+	if groupPercentage(nil) != 0 {
+		t.Error("groupPercentage of no groups should be 0")
+	}
+}
@@ -16,7 +16,30 @@ func main() {
 	}
 	defer db.Con.Close()
 
-	app := fiber.New()
+	if err := db.InitExecutor(); err != nil {
+		log.Fatal("Error configuring code executor:", err)
+	}
+
+	if err := db.InitMailer(); err != nil {
+		log.Fatal("Error configuring mailer:", err)
+	}
+
+	if err := db.InitOIDC(); err != nil {
+		log.Fatal("Error configuring SSO providers:", err)
+	}
+
+	if err := db.StartSubmissionWorkers(); err != nil {
+		log.Fatal("Error starting submission workers:", err)
+	}
+	db.StartAttemptSweeper()
+	if err := db.StartRejudgeWorker(); err != nil {
+		log.Fatal("Error starting rejudge worker:", err)
+	}
+
+	// Test case archives are larger than the default 4 MB body limit
+	app := fiber.New(fiber.Config{
+		BodyLimit: db.MaxTestArchiveBytes + 1<<20,
+	})
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:5173, http://127.0.0.1:5173,https://procode-2xh5.onrender.com,https://procode-alpha.vercel.app",
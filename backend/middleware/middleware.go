@@ -1,44 +1,115 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/kanishk-8/procode/db"
 )
 
 var jwtSecret = os.Getenv("jwt_secret_key") // Keep in env in production
 
-func RequireAuth(c *fiber.Ctx) error {
-	// Read JWT cookie
-	tokenStr := c.Cookies("jwt")
+// Principal is the logged-in user a request is made by, taken from the access token
+type Principal struct {
+	UserID    int64
+	Username  string
+	Email     string
+	Role      string // "admin", "teacher" or "student"
+	RoleID    string // Student or teacher ID the user signed up with
+	SessionID int64
+}
+
+// principalKey is the locals key Authenticate stores the principal under
+const principalKey = "principal"
+
+// Role middlewares for routes that need a logged-in user
+var (
+	RequireAuth        = Authenticate()
+	RequireAdminAuth   = Authenticate("admin")
+	RequireTeacherAuth = Authenticate("teacher")
+	RequireStudentAuth = Authenticate("student")
+)
+
+// Authenticate returns a middleware that verifies the jwt cookie and its
+// session and stores the Principal for CurrentPrincipal. With roles given,
+// other roles are refused.
+func Authenticate(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := parsePrincipal(c.Cookies("jwt"))
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Unauthorized - " + err.Error(),
+			})
+		}
+
+		if len(roles) > 0 && !slices.Contains(roles, principal.Role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": fmt.Sprintf("Access denied - %s role required", roles[0]),
+			})
+		}
+
+		active, err := db.SessionActive(principal.SessionID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Could not verify session",
+			})
+		}
+		if !active {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Unauthorized - session expired or revoked",
+			})
+		}
+
+		c.Locals(principalKey, principal)
+		return c.Next()
+	}
+}
+
+// CurrentPrincipal returns the user Authenticate let through; ok is false on
+// routes without authentication
+func CurrentPrincipal(c *fiber.Ctx) (*Principal, bool) {
+	principal, ok := c.Locals(principalKey).(*Principal)
+	return principal, ok
+}
+
+// parsePrincipal verifies an access token and reads its claims
+func parsePrincipal(tokenStr string) (*Principal, error) {
 	if tokenStr == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "Unauthorized - missing token",
-		})
+		return nil, errors.New("missing token")
 	}
 
-	// Parse & verify token
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		if token.Method != jwt.SigningMethodHS256 {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(jwtSecret), nil
 	})
-
 	if err != nil || !token.Valid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "Unauthorized - invalid token",
-		})
+		return nil, errors.New("invalid token")
 	}
 
-	// Set user info in locals (optional)
-	claims := token.Claims.(jwt.MapClaims)
-	c.Locals("userId", claims["userId"])
-	c.Locals("username", claims["username"])
-	c.Locals("email", claims["email"])
-	c.Locals("role", claims["role"])
-	c.Locals("roleId", claims["roleId"])
-	return c.Next()
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	userID, okUser := claims["userId"].(float64)
+	sessionID, okSession := claims["sid"].(float64)
+	role, okRole := claims["role"].(string)
+	if !okUser || !okSession || !okRole {
+		return nil, errors.New("invalid token")
+	}
+
+	principal := &Principal{
+		UserID:    int64(userID),
+		Role:      role,
+		SessionID: int64(sessionID),
+	}
+	principal.Username, _ = claims["username"].(string)
+	principal.Email, _ = claims["email"].(string)
+	principal.RoleID, _ = claims["roleId"].(string)
+	return principal, nil
 }
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// RunRateLimit limits how often a user can run code on custom input, to
+// RUN_RATE_LIMIT runs per minute (default 10). It should come after an auth
+// middleware, since requests are counted per user; without one they are
+// counted per IP address.
+var RunRateLimit = limiter.New(limiter.Config{
+	Max:        envLimit("RUN_RATE_LIMIT", 10),
+	Expiration: time.Minute,
+	KeyGenerator: func(c *fiber.Ctx) string {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			return "ip:" + c.IP()
+		}
+		return fmt.Sprint("user:", principal.UserID)
+	},
+	LimitReached: func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"message": "Too many runs, please wait a minute and try again",
+		})
+	},
+})
+
+// MailRateLimit limits how often account emails can be requested from one IP
+// address, to MAIL_RATE_LIMIT per 15 minutes (default 5)
+var MailRateLimit = limiter.New(limiter.Config{
+	Max:        envLimit("MAIL_RATE_LIMIT", 5),
+	Expiration: 15 * time.Minute,
+	LimitReached: func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"message": "Too many email requests, please try again later",
+		})
+	},
+})
+
+// PasswordRateLimit limits failed password attempts from one IP address, and
+// PasswordUserRateLimit those for one username from anywhere, to
+// PASSWORD_RATE_LIMIT per 15 minutes (default 10) each. They guard /login
+// and /change-password, which both check a password without a session.
+// Successful attempts aren't counted, so a class logging in from behind one
+// address isn't locked out.
+var (
+	PasswordRateLimit = limiter.New(limiter.Config{
+		Max:                    envLimit("PASSWORD_RATE_LIMIT", 10),
+		Expiration:             15 * time.Minute,
+		SkipSuccessfulRequests: true,
+		LimitReached:           passwordLimitReached,
+	})
+	PasswordUserRateLimit = limiter.New(limiter.Config{
+		Max:                    envLimit("PASSWORD_RATE_LIMIT", 10),
+		Expiration:             15 * time.Minute,
+		SkipSuccessfulRequests: true,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			var body struct {
+				Username string `json:"username"`
+			}
+			c.BodyParser(&body)
+			return "user:" + strings.ToLower(strings.TrimSpace(body.Username))
+		},
+		LimitReached: passwordLimitReached,
+	})
+)
+
+func passwordLimitReached(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"message": "Too many password attempts, please try again later",
+	})
+}
+
+func envLimit(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
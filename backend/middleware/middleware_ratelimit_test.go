@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPasswordUserRateLimit(t *testing.T) {
+	app := fiber.New()
+	app.Post("/login", PasswordUserRateLimit, func(c *fiber.Ctx) error {
+		var body struct {
+			Password string `json:"password"`
+		}
+		c.BodyParser(&body)
+		if body.Password != "right" {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	login := func(username, password string) int {
+		return send(t, app, "/login", fiber.MIMEApplicationJSON,
+			fmt.Sprintf(`{"username":%q,"password":%q}`, username, password))
+	}
+	max := envLimit("PASSWORD_RATE_LIMIT", 10)
+
+	for i := 0; i < max; i++ {
+		if got := login("guessed", "wrong"); got != fiber.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want %d", i+1, got, fiber.StatusUnauthorized)
+		}
+	}
+	if got := login("Guessed ", "right"); got != fiber.StatusTooManyRequests {
+		t.Errorf("status after %d failures = %d, want the username to be limited however it's written", max, got)
+	}
+	if got := login("other", "wrong"); got != fiber.StatusUnauthorized {
+		t.Errorf("status for another username = %d, want %d", got, fiber.StatusUnauthorized)
+	}
+
+	for i := 0; i < max+5; i++ {
+		if got := login("student", "right"); got != fiber.StatusOK {
+			t.Fatalf("login %d: status = %d, successful logins shouldn't be limited", i+1, got)
+		}
+	}
+}
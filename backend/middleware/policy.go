@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/db"
+)
+
+// Policy decides whether a principal may access a resource. Policies check
+// the role first, so users of other roles are refused without a query.
+type Policy func(p *Principal) (bool, error)
+
+// CanManageBatch allows the teacher of the batch
+func CanManageBatch(batchID int64) Policy {
+	return func(p *Principal) (bool, error) {
+		if p.Role != "teacher" {
+			return false, nil
+		}
+		return db.TeacherOwnsBatch(p.UserID, batchID)
+	}
+}
+
+// CanViewBatch allows the teacher of the batch and the students enrolled in it
+func CanViewBatch(batchID int64) Policy {
+	return AnyOf(CanManageBatch(batchID), func(p *Principal) (bool, error) {
+		if p.Role != "student" {
+			return false, nil
+		}
+		return db.StudentInBatch(p.UserID, batchID)
+	})
+}
+
+// CanManageQuestion allows the teacher of the question's batch
+func CanManageQuestion(questionID int64) Policy {
+	return func(p *Principal) (bool, error) {
+		if p.Role != "teacher" {
+			return false, nil
+		}
+		return db.TeacherOwnsQuestion(p.UserID, questionID)
+	}
+}
+
+// CanViewQuestion allows the teacher of the question's batch and the students
+// enrolled in it. Whether the question is open yet is up to the handler.
+func CanViewQuestion(questionID int64) Policy {
+	return AnyOf(CanManageQuestion(questionID), func(p *Principal) (bool, error) {
+		if p.Role != "student" {
+			return false, nil
+		}
+		return db.StudentCanSeeQuestion(p.UserID, questionID)
+	})
+}
+
+// CanEditAttempt allows the student the attempt belongs to
+func CanEditAttempt(attemptID int64) Policy {
+	return func(p *Principal) (bool, error) {
+		if p.Role != "student" {
+			return false, nil
+		}
+		return db.StudentOwnsAttempt(p.UserID, attemptID)
+	}
+}
+
+// CanViewSubmission allows the student who made the submission
+func CanViewSubmission(submissionID int64) Policy {
+	return func(p *Principal) (bool, error) {
+		if p.Role != "student" {
+			return false, nil
+		}
+		return db.StudentOwnsSubmission(p.UserID, submissionID)
+	}
+}
+
+// AnyOf allows the principal if one of the policies does
+func AnyOf(policies ...Policy) Policy {
+	return func(p *Principal) (bool, error) {
+		for _, policy := range policies {
+			allowed, err := policy(p)
+			if err != nil || allowed {
+				return allowed, err
+			}
+		}
+		return false, nil
+	}
+}
+
+// Authorize returns a middleware that checks a policy for the ID in a route
+// parameter. It goes after an auth middleware, and several can be chained:
+//
+//	app.Get("/getstudentsinbatch/:batchID", middleware.RequireTeacherAuth,
+//		middleware.Authorize("batchID", middleware.CanManageBatch))
+func Authorize(param string, policy func(id int64) Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.ParseInt(c.Params(param), 10, 64)
+		if err != nil || id <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid " + param,
+			})
+		}
+		return authorize(c, policy(id))
+	}
+}
+
+// AuthorizeBody is Authorize for an ID in the request body. The body is
+// parsed into T with BodyParser, the same way the handler parses it, and id
+// picks the ID out of it. A missing or zero ID is refused:
+//
+//	app.Post("/deletebatch", middleware.RequireTeacherAuth,
+//		middleware.AuthorizeBody("batch_id", func(r *DeleteBatchRequest) int64 { return r.BatchID }, middleware.CanManageBatch))
+func AuthorizeBody[T any](field string, id func(body *T) int64, policy func(id int64) Policy) fiber.Handler {
+	return authorizeBody(field, id, policy, true)
+}
+
+// AuthorizeOptionalBody is AuthorizeBody for routes where the ID is optional.
+// Without one the request goes on to the handler unchecked.
+func AuthorizeOptionalBody[T any](field string, id func(body *T) int64, policy func(id int64) Policy) fiber.Handler {
+	return authorizeBody(field, id, policy, false)
+}
+
+func authorizeBody[T any](field string, id func(body *T) int64, policy func(id int64) Policy, required bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body T
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid request body",
+			})
+		}
+
+		value := id(&body)
+		if value < 0 || (value == 0 && required) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid " + field,
+			})
+		}
+		if value == 0 {
+			return c.Next()
+		}
+		return authorize(c, policy(value))
+	}
+}
+
+// authorize checks the policy for the current principal
+func authorize(c *fiber.Ctx, policy Policy) error {
+	principal, ok := CurrentPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized - missing token",
+		})
+	}
+
+	allowed, err := policy(principal)
+	if err != nil {
+		log.Printf("Error checking access of user %d: %v", principal.UserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Could not check access",
+		})
+	}
+	if !allowed {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Access denied - you don't have permission to access this resource",
+		})
+	}
+	return c.Next()
+}
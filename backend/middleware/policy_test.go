@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakePolicy allows the IDs in allowed and records the ID it was asked about
+type fakePolicy struct {
+	allowed map[int64]bool
+	err     error
+	checked int64
+}
+
+func (f *fakePolicy) policy(id int64) Policy {
+	f.checked = id
+	return func(p *Principal) (bool, error) {
+		return f.allowed[id], f.err
+	}
+}
+
+// testApp serves route behind a middleware that logs in principal, when set,
+// and then the middlewares under test
+func testApp(principal *Principal, route string, handlers ...fiber.Handler) *fiber.App {
+	app := fiber.New()
+	login := func(c *fiber.Ctx) error {
+		if principal != nil {
+			c.Locals(principalKey, principal)
+		}
+		return c.Next()
+	}
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	app.Post(route, append(append([]fiber.Handler{login}, handlers...), ok)...)
+	return app
+}
+
+func send(t *testing.T, app *fiber.App, path, contentType, body string) int {
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestAuthorize(t *testing.T) {
+	teacher := &Principal{UserID: 1, Role: "teacher"}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		path      string
+		policyErr error
+		want      int
+	}{
+		{"allowed", teacher, "/batch/5", nil, fiber.StatusOK},
+		{"denied", teacher, "/batch/6", nil, fiber.StatusForbidden},
+		{"not a number", teacher, "/batch/five", nil, fiber.StatusBadRequest},
+		{"zero", teacher, "/batch/0", nil, fiber.StatusBadRequest},
+		{"negative", teacher, "/batch/-5", nil, fiber.StatusBadRequest},
+		{"not logged in", nil, "/batch/5", nil, fiber.StatusUnauthorized},
+		{"policy error", teacher, "/batch/5", errors.New("connection refused"), fiber.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &fakePolicy{allowed: map[int64]bool{5: true}, err: tt.policyErr}
+			app := testApp(tt.principal, "/batch/:batchID", Authorize("batchID", policy.policy))
+			if got := send(t, app, tt.path, "", ""); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// batchRequest is a request body as a handler would parse it
+type batchRequest struct {
+	BatchID int64  `json:"batch_id"`
+	Name    string `json:"name"`
+}
+
+func TestAuthorizeBody(t *testing.T) {
+	teacher := &Principal{UserID: 1, Role: "teacher"}
+	batchID := func(r *batchRequest) int64 { return r.BatchID }
+
+	tests := []struct {
+		name        string
+		optional    bool
+		contentType string
+		body        string
+		want        int
+		wantChecked int64
+	}{
+		{"allowed", false, fiber.MIMEApplicationJSON, `{"batch_id":5}`, fiber.StatusOK, 5},
+		{"denied", false, fiber.MIMEApplicationJSON, `{"batch_id":6}`, fiber.StatusForbidden, 6},
+		// encoding/json matches keys case-insensitively, so the handler would read these
+		{"key in upper case", false, fiber.MIMEApplicationJSON, `{"BATCH_ID":6}`, fiber.StatusForbidden, 6},
+		{"key in mixed case", false, fiber.MIMEApplicationJSON, `{"Batch_Id":6}`, fiber.StatusForbidden, 6},
+		{"missing", false, fiber.MIMEApplicationJSON, `{"name":"x"}`, fiber.StatusBadRequest, 0},
+		{"zero", false, fiber.MIMEApplicationJSON, `{"batch_id":0}`, fiber.StatusBadRequest, 0},
+		{"negative", false, fiber.MIMEApplicationJSON, `{"batch_id":-6}`, fiber.StatusBadRequest, 0},
+		{"wrong type", false, fiber.MIMEApplicationJSON, `{"batch_id":"6"}`, fiber.StatusBadRequest, 0},
+		{"not json", false, fiber.MIMEApplicationJSON, `batch_id=6`, fiber.StatusBadRequest, 0},
+		{"form encoded", false, fiber.MIMEApplicationForm, `BatchID=6`, fiber.StatusForbidden, 6},
+		{"form without the ID", false, fiber.MIMEApplicationForm, `name=x`, fiber.StatusBadRequest, 0},
+		{"unknown content type", false, fiber.MIMETextPlain, `{"batch_id":5}`, fiber.StatusBadRequest, 0},
+		{"optional and missing", true, fiber.MIMEApplicationJSON, `{"name":"x"}`, fiber.StatusOK, 0},
+		{"optional and set", true, fiber.MIMEApplicationJSON, `{"BATCH_ID":6}`, fiber.StatusForbidden, 6},
+		{"optional and negative", true, fiber.MIMEApplicationJSON, `{"batch_id":-6}`, fiber.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &fakePolicy{allowed: map[int64]bool{5: true}}
+			middleware := AuthorizeBody("batch_id", batchID, policy.policy)
+			if tt.optional {
+				middleware = AuthorizeOptionalBody("batch_id", batchID, policy.policy)
+			}
+
+			app := testApp(teacher, "/batch", middleware)
+			if got := send(t, app, "/batch", tt.contentType, tt.body); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+			if policy.checked != tt.wantChecked {
+				t.Errorf("policy checked batch %d, want %d", policy.checked, tt.wantChecked)
+			}
+		})
+	}
+}
+
+func TestAuthorizeBodyLeavesBodyForHandler(t *testing.T) {
+	policy := &fakePolicy{allowed: map[int64]bool{5: true}}
+	app := fiber.New()
+	app.Post("/batch", func(c *fiber.Ctx) error {
+		c.Locals(principalKey, &Principal{UserID: 1, Role: "teacher"})
+		return c.Next()
+	}, AuthorizeBody("batch_id", func(r *batchRequest) int64 { return r.BatchID }, policy.policy), func(c *fiber.Ctx) error {
+		var req batchRequest
+		if err := c.BodyParser(&req); err != nil || req.BatchID != 5 || req.Name != "x" {
+			return c.SendStatus(fiber.StatusTeapot)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	if got := send(t, app, "/batch", fiber.MIMEApplicationJSON, `{"batch_id":5,"name":"x"}`); got != fiber.StatusOK {
+		t.Errorf("status = %d, the handler should parse the same body", got)
+	}
+}
+
+func TestPoliciesCheckRoleFirst(t *testing.T) {
+	// Policies refuse other roles before querying, so no database is needed
+	student := &Principal{UserID: 1, Role: "student"}
+	teacher := &Principal{UserID: 1, Role: "teacher"}
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		principal *Principal
+	}{
+		{"student managing a batch", CanManageBatch(1), student},
+		{"student managing a question", CanManageQuestion(1), student},
+		{"teacher editing an attempt", CanEditAttempt(1), teacher},
+		{"teacher viewing a submission", CanViewSubmission(1), teacher},
+		{"admin viewing a batch", CanViewBatch(1), &Principal{UserID: 1, Role: "admin"}},
+		{"admin viewing a question", CanViewQuestion(1), &Principal{UserID: 1, Role: "admin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, err := tt.policy(tt.principal)
+			if allowed || err != nil {
+				t.Errorf("policy = %v, %v, want refused", allowed, err)
+			}
+		})
+	}
+}
+
+func TestAnyOf(t *testing.T) {
+	allow := func(p *Principal) (bool, error) { return true, nil }
+	deny := func(p *Principal) (bool, error) { return false, nil }
+	fail := func(p *Principal) (bool, error) { return false, errors.New("connection refused") }
+
+	tests := []struct {
+		name        string
+		policies    []Policy
+		wantAllowed bool
+		wantErr     bool
+	}{
+		{"none", nil, false, false},
+		{"one allows", []Policy{deny, allow}, true, false},
+		{"all deny", []Policy{deny, deny}, false, false},
+		{"error stops", []Policy{fail, allow}, false, true},
+		{"allowed before error", []Policy{allow, fail}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, err := AnyOf(tt.policies...)(&Principal{})
+			if allowed != tt.wantAllowed || (err != nil) != tt.wantErr {
+				t.Errorf("AnyOf = %v, %v, want %v with error %v", allowed, err, tt.wantAllowed, tt.wantErr)
+			}
+		})
+	}
+}
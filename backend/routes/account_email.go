@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/db"
+)
+
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// VerifyEmailHandler confirms an email address with the token from the verification email
+func VerifyEmailHandler(c *fiber.Ctx) error {
+	var body TokenRequest
+	if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Token) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Token is required",
+		})
+	}
+
+	if err := db.VerifyEmail(body.Token); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{"message": "Email verified, you can now log in"})
+}
+
+// ResendVerificationHandler mails a new verification link. The response is
+// the same whether or not the address has an unverified account.
+func ResendVerificationHandler(c *fiber.Ctx) error {
+	var body EmailRequest
+	if err := c.BodyParser(&body); err != nil || !isValidEmail(strings.TrimSpace(body.Email)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "A valid email is required",
+		})
+	}
+
+	if err := db.ResendVerificationEmail(strings.TrimSpace(body.Email)); err != nil {
+		log.Printf("Error resending verification email: %v", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "If the address belongs to an unverified account, a new verification link is on its way",
+	})
+}
+
+// ForgotPasswordHandler mails a password reset link. The response is the
+// same whether or not the address has an account.
+func ForgotPasswordHandler(c *fiber.Ctx) error {
+	var body EmailRequest
+	if err := c.BodyParser(&body); err != nil || !isValidEmail(strings.TrimSpace(body.Email)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "A valid email is required",
+		})
+	}
+
+	if err := db.RequestPasswordReset(strings.TrimSpace(body.Email)); err != nil {
+		log.Printf("Error sending password reset email: %v", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "If the address belongs to an account, a password reset link is on its way",
+	})
+}
+
+// ResetPasswordHandler sets a new password with the token from the reset email
+func ResetPasswordHandler(c *fiber.Ctx) error {
+	var body ResetPasswordRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	body.Token = strings.TrimSpace(body.Token)
+	if body.Token == "" || body.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Token and new password are required",
+		})
+	}
+
+	if err := db.ResetPassword(body.Token, body.NewPassword); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{"message": "Password reset, you can now log in"})
+}
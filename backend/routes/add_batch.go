@@ -5,6 +5,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
 type AddBatchRequest struct {
@@ -26,13 +27,13 @@ func AddBatchHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Invalid user ID",
 		})
 	}
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 	log.Println(userID)
 	batchID, err := db.CreateBatch(req.Name, userID)
 	if err != nil {
@@ -1,10 +1,13 @@
 package routes
 
 import (
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
 //expected payload
@@ -32,19 +35,108 @@ import (
 //   }
 
 type TestCase struct {
-	InputText      string `json:"input_text"`
-	ExpectedOutput string `json:"expected_output"`
-	IsHidden       bool   `json:"is_hidden"`
+	InputText      string   `json:"input_text"`
+	ExpectedOutput string   `json:"expected_output"`
+	IsHidden       bool     `json:"is_hidden"`
+	CPUTimeLimit   *float64 `json:"cpu_time_limit"` // Overrides the question default, in seconds
+	MemoryLimit    *int     `json:"memory_limit"`   // Overrides the question default, in KB
+	StackLimit     *int     `json:"stack_limit"`    // Overrides the question default, in KB
+	Comparator     string   `json:"comparator"`     // Overrides the question comparator
+	Tolerance      *float64 `json:"comparator_tolerance"`
+	Group          string   `json:"group"` // Name of the test group (subtask) this case belongs to
 }
 
 type AddQuestionRequest struct {
-	BatchID     int64      `json:"batch_id"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	TestCases   []TestCase `json:"test_cases"`
-	TimeLimit   int        `json:"time_limit"` // Time limit in minutes
-	StartTime   string     `json:"start_time"` // Add start_time field
-	EndTime     string     `json:"end_time"`   // Add end_time field
+	BatchID      int64      `json:"batch_id"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	Type         string     `json:"type"` // standard (default), interactive or function
+	TestCases    []TestCase `json:"test_cases"`
+	TimeLimit    int        `json:"time_limit"`     // Time limit in minutes
+	StartTime    string     `json:"start_time"`     // Add start_time field
+	EndTime      string     `json:"end_time"`       // Add end_time field
+	CPUTimeLimit *float64   `json:"cpu_time_limit"` // Default CPU time per test case, in seconds
+	MemoryLimit  *int       `json:"memory_limit"`   // Default memory per test case, in KB
+	StackLimit   *int       `json:"stack_limit"`    // Default stack size per test case, in KB
+	// How outputs are compared: exact (default), tokens, case_insensitive,
+	// float_abs, float_rel, unordered_lines or regex
+	Comparator string   `json:"comparator"`
+	Tolerance  *float64 `json:"comparator_tolerance"` // Used by float_abs and float_rel
+	// Optional checker program that judges outputs instead of the comparator
+	Checker *Checker `json:"checker"`
+	// Program the submission talks to in interactive questions, same shape as a checker
+	Interactor *Checker `json:"interactor"`
+	// Signature students implement in function questions. Each test case
+	// input then has one JSON value per line, one per parameter, and the
+	// expected output is the JSON of the return value.
+	Function *FunctionSignature `json:"function"`
+	// Optional subtasks; when set, the score comes from group points instead
+	// of the share of passed test cases
+	Groups []TestGroup `json:"groups"`
+	// Graded submissions allowed (default 1) and how their scores combine:
+	// best (default), last, or penalty with submission_penalty points
+	// deducted per earlier wrong submission
+	MaxSubmissions int    `json:"max_submissions"`
+	ScoringPolicy  string `json:"scoring_policy"`
+	Penalty        int    `json:"submission_penalty"`
+	// Teacher's solution, same shape as a checker. Test cases with an empty
+	// expected_output get its output, the others must pass with it.
+	Reference *Checker `json:"reference_solution"`
+}
+
+type Checker struct {
+	Code       string `json:"code"`
+	LanguageID int    `json:"language_id"`
+}
+
+type FunctionSignature struct {
+	Name   string `json:"name"`
+	Params []struct {
+		Name string `json:"name"`
+		Type string `json:"type"` // int, long, float, bool or string, with [] per array dimension
+	} `json:"params"`
+	ReturnType string `json:"return_type"`
+}
+
+type TestGroup struct {
+	Name      string   `json:"name"`
+	Points    int      `json:"points"`
+	Scoring   string   `json:"scoring"`    // all_or_nothing (default) or proportional
+	DependsOn []string `json:"depends_on"` // Groups that must be fully solved first
+}
+
+// resourceLimits validates optional execution limits from a request
+func resourceLimits(cpuTimeLimit *float64, memoryLimit, stackLimit *int) (db.ResourceLimits, error) {
+	if cpuTimeLimit != nil && *cpuTimeLimit <= 0 {
+		return db.ResourceLimits{}, errors.New("cpu_time_limit must be positive")
+	}
+	if memoryLimit != nil && *memoryLimit <= 0 {
+		return db.ResourceLimits{}, errors.New("memory_limit must be positive")
+	}
+	if stackLimit != nil && *stackLimit <= 0 {
+		return db.ResourceLimits{}, errors.New("stack_limit must be positive")
+	}
+	return db.ResourceLimits{
+		CPUTimeLimit: cpuTimeLimit,
+		MemoryLimit:  memoryLimit,
+		StackLimit:   stackLimit,
+	}, nil
+}
+
+// parseQuestionTime parses an optional start or end time, in RFC3339 or the
+// datetime-local format (YYYY-MM-DDTHH:MM) the frontend sends
+func parseQuestionTime(value string) (*time.Time, error) {
+	if value == "" || value == "null" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		parsed, err = time.Parse("2006-01-02T15:04", value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &parsed, nil
 }
 
 func AddQuestionHandler(c *fiber.Ctx) error {
@@ -57,6 +149,11 @@ func AddQuestionHandler(c *fiber.Ctx) error {
 	}
 
 	// Validate required fields
+	if req.BatchID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Batch ID is required",
+		})
+	}
 	if req.Title == "" || req.Description == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Title and description are required",
@@ -64,56 +161,55 @@ func AddQuestionHandler(c *fiber.Ctx) error {
 	}
 
 	// Get user ID from context (set by auth middleware)
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Invalid user ID",
 		})
 	}
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 
 	// Convert the TestCase slice to db.TestCase slice
 	dbTestCases := make([]db.TestCase, len(req.TestCases))
 	for i, tc := range req.TestCases {
+		limits, err := resourceLimits(tc.CPUTimeLimit, tc.MemoryLimit, tc.StackLimit)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid limits for test case " + strconv.Itoa(i+1) + ": " + err.Error(),
+			})
+		}
 		dbTestCases[i] = db.TestCase{
 			InputText:      tc.InputText,
 			ExpectedOutput: tc.ExpectedOutput,
 			IsHidden:       tc.IsHidden,
+			Limits:         limits,
+			Comparator:     db.Comparator{Type: tc.Comparator, Tolerance: tc.Tolerance},
+			Group:          tc.Group,
 		}
 	}
 
+	questionLimits, err := resourceLimits(req.CPUTimeLimit, req.MemoryLimit, req.StackLimit)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid limits: " + err.Error(),
+		})
+	}
+
 	// Parse start and end times if provided
 	var startTime, endTime *time.Time
 
-	// Handle datetime-local format (YYYY-MM-DDTHH:MM) from frontend
-	if req.StartTime != "" && req.StartTime != "null" {
-		// First try RFC3339 format
-		parsedStart, err := time.Parse(time.RFC3339, req.StartTime)
-		if err != nil {
-			// If RFC3339 fails, try the format from datetime-local input
-			parsedStart, err = time.Parse("2006-01-02T15:04", req.StartTime)
-			if err != nil {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"message": "Invalid start time format: " + err.Error(),
-				})
-			}
-		}
-		startTime = &parsedStart
+	startTime, err = parseQuestionTime(req.StartTime)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid start time format: " + err.Error(),
+		})
 	}
 
-	if req.EndTime != "" && req.EndTime != "null" {
-		// First try RFC3339 format
-		parsedEnd, err := time.Parse(time.RFC3339, req.EndTime)
-		if err != nil {
-			// If RFC3339 fails, try the format from datetime-local input
-			parsedEnd, err = time.Parse("2006-01-02T15:04", req.EndTime)
-			if err != nil {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"message": "Invalid end time format: " + err.Error(),
-				})
-			}
-		}
-		endTime = &parsedEnd
+	endTime, err = parseQuestionTime(req.EndTime)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid end time format: " + err.Error(),
+		})
 	}
 
 	// Validate that end time is after start time if both are provided
@@ -123,6 +219,34 @@ func AddQuestionHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	var checker *db.Checker
+	if req.Checker != nil {
+		checker = &db.Checker{Code: req.Checker.Code, LanguageID: req.Checker.LanguageID}
+	}
+
+	var interactor *db.Interactor
+	if req.Interactor != nil {
+		interactor = &db.Interactor{Code: req.Interactor.Code, LanguageID: req.Interactor.LanguageID}
+	}
+
+	var function *db.FunctionSignature
+	if req.Function != nil {
+		function = &db.FunctionSignature{Name: req.Function.Name, ReturnType: req.Function.ReturnType}
+		for _, p := range req.Function.Params {
+			function.Params = append(function.Params, db.FunctionParam{Name: p.Name, Type: p.Type})
+		}
+	}
+
+	var reference *db.ReferenceSolution
+	if req.Reference != nil {
+		reference = &db.ReferenceSolution{Code: req.Reference.Code, LanguageID: req.Reference.LanguageID}
+	}
+
+	groups := make([]db.TestGroup, len(req.Groups))
+	for i, g := range req.Groups {
+		groups[i] = db.TestGroup{Name: g.Name, Points: g.Points, Scoring: g.Scoring, DependsOn: g.DependsOn}
+	}
+
 	questionID, err := db.CreateQuestion(
 		userID,
 		req.BatchID,
@@ -132,9 +256,29 @@ func AddQuestionHandler(c *fiber.Ctx) error {
 		req.TimeLimit,
 		startTime,
 		endTime,
+		db.QuestionOptions{
+			Type:       req.Type,
+			Limits:     questionLimits,
+			Comparator: db.Comparator{Type: req.Comparator, Tolerance: req.Tolerance},
+			Checker:    checker,
+			Interactor: interactor,
+			Function:   function,
+			Groups:     groups,
+			Grading: db.GradingPolicy{
+				Scoring:        req.ScoringPolicy,
+				MaxSubmissions: req.MaxSubmissions,
+				Penalty:        req.Penalty,
+			},
+			Reference: reference,
+		},
 	)
 
 	if err != nil {
+		if err.Error() == "batch not found or you don't have permission to add questions to it" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to create question: " + err.Error(),
 		})
@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/db"
+)
+
+// SaveDraftRequest is the editor contents of an in-progress attempt
+type SaveDraftRequest struct {
+	Code       string `json:"code"`
+	LanguageID int    `json:"language_id"`
+}
+
+// SaveDraftHandler autosaves the student's code on their in-progress attempt
+func SaveDraftHandler(c *fiber.Ctx) error {
+	attemptID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid attempt ID",
+		})
+	}
+
+	var req SaveDraftRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body: " + err.Error(),
+		})
+	}
+
+	if req.LanguageID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Language ID is required",
+		})
+	}
+	if len(req.Code) > db.MaxDraftBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"message": "Draft is too large",
+		})
+	}
+
+	draft, err := db.SaveDraft(attemptID, req.Code, req.LanguageID)
+	if err != nil {
+		switch err.Error() {
+		case "attempt not found":
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Attempt not found",
+			})
+		case "this attempt is already over", "the time for this attempt is over":
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		case "draft saved too recently, try again later":
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to save draft: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Draft saved",
+		"data":    fiber.Map{"saved_at": draft.SavedAt},
+	})
+}
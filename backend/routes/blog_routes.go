@@ -6,24 +6,22 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
 // CreateBlogHandler handles the creation of new blogs
 func CreateBlogHandler(c *fiber.Ctx) error {
 	// Get user ID from context (set by auth middleware)
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "Unauthorized",
 		})
 	}
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 
 	// Get user role
-	userRole, ok := c.Locals("role").(string)
-	if !ok {
-		userRole = "student" // Default to student if not found
-	}
+	userRole := principal.Role
 
 	// Parse request body
 	type CreateBlogRequest struct {
@@ -193,7 +191,7 @@ func VerifyBlogHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	userID, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "User not authenticated",
@@ -201,7 +199,7 @@ func VerifyBlogHandler(c *fiber.Ctx) error {
 	}
 
 	// Verify blog (this is a one-time operation)
-	err := db.UpdateBlogStatus(req.BlogID, int64(userID), req.Status)
+	err := db.UpdateBlogStatus(req.BlogID, principal.UserID, req.Status)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to verify blog: " + err.Error(),
@@ -216,13 +214,13 @@ func VerifyBlogHandler(c *fiber.Ctx) error {
 // DeleteBlogHandler handles the deletion of blogs by their creators
 func DeleteBlogHandler(c *fiber.Ctx) error {
 	// Get user ID from context (set by auth middleware)
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "Unauthorized",
 		})
 	}
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 
 	// Parse request body
 	type DeleteBlogRequest struct {
@@ -268,13 +266,13 @@ func DeleteBlogHandler(c *fiber.Ctx) error {
 // RequestBlogDeletionHandler handles deletion requests by teachers
 func RequestBlogDeletionHandler(c *fiber.Ctx) error {
 	// Get user ID from context (set by auth middleware)
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "Unauthorized",
 		})
 	}
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 
 	// Parse request body
 	type RequestDeletionRequest struct {
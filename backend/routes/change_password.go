@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/db"
+)
+
+type ChangePasswordRequest struct {
+	Username        string `json:"username"`
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePasswordHandler replaces a user's password. It takes the current
+// credentials rather than a session, so accounts that must change their
+// password before logging in can use it too.
+func ChangePasswordHandler(c *fiber.Ctx) error {
+	var body ChangePasswordRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	// Passwords are used as typed, spaces included
+	body.Username = strings.TrimSpace(body.Username)
+	if body.Username == "" || body.CurrentPassword == "" || body.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Username, current password and new password are required",
+		})
+	}
+
+	if err := db.ChangePassword(body.Username, body.CurrentPassword, body.NewPassword); err != nil {
+		if err.Error() == "invalid username or password" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password changed successfully",
+	})
+}
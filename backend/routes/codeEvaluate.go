@@ -3,6 +3,7 @@ package routes
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
 // CodeSubmission represents the structure of a code submission request
@@ -13,16 +14,16 @@ type CodeSubmission struct {
 	CalculateScore bool   `json:"calculate_score"` // Added flag for score calculation
 }
 
-// CodeEvaluateHandler handles the API endpoint for evaluating code submissions
+// CodeEvaluateHandler queues a code submission for evaluation
 func CodeEvaluateHandler(c *fiber.Ctx) error {
 	// Get userID from context (session) - same approach as in get_question_details_by_id.go
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Invalid user ID",
 		})
 	}
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 
 	// Parse request body to get submission details
 	var submission CodeSubmission
@@ -45,17 +46,27 @@ func CodeEvaluateHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	// Call the db function to evaluate the code, passing the calculateScore flag
-	result, err := db.EvaluateCode(userID, submission.QuestionID, submission.Code, submission.LanguageID, submission.CalculateScore)
+	// Queue the submission, the result is polled from /submission/:id
+	submissionID, err := db.EnqueueSubmission(userID, submission.QuestionID, submission.Code, submission.LanguageID, submission.CalculateScore)
 	if err != nil {
+		switch err.Error() {
+		case "this question is not available yet", "the time for this attempt is over",
+			"student is not enrolled in the batch containing this question":
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to evaluate code: " + err.Error(),
 		})
 	}
 
-	// Return the evaluation results
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Code evaluation completed",
-		"data":    result,
+	// Return the submission ID right away
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Code submitted for evaluation",
+		"data": fiber.Map{
+			"submission_id": submissionID,
+			"status":        db.SubmissionQueued,
+		},
 	})
 }
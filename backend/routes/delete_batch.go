@@ -3,6 +3,7 @@ package routes
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
 type DeleteBatchRequest struct {
@@ -25,18 +26,22 @@ func DeleteBatchHandler(c *fiber.Ctx) error {
 	}
 
 	// Extract user ID from context (set by auth middleware)
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Invalid user ID",
 		})
 	}
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 
 	// Call the DeleteBatch function from db package
 	err := db.DeleteBatch(req.BatchID, userID)
 	if err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		status := fiber.StatusInternalServerError
+		if err.Error() == "batch not found or you don't have permission to delete it" {
+			status = fiber.StatusForbidden
+		}
+		return c.Status(status).JSON(fiber.Map{
 			"message": "Failed to delete batch: " + err.Error(),
 		})
 	}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
 func GetQuestionDetailsByIDHandler(c *fiber.Ctx) error {
@@ -41,13 +42,13 @@ func GetQuestionDetailsByIDHandler(c *fiber.Ctx) error {
 	}
 
 	// Get userID from context
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Invalid user ID",
 		})
 	}
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 
 	// Call the DB function
 	questionWithTestCases, err := db.GetQuestionByID(userID, batchID, questionID)
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
 func GetQuestionsByBatchHandler(c *fiber.Ctx) error {
@@ -23,13 +24,13 @@ func GetQuestionsByBatchHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Invalid user ID",
 		})
 	}
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 
 	batchWithQuestions, err := db.GetQuestionsByBatch(userID, batchID)
 	if err != nil {
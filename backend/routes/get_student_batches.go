@@ -3,18 +3,19 @@ package routes
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
 func GetStudentBatchesHandler(c *fiber.Ctx) error {
 	// Get the user ID from the context (set by authentication middleware)
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Invalid user ID",
 		})
 	}
 
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 
 	// Fetch batches using the DB function
 	batches, err := db.GetBatchesByStudent(userID)
@@ -25,17 +25,8 @@ func GetStudentsInBatchHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get userID from JWT token
-	userIDFloat, ok := c.Locals("userId").(float64)
-	if !ok {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid user ID",
-		})
-	}
-	userID := int64(userIDFloat)
-
 	// Get students in the batch using the db function
-	students, err := db.GetStudentsInBatch(batchID, userID)
+	students, err := db.GetStudentsInBatch(batchID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to get students: " + err.Error(),
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
 func JoinBatchByParamHandler(c *fiber.Ctx) error {
@@ -24,13 +25,13 @@ func JoinBatchByParamHandler(c *fiber.Ctx) error {
 	}
 
 	// Extract user ID from context
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Invalid user ID",
 		})
 	}
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 
 	// Call the JoinBatch function from db package
 	err = db.JoinBatch(batchId, userID)
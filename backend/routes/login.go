@@ -4,10 +4,8 @@ import (
 	"log"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/kanishk-8/procode/db"
 )
 
@@ -15,8 +13,7 @@ var jwtSecret = os.Getenv("jwt_secret_key")
 
 type LoginRequest struct {
 	Username string `json:"username"`
-	Password string `json:"password"` // This is now the final hash
-	Nonce    string `json:"nonce"`
+	Password string `json:"password"` // Plaintext, the server only sees it over TLS
 }
 
 type LoginResponse struct {
@@ -37,10 +34,8 @@ func LoginHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	// Trim input
+	// Trim input, but not the password
 	body.Username = strings.TrimSpace(body.Username)
-	body.Password = strings.TrimSpace(body.Password)
-	body.Nonce = strings.TrimSpace(body.Nonce)
 
 	// Validate input
 	if body.Username == "" {
@@ -49,71 +44,38 @@ func LoginHandler(c *fiber.Ctx) error {
 	if body.Password == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Password is required"})
 	}
-	if body.Nonce == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Nonce is required"})
-	}
 
-	// Check credentials with nonce
-	user, err := db.GetUserByCredentials(body.Username, body.Password, body.Nonce)
+	// Check credentials
+	user, err := db.GetUserByCredentials(body.Username, body.Password)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": err.Error(),
 		})
 	}
-	log.Println(user.Role)
-	// JWT generation and persistent cookie
-	claims := jwt.MapClaims{
-		"userId":   user.ID,
-		"username": user.Username,
-		"email":    user.Email,  // Add email to claims
-		"role":     user.Role,   // Add role to claims
-		"roleId":   user.RoleID, // Add roleId to claims
-		"exp":      time.Now().Add(15 * time.Minute).Unix(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(jwtSecret))
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Could not generate token",
+
+	// Accounts with a default or compromised password get no session until it is changed
+	if user.MustChangePassword {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message":                "You must change your password before logging in",
+			"passwordChangeRequired": true,
 		})
 	}
-	refreshClaims := jwt.MapClaims{
-		"userId":   user.ID,
-		"username": user.Username,
-		"email":    user.Email, // Add email to claims
-		"role":     user.Role,  // Add role to claims
-		"roleId":   user.RoleID,
-		"exp":      time.Now().Add(7 * 24 * time.Hour).Unix(),
+	// Unverified accounts have to confirm their email address first
+	if !user.EmailVerified {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message":                   "Please verify your email address before logging in",
+			"emailVerificationRequired": true,
+		})
 	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	signedRefreshToken, err := refreshToken.SignedString([]byte(jwtSecret))
-	if err != nil {
+
+	// Server-side session with JWT access and refresh cookies
+	if err := startSession(c, user); err != nil {
+		log.Printf("Error starting session for user %d: %v", user.ID, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Could not generate refresh token",
+			"message": "Could not start session",
 		})
 	}
 
-	// Set cookie with improved settings
-	c.Cookie(&fiber.Cookie{
-		Name:     "jwt",
-		Value:    signedToken,
-		Expires:  time.Now().Add(15 * time.Minute),
-		HTTPOnly: true,
-		SameSite: "None", // Use Lax for most cases, "None" for cross-origin with Secure:true
-		Path:     "/",    // Make cookie available on all paths
-		Secure:   false,  // Set to true in production with HTTPS
-		Domain:   "",     // Using default domain
-	})
-	c.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    signedRefreshToken,
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-		HTTPOnly: true,
-		SameSite: "None",
-		Path:     "/refresh",
-		Secure:   false,
-	})
-
 	// Return successful login with user data and token
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Login successful",
@@ -1,33 +1,39 @@
 package routes
 
 import (
-	"time"
-
 	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
+// LogoutHandler ends the current session, so its refresh token stops working
 func LogoutHandler(c *fiber.Ctx) error {
-	// Clear access token cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "jwt",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		HTTPOnly: true,
-		SameSite: "None",
-		Path:     "/",
-		Secure:   false,
-	})
+	principal, _ := middleware.CurrentPrincipal(c)
 
-	// Clear refresh token cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		HTTPOnly: true,
-		SameSite: "None",
-		Path:     "/refresh",
-		Secure:   false,
-	})
+	if err := db.RevokeSession(principal.UserID, principal.SessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to log out",
+		})
+	}
 
+	clearSessionCookies(c)
 	return c.JSON(fiber.Map{"message": "Logged out successfully"})
 }
+
+// LogoutAllHandler ends every session of the user, on all devices
+func LogoutAllHandler(c *fiber.Ctx) error {
+	principal, _ := middleware.CurrentPrincipal(c)
+
+	revoked, err := db.RevokeUserSessions(principal.UserID, "logout_all")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to log out",
+		})
+	}
+
+	clearSessionCookies(c)
+	return c.JSON(fiber.Map{
+		"message": "Logged out of all devices",
+		"data":    fiber.Map{"sessions_revoked": revoked},
+	})
+}
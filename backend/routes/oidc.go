@@ -0,0 +1,169 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/kanishk-8/procode/db"
+)
+
+// oidcFlowLifetime is how long the user has to log in at the provider
+const oidcFlowLifetime = 10 * time.Minute
+
+// OIDCProvidersHandler lists the SSO providers for the login page
+func OIDCProvidersHandler(c *fiber.Ctx) error {
+	providers := make([]fiber.Map, 0, len(db.OIDCProviders))
+	for _, p := range db.OIDCProviders {
+		providers = append(providers, fiber.Map{"name": p.Name, "label": p.Label})
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i]["name"].(string) < providers[j]["name"].(string)
+	})
+	return c.JSON(fiber.Map{"data": providers})
+}
+
+// OIDCLoginHandler sends the browser to the provider's login page. The state,
+// nonce and PKCE verifier of the flow are kept in a signed cookie until the
+// callback.
+func OIDCLoginHandler(c *fiber.Ctx) error {
+	provider, ok := db.OIDCProviders[c.Params("provider")]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Unknown SSO provider"})
+	}
+
+	state, nonce, verifier := randomToken(), randomToken(), randomToken()
+	flow := jwt.MapClaims{
+		"provider": provider.Name,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(oidcFlowLifetime).Unix(),
+	}
+	signedFlow, err := jwt.NewWithClaims(jwt.SigningMethodHS256, flow).SignedString([]byte(jwtSecret))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not start SSO login"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("Error starting SSO login with %s: %v", provider.Name, err)
+		return ssoFailed(c, "The SSO provider is unavailable, please try again later")
+	}
+
+	// Lax, since the provider sends the browser back with a top-level GET
+	c.Cookie(&fiber.Cookie{
+		Name:     "oidc_flow",
+		Value:    signedFlow,
+		Expires:  time.Now().Add(oidcFlowLifetime),
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Path:     "/auth/oidc",
+		Secure:   false, // Set to true in production with HTTPS
+	})
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// OIDCCallbackHandler finishes an SSO login: it checks the flow cookie,
+// verifies the user's identity with the provider, links it to a user and
+// sets the same cookies as LoginHandler before sending the browser back to
+// the frontend
+func OIDCCallbackHandler(c *fiber.Ctx) error {
+	provider, ok := db.OIDCProviders[c.Params("provider")]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Unknown SSO provider"})
+	}
+
+	flowCookie := c.Cookies("oidc_flow")
+	c.Cookie(&fiber.Cookie{
+		Name:     "oidc_flow",
+		Value:    "",
+		Expires:  time.Now().Add(-1 * time.Hour),
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Path:     "/auth/oidc",
+		Secure:   false,
+	})
+
+	if errCode := c.Query("error"); errCode != "" {
+		log.Printf("SSO login with %s failed: %s %s", provider.Name, errCode, c.Query("error_description"))
+		return ssoFailed(c, "SSO login was cancelled or failed")
+	}
+
+	nonce, verifier, err := parseOIDCFlow(flowCookie, provider.Name, c.Query("state"))
+	if err != nil {
+		return ssoFailed(c, "SSO login expired, please try again")
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+	identity, err := provider.Exchange(ctx, c.Query("code"), nonce, verifier)
+	if err != nil {
+		log.Printf("Error finishing SSO login with %s: %v", provider.Name, err)
+		if err.Error() == "your account is not allowed to use ProCode" {
+			return ssoFailed(c, "Your account is not allowed to use ProCode")
+		}
+		return ssoFailed(c, "Could not verify your SSO login")
+	}
+
+	user, err := db.LoginWithIdentity(identity)
+	if err != nil {
+		log.Printf("Error logging in %s identity %s: %v", provider.Name, identity.Subject, err)
+		switch err.Error() {
+		case "teacher account not yet approved", "admin accounts can't log in through SSO",
+			"an account with this email already exists, log in with your password":
+			return ssoFailed(c, err.Error())
+		}
+		return ssoFailed(c, "Could not log you in")
+	}
+
+	if err := startSession(c, user); err != nil {
+		log.Printf("Error starting session for user %d: %v", user.ID, err)
+		return ssoFailed(c, "Could not start session")
+	}
+	return c.Redirect(db.AppURL()+"/login?sso=success", fiber.StatusFound)
+}
+
+// ssoFailed sends the browser back to the login page with an error to show
+func ssoFailed(c *fiber.Ctx, message string) error {
+	return c.Redirect(db.AppURL()+"/login?sso_error="+url.QueryEscape(message), fiber.StatusFound)
+}
+
+// parseOIDCFlow verifies the flow cookie against the provider and state of
+// the callback and returns the nonce and PKCE verifier
+func parseOIDCFlow(flowCookie, provider, state string) (nonce, verifier string, err error) {
+	token, err := jwt.Parse(flowCookie, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(jwtSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return "", "", errors.New("invalid or expired SSO flow")
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if claims["provider"] != provider || state == "" || claims["state"] != state {
+		return "", "", errors.New("invalid SSO state")
+	}
+	nonce, _ = claims["nonce"].(string)
+	verifier, _ = claims["verifier"].(string)
+	return nonce, verifier, nil
+}
+
+// randomToken returns 32 random bytes, URL-safe encoded
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/kanishk-8/procode/db"
+)
+
+func signFlow(t *testing.T, claims jwt.MapClaims, secret string) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestParseOIDCFlow(t *testing.T) {
+	jwtSecret = "test-secret"
+
+	flow := func(exp time.Duration) jwt.MapClaims {
+		return jwt.MapClaims{
+			"provider": "google",
+			"state":    "state-1",
+			"nonce":    "nonce-1",
+			"verifier": "verifier-1",
+			"exp":      time.Now().Add(exp).Unix(),
+		}
+	}
+	valid := signFlow(t, flow(time.Minute), jwtSecret)
+
+	tests := []struct {
+		name     string
+		cookie   string
+		provider string
+		state    string
+		wantErr  string
+	}{
+		{"valid", valid, "google", "state-1", ""},
+		{"state mismatch", valid, "google", "state-2", "invalid SSO state"},
+		{"state missing", valid, "google", "", "invalid SSO state"},
+		{"other provider", valid, "keycloak", "state-1", "invalid SSO state"},
+		{"expired", signFlow(t, flow(-time.Minute), jwtSecret), "google", "state-1", "invalid or expired SSO flow"},
+		{"forged", signFlow(t, flow(time.Minute), "another-secret"), "google", "state-1", "invalid or expired SSO flow"},
+		{"no cookie", "", "google", "state-1", "invalid or expired SSO flow"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonce, verifier, err := parseOIDCFlow(tt.cookie, tt.provider, tt.state)
+
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Fatalf("parseOIDCFlow error = %q, want %q", gotErr, tt.wantErr)
+			}
+			if err == nil && (nonce != "nonce-1" || verifier != "verifier-1") {
+				t.Errorf("parseOIDCFlow = %q, %q, want the flow's nonce and verifier", nonce, verifier)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackStateMismatch(t *testing.T) {
+	jwtSecret = "test-secret"
+	db.OIDCProviders["mock"] = &db.OIDCProvider{Name: "mock"}
+	t.Cleanup(func() { delete(db.OIDCProviders, "mock") })
+
+	app := fiber.New()
+	app.Get("/auth/oidc/:provider/callback", OIDCCallbackHandler)
+
+	flow := signFlow(t, jwt.MapClaims{
+		"provider": "mock",
+		"state":    "state-1",
+		"nonce":    "nonce-1",
+		"verifier": "verifier-1",
+		"exp":      time.Now().Add(time.Minute).Unix(),
+	}, jwtSecret)
+
+	req := httptest.NewRequest("GET", "/auth/oidc/mock/callback?code=code-1&state=state-2", nil)
+	req.Header.Set("Cookie", "oidc_flow="+flow)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("status = %d, want a redirect", resp.StatusCode)
+	}
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	if got := location.Query().Get("sso_error"); got != "SSO login expired, please try again" {
+		t.Errorf("redirected with sso_error %q, want the flow to be refused", got)
+	}
+	// The flow cookie is single use and cleared either way
+	cleared := false
+	for _, cookie := range resp.Header.Values("Set-Cookie") {
+		cleared = cleared || strings.HasPrefix(cookie, "oidc_flow=;")
+	}
+	if !cleared {
+		t.Errorf("flow cookie was not cleared: %v", resp.Header.Values("Set-Cookie"))
+	}
+}
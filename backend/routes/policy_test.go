@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/middleware"
+)
+
+// TestBodyPoliciesReadHandlerIDs checks that the body policies of the routes
+// see the same batch or question as the handlers, however the ID is sent
+func TestBodyPoliciesReadHandlerIDs(t *testing.T) {
+	tests := []struct {
+		name        string
+		authorize   func(policy func(id int64) middleware.Policy) fiber.Handler
+		contentType string
+		body        string
+		wantStatus  int
+		wantChecked int64
+	}{
+		{
+			name: "deletebatch",
+			authorize: func(policy func(id int64) middleware.Policy) fiber.Handler {
+				return middleware.AuthorizeBody("batch_id", func(r *DeleteBatchRequest) int64 { return r.BatchID }, policy)
+			},
+			contentType: fiber.MIMEApplicationJSON,
+			body:        `{"batch_id":5}`,
+			wantChecked: 5,
+		},
+		{
+			name: "deletebatch with the key in upper case",
+			authorize: func(policy func(id int64) middleware.Policy) fiber.Handler {
+				return middleware.AuthorizeBody("batch_id", func(r *DeleteBatchRequest) int64 { return r.BatchID }, policy)
+			},
+			contentType: fiber.MIMEApplicationJSON,
+			body:        `{"BATCH_ID":5}`,
+			wantChecked: 5,
+		},
+		{
+			name: "deletebatch form encoded",
+			authorize: func(policy func(id int64) middleware.Policy) fiber.Handler {
+				return middleware.AuthorizeBody("batch_id", func(r *DeleteBatchRequest) int64 { return r.BatchID }, policy)
+			},
+			contentType: fiber.MIMEApplicationForm,
+			body:        `BatchID=5`,
+			wantChecked: 5,
+		},
+		{
+			name: "deletebatch form with the JSON key, which the handler ignores too",
+			authorize: func(policy func(id int64) middleware.Policy) fiber.Handler {
+				return middleware.AuthorizeBody("batch_id", func(r *DeleteBatchRequest) int64 { return r.BatchID }, policy)
+			},
+			contentType: fiber.MIMEApplicationForm,
+			body:        `batch_id=5`,
+			wantStatus:  fiber.StatusBadRequest,
+		},
+		{
+			name: "addquestion with the key in mixed case",
+			authorize: func(policy func(id int64) middleware.Policy) fiber.Handler {
+				return middleware.AuthorizeBody("batch_id", func(r *AddQuestionRequest) int64 { return r.BatchID }, policy)
+			},
+			contentType: fiber.MIMEApplicationJSON,
+			body:        `{"Batch_ID":7,"title":"t","description":"d"}`,
+			wantChecked: 7,
+		},
+		{
+			name: "rejudge without a batch",
+			authorize: func(policy func(id int64) middleware.Policy) fiber.Handler {
+				return middleware.AuthorizeBody("batch_id", func(r *RejudgeRequest) int64 { return r.BatchID }, policy)
+			},
+			contentType: fiber.MIMEApplicationJSON,
+			body:        `{"question_id":3}`,
+			wantStatus:  fiber.StatusBadRequest,
+		},
+		{
+			name: "evalques with the key in upper case",
+			authorize: func(policy func(id int64) middleware.Policy) fiber.Handler {
+				return middleware.AuthorizeBody("question_id", func(r *CodeSubmission) int64 { return r.QuestionID }, policy)
+			},
+			contentType: fiber.MIMEApplicationJSON,
+			body:        `{"QUESTION_ID":9,"code":"x"}`,
+			wantChecked: 9,
+		},
+		{
+			name: "evalques without a question",
+			authorize: func(policy func(id int64) middleware.Policy) fiber.Handler {
+				return middleware.AuthorizeBody("question_id", func(r *CodeSubmission) int64 { return r.QuestionID }, policy)
+			},
+			contentType: fiber.MIMEApplicationJSON,
+			body:        `{"code":"x"}`,
+			wantStatus:  fiber.StatusBadRequest,
+		},
+		{
+			name: "run with the key in upper case",
+			authorize: func(policy func(id int64) middleware.Policy) fiber.Handler {
+				return middleware.AuthorizeOptionalBody("question_id", func(r *RunCodeRequest) int64 { return r.QuestionID }, policy)
+			},
+			contentType: fiber.MIMEApplicationJSON,
+			body:        `{"Question_Id":9,"code":"x"}`,
+			wantChecked: 9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var checked int64
+			policy := func(id int64) middleware.Policy {
+				checked = id
+				return func(p *middleware.Principal) (bool, error) { return false, nil }
+			}
+
+			app := fiber.New()
+			app.Post("/", tt.authorize(policy), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if checked != tt.wantChecked {
+				t.Errorf("policy checked %d, want %d", checked, tt.wantChecked)
+			}
+			// Without a logged-in user a checked request stops at the policy
+			want := tt.wantStatus
+			if want == 0 {
+				want = fiber.StatusUnauthorized
+			}
+			if resp.StatusCode != want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, want)
+			}
+		})
+	}
+}
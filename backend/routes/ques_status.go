@@ -29,17 +29,8 @@ func GetQuestionStatusHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get user ID from context (set by auth middleware)
-	userIDFloat, ok := c.Locals("userId").(float64)
-	if !ok {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid user ID",
-		})
-	}
-	userID := int64(userIDFloat)
-
 	// Call the DB function to get question status
-	status, err := db.GetQuestionStatus(userID, batchID, questionID)
+	status, err := db.GetQuestionStatus(batchID, questionID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to get question status: " + err.Error(),
@@ -0,0 +1,364 @@
+package routes
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
+)
+
+// UpdateQuestionRequest holds the editable settings of a question, with the
+// same fields and meaning as in AddQuestionRequest
+type UpdateQuestionRequest struct {
+	Title          string   `json:"title"`
+	Description    string   `json:"description"`
+	TimeLimit      int      `json:"time_limit"`
+	StartTime      string   `json:"start_time"`
+	EndTime        string   `json:"end_time"`
+	CPUTimeLimit   *float64 `json:"cpu_time_limit"`
+	MemoryLimit    *int     `json:"memory_limit"`
+	StackLimit     *int     `json:"stack_limit"`
+	Comparator     string   `json:"comparator"`
+	Tolerance      *float64 `json:"comparator_tolerance"`
+	MaxSubmissions int      `json:"max_submissions"`
+	ScoringPolicy  string   `json:"scoring_policy"`
+	Penalty        int      `json:"submission_penalty"`
+}
+
+// questionEditError maps errors of the question editing functions to a response
+func questionEditError(c *fiber.Ctx, action string, err error) error {
+	switch err.Error() {
+	case "test case not found":
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"message": "Failed to " + action + ": " + err.Error(),
+	})
+}
+
+// respondWithRejudge sends a successful edit response. When the request asks
+// for it with ?rejudge=true, it first queues a rejudge job for the question,
+// as POST /rejudge would, and adds the job ID for GET /rejudge/:jobID.
+func respondWithRejudge(c *fiber.Ctx, status int, response fiber.Map, userID, questionID int64) error {
+	if c.Query("rejudge") == "true" {
+		batchID, err := db.QuestionBatchID(questionID)
+		var job *db.RejudgeJob
+		if err == nil {
+			job, err = db.StartRejudge(userID, db.RejudgeScope{BatchID: batchID, QuestionID: questionID})
+		}
+		if err != nil {
+			response["rejudge_error"] = err.Error()
+		} else {
+			response["rejudge_job_id"] = job.ID
+		}
+	}
+	return c.Status(status).JSON(response)
+}
+
+// testCaseFromRequest converts and validates a test case from a request
+func testCaseFromRequest(tc TestCase) (db.TestCase, error) {
+	limits, err := resourceLimits(tc.CPUTimeLimit, tc.MemoryLimit, tc.StackLimit)
+	if err != nil {
+		return db.TestCase{}, err
+	}
+	return db.TestCase{
+		InputText:      tc.InputText,
+		ExpectedOutput: tc.ExpectedOutput,
+		IsHidden:       tc.IsHidden,
+		Limits:         limits,
+		Comparator:     db.Comparator{Type: tc.Comparator, Tolerance: tc.Tolerance},
+		Group:          tc.Group,
+	}, nil
+}
+
+// GetQuestionForTeacherHandler returns a question with all of its test cases
+func GetQuestionForTeacherHandler(c *fiber.Ctx) error {
+	questionID, err := strconv.ParseInt(c.Params("questionID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid question ID",
+		})
+	}
+
+	question, err := db.GetQuestionForTeacher(questionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to get question: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Question retrieved successfully",
+		"data":    question,
+	})
+}
+
+// UpdateQuestionHandler replaces the editable settings of a question
+func UpdateQuestionHandler(c *fiber.Ctx) error {
+	questionID, err := strconv.ParseInt(c.Params("questionID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid question ID",
+		})
+	}
+
+	var req UpdateQuestionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+	userID := principal.UserID
+
+	limits, err := resourceLimits(req.CPUTimeLimit, req.MemoryLimit, req.StackLimit)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid limits: " + err.Error(),
+		})
+	}
+
+	startTime, err := parseQuestionTime(req.StartTime)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid start time format: " + err.Error(),
+		})
+	}
+
+	endTime, err := parseQuestionTime(req.EndTime)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid end time format: " + err.Error(),
+		})
+	}
+
+	err = db.UpdateQuestion(questionID, db.QuestionEdit{
+		Title:       req.Title,
+		Description: req.Description,
+		TimeLimit:   req.TimeLimit,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Limits:      limits,
+		Comparator:  db.Comparator{Type: req.Comparator, Tolerance: req.Tolerance},
+		Grading: db.GradingPolicy{
+			Scoring:        req.ScoringPolicy,
+			MaxSubmissions: req.MaxSubmissions,
+			Penalty:        req.Penalty,
+		},
+	})
+	if err != nil {
+		return questionEditError(c, "update question", err)
+	}
+
+	return respondWithRejudge(c, fiber.StatusOK, fiber.Map{
+		"message": "Question updated successfully",
+	}, userID, questionID)
+}
+
+// DeleteQuestionHandler deletes a question with its attempts and submissions
+func DeleteQuestionHandler(c *fiber.Ctx) error {
+	questionID, err := strconv.ParseInt(c.Params("questionID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid question ID",
+		})
+	}
+
+	if err := db.DeleteQuestion(questionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to delete question: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Question deleted successfully",
+	})
+}
+
+// AddTestCaseHandler adds a test case to a question
+func AddTestCaseHandler(c *fiber.Ctx) error {
+	questionID, err := strconv.ParseInt(c.Params("questionID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid question ID",
+		})
+	}
+
+	var req TestCase
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+	userID := principal.UserID
+
+	tc, err := testCaseFromRequest(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid limits: " + err.Error(),
+		})
+	}
+
+	testCaseID, err := db.AddTestCase(questionID, tc)
+	if err != nil {
+		return questionEditError(c, "add test case", err)
+	}
+
+	return respondWithRejudge(c, fiber.StatusCreated, fiber.Map{
+		"message":      "Test case added successfully",
+		"test_case_id": testCaseID,
+	}, userID, questionID)
+}
+
+// UpdateTestCaseHandler replaces a test case of a question
+func UpdateTestCaseHandler(c *fiber.Ctx) error {
+	questionID, err := strconv.ParseInt(c.Params("questionID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid question ID",
+		})
+	}
+
+	testCaseID, err := strconv.ParseInt(c.Params("testCaseID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid test case ID",
+		})
+	}
+
+	var req TestCase
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+	userID := principal.UserID
+
+	tc, err := testCaseFromRequest(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid limits: " + err.Error(),
+		})
+	}
+
+	if err := db.UpdateTestCase(questionID, testCaseID, tc); err != nil {
+		return questionEditError(c, "update test case", err)
+	}
+
+	return respondWithRejudge(c, fiber.StatusOK, fiber.Map{
+		"message": "Test case updated successfully",
+	}, userID, questionID)
+}
+
+// DeleteTestCaseHandler removes a test case from a question
+func DeleteTestCaseHandler(c *fiber.Ctx) error {
+	questionID, err := strconv.ParseInt(c.Params("questionID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid question ID",
+		})
+	}
+
+	testCaseID, err := strconv.ParseInt(c.Params("testCaseID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid test case ID",
+		})
+	}
+
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+	userID := principal.UserID
+
+	if err := db.DeleteTestCase(questionID, testCaseID); err != nil {
+		return questionEditError(c, "delete test case", err)
+	}
+
+	return respondWithRejudge(c, fiber.StatusOK, fiber.Map{
+		"message": "Test case deleted successfully",
+	}, userID, questionID)
+}
+
+// UploadTestCasesHandler adds the test cases of a zip or tar archive, sent as
+// the "archive" form file, to a question. With ?replace=true the archive
+// replaces the existing test cases.
+func UploadTestCasesHandler(c *fiber.Ctx) error {
+	questionID, err := strconv.ParseInt(c.Params("questionID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid question ID",
+		})
+	}
+
+	fileHeader, err := c.FormFile("archive")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "An archive file is required",
+		})
+	}
+	if fileHeader.Size > db.MaxTestArchiveBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"message": "Archive is too large",
+		})
+	}
+
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+	userID := principal.UserID
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to read archive: " + err.Error(),
+		})
+	}
+	defer file.Close()
+	archive, err := io.ReadAll(file)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to read archive: " + err.Error(),
+		})
+	}
+
+	count, err := db.ImportTestCases(questionID, fileHeader.Filename, archive, c.Query("replace") == "true")
+	if err != nil {
+		return questionEditError(c, "import test cases", err)
+	}
+
+	return respondWithRejudge(c, fiber.StatusCreated, fiber.Map{
+		"message":    "Test cases imported successfully",
+		"test_cases": count,
+	}, userID, questionID)
+}
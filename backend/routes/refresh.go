@@ -1,13 +1,15 @@
 package routes
 
 import (
-	"fmt"
-	"time"
+	"log"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/kanishk-8/procode/db"
 )
 
+// RefreshHandler trades the refresh token for a new access token and a new
+// refresh token. The refresh token it replaced stops working, and using it
+// again afterwards revokes the whole session.
 func RefreshHandler(c *fiber.Ctx) error {
 	// Read refresh token cookie
 	refreshTokenStr := c.Cookies("refresh_token")
@@ -15,48 +17,39 @@ func RefreshHandler(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Unauthorized"})
 	}
 
-	// Parse and verify the refresh token
-	refreshToken, err := jwt.Parse(refreshTokenStr, func(t *jwt.Token) (interface{}, error) {
-		if t.Method != jwt.SigningMethodHS256 {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(jwtSecret), nil
-	})
-	if err != nil || !refreshToken.Valid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid or expired refresh token"})
+	sessionID, generation, err := parseRefreshToken(refreshTokenStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error()})
 	}
 
-	// Extract claims from refresh token
-	claims, ok := refreshToken.Claims.(jwt.MapClaims)
-	if !ok || !refreshToken.Valid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid token claims"})
+	rotation, err := db.RotateSession(sessionID, generation)
+	if err != nil {
+		if err.Error() == "session expired or revoked" || err.Error() == "refresh token reuse detected, please log in again" {
+			clearSessionCookies(c)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error()})
+		}
+		log.Printf("Error rotating session %d: %v", sessionID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not refresh session"})
 	}
 
-	// Build new access token (15 min expiry)
-	newAccessClaims := jwt.MapClaims{
-		"userId":   claims["userId"],
-		"username": claims["username"],
-		"email":    claims["email"],
-		"role":     claims["role"],
-		"roleId":   claims["roleId"],
-		"exp":      time.Now().Add(15 * time.Minute).Unix(),
-	}
-	newAccessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, newAccessClaims)
-	signedAccessToken, err := newAccessToken.SignedString([]byte(jwtSecret))
+	// Reload the user so role changes and teacher approval apply on refresh
+	user, err := db.GetUserByID(rotation.UserID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not generate new access token"})
+		if revokeErr := db.RevokeSession(rotation.UserID, sessionID); revokeErr != nil {
+			log.Printf("Error revoking session %d: %v", sessionID, revokeErr)
+		}
+		clearSessionCookies(c)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error()})
 	}
 
-	// Set new access token as cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "jwt",
-		Value:    signedAccessToken,
-		Expires:  time.Now().Add(15 * time.Minute),
-		HTTPOnly: true,
-		SameSite: "None",
-		Secure:   false,
-		Path:     "/",
-	})
+	if err := setAccessCookie(c, user, sessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not generate new access token"})
+	}
+	if rotation.Rotated {
+		if err := setRefreshCookie(c, user.ID, sessionID, rotation.Generation); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not generate new refresh token"})
+		}
+	}
 
 	return c.JSON(fiber.Map{"message": "Access token refreshed"})
 }
@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
+)
+
+// RejudgeRequest selects what to rejudge: a whole batch, or only one question
+// and/or one student of it
+type RejudgeRequest struct {
+	BatchID    int64 `json:"batch_id"`
+	QuestionID int64 `json:"question_id"`
+	StudentID  int64 `json:"student_id"`
+}
+
+// StartRejudgeHandler queues a background rejudge of stored graded submissions
+func StartRejudgeHandler(c *fiber.Ctx) error {
+	var req RejudgeRequest
+	if err := c.BodyParser(&req); err != nil || req.BatchID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body, batch_id is required",
+		})
+	}
+
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+	userID := principal.UserID
+
+	job, err := db.StartRejudge(userID, db.RejudgeScope{
+		BatchID:    req.BatchID,
+		QuestionID: req.QuestionID,
+		StudentID:  req.StudentID,
+	})
+	if err != nil {
+		switch err.Error() {
+		case "question not found in this batch", "student not found in this batch":
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		case "you don't have permission to access this batch":
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to start rejudge: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Rejudge started",
+		"data":    job,
+	})
+}
+
+// GetRejudgeJobHandler reports the progress and old and new scores of a rejudge
+func GetRejudgeJobHandler(c *fiber.Ctx) error {
+	jobID, err := strconv.ParseInt(c.Params("jobID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid rejudge job ID",
+		})
+	}
+
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+	userID := principal.UserID
+
+	job, err := db.GetRejudgeJob(userID, jobID)
+	if err != nil {
+		if err.Error() == "rejudge job not found" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to get rejudge job: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Rejudge job retrieved successfully",
+		"data":    job,
+	})
+}
@@ -6,24 +6,67 @@ import (
 )
 
 func RegisterRoutes(app *fiber.App) {
+	// Access policies for the batch and question in the route
+	canManageBatch := middleware.Authorize("batchID", middleware.CanManageBatch)
+	canViewBatch := middleware.Authorize("batchID", middleware.CanViewBatch)
+	canManageQuestion := middleware.Authorize("questionID", middleware.CanManageQuestion)
+	canViewQuestion := middleware.Authorize("questionID", middleware.CanViewQuestion)
+	// and for routes that take the batch or question in the request body
+	canDeleteBatch := middleware.AuthorizeBody("batch_id", func(r *DeleteBatchRequest) int64 { return r.BatchID }, middleware.CanManageBatch)
+	canAddQuestion := middleware.AuthorizeBody("batch_id", func(r *AddQuestionRequest) int64 { return r.BatchID }, middleware.CanManageBatch)
+	canRejudge := middleware.AuthorizeBody("batch_id", func(r *RejudgeRequest) int64 { return r.BatchID }, middleware.CanManageBatch)
+	canSubmit := middleware.AuthorizeBody("question_id", func(r *CodeSubmission) int64 { return r.QuestionID }, middleware.CanViewQuestion)
+	canRunOnQuestion := middleware.AuthorizeOptionalBody("question_id", func(r *RunCodeRequest) int64 { return r.QuestionID }, middleware.CanViewQuestion)
+	canEditAttempt := middleware.Authorize("id", middleware.CanEditAttempt)
+	canViewSubmission := middleware.Authorize("id", middleware.CanViewSubmission)
+
 	app.Post("/signup", SignUpHandler)
-	app.Post("/login", LoginHandler)
+	app.Post("/login", middleware.PasswordRateLimit, middleware.PasswordUserRateLimit, LoginHandler)
+	app.Post("/change-password", middleware.PasswordRateLimit, middleware.PasswordUserRateLimit, ChangePasswordHandler)
+	app.Post("/verify-email", VerifyEmailHandler)
+	app.Post("/resend-verification", middleware.MailRateLimit, ResendVerificationHandler)
+	app.Post("/forgot-password", middleware.MailRateLimit, ForgotPasswordHandler)
+	app.Post("/reset-password", ResetPasswordHandler)
+	app.Get("/auth/oidc/providers", OIDCProvidersHandler)
+	app.Get("/auth/oidc/:provider", OIDCLoginHandler)
+	app.Get("/auth/oidc/:provider/callback", OIDCCallbackHandler)
 	app.Get("/refresh", RefreshHandler)
 	app.Get("/logout", middleware.RequireAuth, LogoutHandler)
+	app.Post("/logout-all", middleware.RequireAuth, LogoutAllHandler)
 	app.Get("/currentUser", middleware.RequireAuth, CurrentUserHandler)
 	app.Post("/addBatch", middleware.RequireTeacherAuth, AddBatchHandler)
 	app.Get("/getbatchesbyteacher", middleware.RequireTeacherAuth, GetBatchesByTeacherHandler)
-	app.Post("/deletebatch", middleware.RequireTeacherAuth, DeleteBatchHandler)
+	app.Post("/deletebatch", middleware.RequireTeacherAuth, canDeleteBatch, DeleteBatchHandler)
 	app.Get("/joinbatch/:batchId", middleware.RequireStudentAuth, JoinBatchByParamHandler)
-	app.Get("/getstudentsinbatch/:batchID", middleware.RequireTeacherAuth, GetStudentsInBatchHandler)
+	app.Get("/getstudentsinbatch/:batchID", middleware.RequireTeacherAuth, canManageBatch, GetStudentsInBatchHandler)
 	app.Get("/getstudentbatches", middleware.RequireStudentAuth, GetStudentBatchesHandler)
-	app.Post("/addquestion", middleware.RequireTeacherAuth, AddQuestionHandler)
-	app.Get("/getquestionsbybatch/:batchID", middleware.RequireAuth, GetQuestionsByBatchHandler)
-	app.Get("/getquestiondetailsbyid/:batchID/:questionID", middleware.RequireStudentAuth, GetQuestionDetailsByIDHandler)
-	app.Post("/evalques", middleware.RequireStudentAuth, CodeEvaluateHandler)
+	app.Post("/addquestion", middleware.RequireTeacherAuth, canAddQuestion, AddQuestionHandler)
+	app.Get("/question/:questionID", middleware.RequireTeacherAuth, canManageQuestion, GetQuestionForTeacherHandler)
+	app.Put("/question/:questionID", middleware.RequireTeacherAuth, canManageQuestion, UpdateQuestionHandler)
+	app.Delete("/question/:questionID", middleware.RequireTeacherAuth, canManageQuestion, DeleteQuestionHandler)
+	app.Post("/question/:questionID/testcases", middleware.RequireTeacherAuth, canManageQuestion, AddTestCaseHandler)
+	app.Post("/question/:questionID/testcases/upload", middleware.RequireTeacherAuth, canManageQuestion, UploadTestCasesHandler)
+	app.Put("/question/:questionID/testcases/:testCaseID", middleware.RequireTeacherAuth, canManageQuestion, UpdateTestCaseHandler)
+	app.Delete("/question/:questionID/testcases/:testCaseID", middleware.RequireTeacherAuth, canManageQuestion, DeleteTestCaseHandler)
+	app.Get("/getquestionsbybatch/:batchID", middleware.RequireAuth, canViewBatch, GetQuestionsByBatchHandler)
+	app.Get("/getquestiondetailsbyid/:batchID/:questionID", middleware.RequireStudentAuth, canViewQuestion, GetQuestionDetailsByIDHandler)
+	app.Post("/evalques", middleware.RequireStudentAuth, canSubmit, CodeEvaluateHandler)
+	app.Post("/run", middleware.RequireStudentAuth, middleware.RunRateLimit, canRunOnQuestion, RunCodeHandler)
+	app.Put("/attempt/:id/draft", middleware.RequireStudentAuth, canEditAttempt, SaveDraftHandler)
+	app.Get("/submission/:id", middleware.RequireStudentAuth, canViewSubmission, GetSubmissionHandler)
+	app.Get("/submission/:id/stream", middleware.RequireStudentAuth, canViewSubmission, StreamSubmissionHandler)
 
 	// Add the new question status endpoint with teacher authentication
-	app.Get("/question-status/:batchID/:questionID", middleware.RequireTeacherAuth, GetQuestionStatusHandler)
+	app.Get("/question-status/:batchID/:questionID", middleware.RequireTeacherAuth, canManageBatch, GetQuestionStatusHandler)
+
+	// Submission history of a student for a question, teacher only
+	app.Get("/question-status/:batchID/:questionID/students/:studentID/submissions", middleware.RequireTeacherAuth, canManageBatch, ListStudentSubmissionsHandler)
+	app.Get("/question-status/:batchID/:questionID/students/:studentID/submissions/:submissionID", middleware.RequireTeacherAuth, canManageBatch, GetStudentSubmissionHandler)
+	app.Get("/question-status/:batchID/:questionID/students/:studentID/diff", middleware.RequireTeacherAuth, canManageBatch, DiffStudentSubmissionsHandler)
+
+	// Rejudge stored submissions against the current test cases, teacher only
+	app.Post("/rejudge", middleware.RequireTeacherAuth, canRejudge, StartRejudgeHandler)
+	app.Get("/rejudge/:jobID", middleware.RequireTeacherAuth, GetRejudgeJobHandler)
 
 	// Student dashboard endpoint
 	app.Get("/student/dashboard", middleware.RequireStudentAuth, GetStudentDashboardStatsHandler)
@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
+)
+
+// RunCodeRequest is code to run on custom input. QuestionID is optional and
+// applies that question's limits (and harness, for function questions).
+type RunCodeRequest struct {
+	QuestionID int64  `json:"question_id"`
+	Code       string `json:"code"`
+	LanguageID int    `json:"language_id"`
+	Stdin      string `json:"stdin"`
+}
+
+// RunCodeHandler runs code on stdin supplied by the student and returns its
+// output. It is not graded and does not touch the attempt.
+func RunCodeHandler(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+	userID := principal.UserID
+
+	var req RunCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body: " + err.Error(),
+		})
+	}
+
+	if req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Code is required",
+		})
+	}
+	if req.LanguageID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Language ID is required",
+		})
+	}
+	if len(req.Stdin) > db.MaxRunStdinBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"message": "Input is too large",
+		})
+	}
+
+	result, err := db.RunCode(userID, req.QuestionID, req.Code, req.LanguageID, req.Stdin)
+	if err != nil {
+		switch err.Error() {
+		case "question not found":
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Question not found",
+			})
+		case "student is not enrolled in the batch containing this question":
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to run code: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Code executed",
+		"data":    result,
+	})
+}
@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/kanishk-8/procode/db"
+)
+
+// accessTokenLifetime is how long the jwt cookie is valid before it has to be refreshed
+const accessTokenLifetime = 15 * time.Minute
+
+// setAccessCookie signs a short-lived access token for a user's session
+func setAccessCookie(c *fiber.Ctx, user *db.UserData, sessionID int64) error {
+	claims := jwt.MapClaims{
+		"userId":   user.ID,
+		"username": user.Username,
+		"email":    user.Email,
+		"role":     user.Role,
+		"roleId":   user.RoleID,
+		"sid":      sessionID,
+		"exp":      time.Now().Add(accessTokenLifetime).Unix(),
+	}
+	signedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+	if err != nil {
+		return err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    signedToken,
+		Expires:  time.Now().Add(accessTokenLifetime),
+		HTTPOnly: true,
+		SameSite: "None", // Use Lax for most cases, "None" for cross-origin with Secure:true
+		Path:     "/",    // Make cookie available on all paths
+		Secure:   false,  // Set to true in production with HTTPS
+	})
+	return nil
+}
+
+// setRefreshCookie signs the refresh token of a session with the given
+// generation. Only the newest generation can be used to refresh.
+func setRefreshCookie(c *fiber.Ctx, userID, sessionID int64, generation int) error {
+	claims := jwt.MapClaims{
+		"userId": userID,
+		"sid":    sessionID,
+		"gen":    generation,
+		"exp":    time.Now().Add(db.SessionLifetime).Unix(),
+	}
+	signedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+	if err != nil {
+		return err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    signedToken,
+		Expires:  time.Now().Add(db.SessionLifetime),
+		HTTPOnly: true,
+		SameSite: "None",
+		Path:     "/refresh",
+		Secure:   false,
+	})
+	return nil
+}
+
+// clearSessionCookies removes the access and refresh cookies
+func clearSessionCookies(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    "",
+		Expires:  time.Now().Add(-1 * time.Hour),
+		HTTPOnly: true,
+		SameSite: "None",
+		Path:     "/",
+		Secure:   false,
+	})
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		Expires:  time.Now().Add(-1 * time.Hour),
+		HTTPOnly: true,
+		SameSite: "None",
+		Path:     "/refresh",
+		Secure:   false,
+	})
+}
+
+// startSession creates a server-side session for a user who just logged in
+// and sets its cookies
+func startSession(c *fiber.Ctx, user *db.UserData) error {
+	sessionID, err := db.CreateSession(user.ID, c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		return err
+	}
+	if err := setAccessCookie(c, user, sessionID); err != nil {
+		return err
+	}
+	return setRefreshCookie(c, user.ID, sessionID, 0)
+}
+
+// parseRefreshToken verifies a refresh token and returns its session ID and generation
+func parseRefreshToken(tokenStr string) (sessionID int64, generation int, err error) {
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(jwtSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, 0, errors.New("invalid or expired refresh token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, 0, errors.New("invalid token claims")
+	}
+	// Tokens from before server-side sessions have no session and can't be refreshed
+	sid, okSID := claims["sid"].(float64)
+	gen, okGen := claims["gen"].(float64)
+	if !okSID || !okGen {
+		return 0, 0, errors.New("invalid token claims")
+	}
+	return int64(sid), int(gen), nil
+}
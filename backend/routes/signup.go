@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"log"
 	"regexp"
 	"strings"
 
@@ -32,7 +33,6 @@ func SignUpHandler(c *fiber.Ctx) error {
 	// Backend validation
 	body.Username = strings.TrimSpace(body.Username)
 	body.Email = strings.TrimSpace(body.Email)
-	body.Password = strings.TrimSpace(body.Password)
 	body.UserId = strings.TrimSpace(body.UserId)
 	body.Role = strings.TrimSpace(body.Role)
 
@@ -45,9 +45,12 @@ func SignUpHandler(c *fiber.Ctx) error {
 	if !isValidEmail(body.Email) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid email format"})
 	}
-	if len(body.Password) < 6 {
+	if len(body.Password) < db.MinPasswordLength {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Password must be at least 6 characters"})
 	}
+	if len(body.Password) > db.MaxPasswordLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Password must be at most 72 bytes"})
+	}
 	if body.UserId == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User ID is required"})
 	}
@@ -56,15 +59,21 @@ func SignUpHandler(c *fiber.Ctx) error {
 	}
 
 	// Create user and role
-	_, err := db.CreateUserWithRole(body.Username, body.Email, body.Password, body.Role, body.UserId)
+	userID, err := db.CreateUserWithRole(body.Username, body.Email, body.Password, body.Role, body.UserId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error creating user: " + err.Error(),
 		})
 	}
 
+	// The account can't log in until the email address is confirmed. If the
+	// email doesn't go out, the user can ask for it again.
+	if err := db.SendVerificationEmail(userID); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", userID, err)
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "User created successfully",
+		"message": "User created successfully, check your email to verify your address",
 	})
 }
 
@@ -3,18 +3,19 @@ package routes
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
 // GetStudentDashboardStatsHandler handles requests for student dashboard statistics
 func GetStudentDashboardStatsHandler(c *fiber.Ctx) error {
 	// Extract user ID from context
-	userIDFloat, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Invalid user ID",
 		})
 	}
-	userID := int64(userIDFloat)
+	userID := principal.UserID
 
 	// Get student dashboard stats
 	stats, err := db.GetStudentDashboardStats(userID)
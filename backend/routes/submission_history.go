@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/db"
+)
+
+// historyParams reads the batch, question and student IDs of the submission
+// history routes
+func historyParams(c *fiber.Ctx) (batchID, questionID, studentID int64, err error) {
+	if batchID, err = strconv.ParseInt(c.Params("batchID"), 10, 64); err != nil {
+		return
+	}
+	if questionID, err = strconv.ParseInt(c.Params("questionID"), 10, 64); err != nil {
+		return
+	}
+	studentID, err = strconv.ParseInt(c.Params("studentID"), 10, 64)
+	return
+}
+
+// historyError maps errors of the submission history functions to a response
+func historyError(c *fiber.Ctx, err error) error {
+	switch err.Error() {
+	case "question not found in this batch", "student not found in this batch", "submission not found":
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": "Failed to get submissions: " + err.Error(),
+	})
+}
+
+// ListStudentSubmissionsHandler returns every submission of a student for a question
+func ListStudentSubmissionsHandler(c *fiber.Ctx) error {
+	batchID, questionID, studentID, err := historyParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid ID format",
+		})
+	}
+
+	history, err := db.ListStudentSubmissions(batchID, questionID, studentID)
+	if err != nil {
+		return historyError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Submissions retrieved successfully",
+		"data":    history,
+	})
+}
+
+// GetStudentSubmissionHandler returns one submission of a student with its code
+func GetStudentSubmissionHandler(c *fiber.Ctx) error {
+	batchID, questionID, studentID, err := historyParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid ID format",
+		})
+	}
+
+	submissionID, err := strconv.ParseInt(c.Params("submissionID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid submission ID",
+		})
+	}
+
+	submission, err := db.GetStudentSubmission(batchID, questionID, studentID, submissionID)
+	if err != nil {
+		return historyError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Submission retrieved successfully",
+		"data":    submission,
+	})
+}
+
+// DiffStudentSubmissionsHandler compares the code of two submissions given by
+// the from and to query parameters
+func DiffStudentSubmissionsHandler(c *fiber.Ctx) error {
+	batchID, questionID, studentID, err := historyParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid ID format",
+		})
+	}
+
+	fromID, errFrom := strconv.ParseInt(c.Query("from"), 10, 64)
+	toID, errTo := strconv.ParseInt(c.Query("to"), 10, 64)
+	if errFrom != nil || errTo != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "from and to must be submission IDs",
+		})
+	}
+
+	diff, err := db.DiffStudentSubmissions(batchID, questionID, studentID, fromID, toID)
+	if err != nil {
+		return historyError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Diff computed successfully",
+		"data":    diff,
+	})
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/db"
+)
+
+// GetSubmissionHandler reports whether a submission is queued, running or done
+// along with the test results produced so far
+func GetSubmissionHandler(c *fiber.Ctx) error {
+	submissionID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid submission ID format",
+		})
+	}
+
+	status, err := db.GetSubmission(submissionID)
+	if err != nil {
+		if err.Error() == "submission not found" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Submission not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to retrieve submission: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Submission retrieved successfully",
+		"data":    status,
+	})
+}
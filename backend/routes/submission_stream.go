@@ -0,0 +1,144 @@
+package routes
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kanishk-8/procode/db"
+)
+
+// streamKeepAlive is how often an idle stream sends a comment and re-checks the submission
+const streamKeepAlive = 15 * time.Second
+
+// StreamSubmissionHandler pushes the progress of a submission as server-sent
+// events: status changes, one test_result per finished test case and a final
+// result (or error) event, after which the stream ends
+func StreamSubmissionHandler(c *fiber.Ctx) error {
+	submissionID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid submission ID format",
+		})
+	}
+
+	// Subscribe before reading the current state so no event is missed in between
+	events, unsubscribe := db.SubscribeSubmission(submissionID)
+
+	status, err := db.GetSubmission(submissionID)
+	if err != nil {
+		unsubscribe()
+		if err.Error() == "submission not found" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Submission not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to retrieve submission: " + err.Error(),
+		})
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+		streamSubmission(w, submissionID, status, events)
+	})
+	return nil
+}
+
+// streamSubmission writes events until the submission finishes or the client goes away
+func streamSubmission(w *bufio.Writer, submissionID int64, status *db.SubmissionStatus, events <-chan db.SubmissionEvent) {
+	sent := map[int]bool{}
+
+	// Catch up with whatever happened before the client connected
+	finished, err := writeSubmissionState(w, status, sent)
+	if err != nil || finished {
+		return
+	}
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			if event.Type == db.EventTestResult {
+				if sent[event.Index] {
+					continue
+				}
+				sent[event.Index] = true
+			}
+			if err := writeEvent(w, event.Type, event); err != nil {
+				return
+			}
+			if event.Type == db.EventResult || event.Type == db.EventError {
+				return
+			}
+
+		case <-ticker.C:
+			// Events can be dropped for slow clients, so fall back to the stored state
+			status, err := db.GetSubmission(submissionID)
+			if err != nil {
+				return
+			}
+			if status.Status == db.SubmissionDone || status.Status == db.SubmissionFailed {
+				writeSubmissionState(w, status, sent)
+				return
+			}
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeSubmissionState sends the stored state of a submission as events and
+// reports whether the submission has finished
+func writeSubmissionState(w *bufio.Writer, status *db.SubmissionStatus, sent map[int]bool) (bool, error) {
+	if err := writeEvent(w, db.EventStatus, db.SubmissionEvent{Status: status.Status}); err != nil {
+		return false, err
+	}
+
+	if status.Result != nil {
+		for i := range status.Result.TestResults {
+			testResult := status.Result.TestResults[i]
+			if sent[i] || testResult.Status == "PENDING" || testResult.Status == "NOT_EVALUATED" {
+				continue
+			}
+			sent[i] = true
+			if err := writeEvent(w, db.EventTestResult, db.SubmissionEvent{Index: i, TestResult: &testResult}); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	switch status.Status {
+	case db.SubmissionDone:
+		return true, writeEvent(w, db.EventResult, db.SubmissionEvent{Status: status.Status, Result: status.Result})
+	case db.SubmissionFailed:
+		return true, writeEvent(w, db.EventError, db.SubmissionEvent{Status: status.Status, Error: status.Error})
+	}
+	return false, nil
+}
+
+// writeEvent writes one server-sent event and flushes it to the client
+func writeEvent(w *bufio.Writer, name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -5,21 +5,22 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/kanishk-8/procode/db"
+	"github.com/kanishk-8/procode/middleware"
 )
 
 // GetTeacherDashboardStatsHandler handles requests for teacher dashboard statistics
 func GetTeacherDashboardStatsHandler(c *fiber.Ctx) error {
-	userID, ok := c.Locals("userId").(float64)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
-		fmt.Printf("Invalid user ID type: %T\n", c.Locals("userId"))
+		fmt.Println("No authenticated user")
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
 			"message": "Invalid user ID",
 		})
 	}
 
-	fmt.Printf("Fetching stats for user ID: %.0f\n", userID)
-	stats, err := db.GetTeacherDashboardStats(int64(userID))
+	fmt.Printf("Fetching stats for user ID: %d\n", principal.UserID)
+	stats, err := db.GetTeacherDashboardStats(principal.UserID)
 	if err != nil {
 		fmt.Printf("Error fetching stats: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
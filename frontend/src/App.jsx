@@ -3,6 +3,8 @@ import { BrowserRouter as Router, Routes, Route } from "react-router-dom";
 import Home from "./pages/unauthenticated/home";
 import Login from "./pages/unauthenticated/login";
 import SignUp from "./pages/unauthenticated/signup";
+import VerifyEmail from "./pages/unauthenticated/verifyEmail";
+import ResetPassword from "./pages/unauthenticated/resetPassword";
 import Dashboard from "./pages/authenticated/dashboard";
 import Navbar from "./components/navbar";
 import ProtectedRoute from "./components/protectedRoutes";
@@ -23,6 +25,8 @@ function App() {
         <Route path="/" element={<Home />} />
         <Route path="/login" element={<Login />} />
         <Route path="/signup" element={<SignUp />} />
+        <Route path="/verify-email" element={<VerifyEmail />} />
+        <Route path="/reset-password" element={<ResetPassword />} />
         <Route
           path="/dashboard"
           element={
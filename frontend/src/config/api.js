@@ -5,9 +5,17 @@ export const API_ENDPOINTS = {
   // Auth endpoints
   LOGIN: `${API_URL}/login`,
   LOGOUT: `${API_URL}/logout`,
+  LOGOUT_ALL: `${API_URL}/logout-all`,
   SIGNUP: `${API_URL}/signup`,
   CURRENT_USER: `${API_URL}/currentUser`,
   REFRESH_TOKEN: `${API_URL}/refresh`,
+  CHANGE_PASSWORD: `${API_URL}/change-password`,
+  VERIFY_EMAIL: `${API_URL}/verify-email`,
+  RESEND_VERIFICATION: `${API_URL}/resend-verification`,
+  FORGOT_PASSWORD: `${API_URL}/forgot-password`,
+  RESET_PASSWORD: `${API_URL}/reset-password`,
+  OIDC_PROVIDERS: `${API_URL}/auth/oidc/providers`,
+  OIDC_LOGIN: (provider) => `${API_URL}/auth/oidc/${provider}`,
 
   // Batch endpoints
   GET_BATCHES_BY_TEACHER: `${API_URL}/getBatchesByTeacher`,
@@ -24,6 +32,11 @@ export const API_ENDPOINTS = {
   GET_QUESTION_DETAILS: (batchId, questionId) =>
     `${API_URL}/getquestiondetailsbyid/${batchId}/${questionId}`,
   EVAL_QUESTION: `${API_URL}/evalques`,
+  RUN_CODE: `${API_URL}/run`,
+  SAVE_DRAFT: (attemptId) => `${API_URL}/attempt/${attemptId}/draft`,
+  GET_SUBMISSION: (submissionId) => `${API_URL}/submission/${submissionId}`,
+  STREAM_SUBMISSION: (submissionId) =>
+    `${API_URL}/submission/${submissionId}/stream`,
   ADD_QUESTION: `${API_URL}/addquestion`,
 
   // Student evaluation endpoints
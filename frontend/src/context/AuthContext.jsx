@@ -98,8 +98,10 @@ export const AuthProvider = ({ children }) => {
     };
   }, [isLoggedIn]);
 
-  // Add nonce parameter to the login function
-  const login = async (username, hashedPassword, nonce) => {
+  // Returns true on success, "password_change_required" when the account must
+  // pick a new password first, or "email_verification_required" when its email
+  // address isn't confirmed yet
+  const login = async (username, password) => {
     try {
       setLoading(true);
       setError(null); // Reset error at the start of login attempt
@@ -112,14 +114,23 @@ export const AuthProvider = ({ children }) => {
         },
         body: JSON.stringify({
           username,
-          password: hashedPassword,
-          nonce,
+          password,
         }),
       });
 
       const data = await response.json();
       console.log("Login response:", response.status, data);
 
+      if (response.status === 403 && data.passwordChangeRequired) {
+        setError(null);
+        return "password_change_required";
+      }
+
+      if (response.status === 403 && data.emailVerificationRequired) {
+        setError(null);
+        return "email_verification_required";
+      }
+
       if (!response.ok) {
         // Extract error message from response
         const errorMessage = data.message || "Login failed";
@@ -147,13 +158,18 @@ export const AuthProvider = ({ children }) => {
     }
   };
 
-  const logout = async () => {
+  // allDevices also ends the sessions of every other browser the user is
+  // logged in on
+  const logout = async (allDevices = false) => {
     try {
       setLoading(true);
-      const response = await fetch(API_ENDPOINTS.LOGOUT, {
-        method: "GET",
-        credentials: "include",
-      });
+      const response = await fetch(
+        allDevices ? API_ENDPOINTS.LOGOUT_ALL : API_ENDPOINTS.LOGOUT,
+        {
+          method: allDevices ? "POST" : "GET",
+          credentials: "include",
+        }
+      );
 
       if (!response.ok) {
         throw new Error("Logout failed");
@@ -172,6 +188,12 @@ export const AuthProvider = ({ children }) => {
     }
   };
 
+  // The SSO callback sets the session cookies and sends the browser back to
+  // the login page, so only the user is left to load
+  const completeSsoLogin = async () => {
+    await fetchCurrentUser();
+  };
+
   const refreshUser = () => {
     if (isLoggedIn) {
       fetchCurrentUser();
@@ -182,6 +204,7 @@ export const AuthProvider = ({ children }) => {
     user,
     login,
     logout,
+    completeSsoLogin,
     loading,
     error,
     refreshUser,
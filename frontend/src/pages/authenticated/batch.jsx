@@ -211,6 +211,12 @@ function Batch() {
                           ` - Score: ${question.score}%`}
                       </p>
                     )}
+                    {!question.isAttempted && question.submissionsUsed > 0 && (
+                      <p className="mt-1 text-gray-400">
+                        Score so far: {question.score}% ({question.submissionsUsed}{" "}
+                        of {question.maxSubmissions} graded submissions used)
+                      </p>
+                    )}
                   </div>
                   <div className="mt-4">
                     {available ? (
@@ -14,6 +14,9 @@ function BatchTeacher() {
     time_limit: 30, // Default time limit of 30 minutes
     start_time: "", // Add start_time field
     end_time: "", // Add end_time field
+    max_submissions: 1, // Graded submissions allowed
+    scoring_policy: "best",
+    submission_penalty: 10, // Points deducted per wrong submission (penalty policy)
   });
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState(null);
@@ -102,6 +105,12 @@ function BatchTeacher() {
           time_limit: parseInt(newQuestion.time_limit) || 30,
           start_time: formattedStartTime,
           end_time: formattedEndTime,
+          max_submissions: parseInt(newQuestion.max_submissions) || 1,
+          scoring_policy: newQuestion.scoring_policy,
+          submission_penalty:
+            newQuestion.scoring_policy === "penalty"
+              ? parseInt(newQuestion.submission_penalty) || 0
+              : 0,
         }),
       });
 
@@ -117,6 +126,9 @@ function BatchTeacher() {
         time_limit: 30, // Reset to default
         start_time: "", // Reset start_time
         end_time: "", // Reset end_time
+        max_submissions: 1,
+        scoring_policy: "best",
+        submission_penalty: 10,
       });
 
       fetchQuestions();
@@ -294,6 +306,67 @@ function BatchTeacher() {
                     />
                   </div>
 
+                  {/* Graded submissions and how their scores combine */}
+                  <div className="grid grid-cols-3 gap-4">
+                    <div>
+                      <label className="block text-sm font-medium mb-1">
+                        Graded Submissions
+                      </label>
+                      <input
+                        type="number"
+                        min="1"
+                        max="100"
+                        value={newQuestion.max_submissions}
+                        onChange={(e) =>
+                          setNewQuestion({
+                            ...newQuestion,
+                            max_submissions: e.target.value,
+                          })
+                        }
+                        className="w-full border rounded p-2 bg-zinc-800"
+                      />
+                    </div>
+                    <div>
+                      <label className="block text-sm font-medium mb-1">
+                        Scoring Policy
+                      </label>
+                      <select
+                        value={newQuestion.scoring_policy}
+                        onChange={(e) =>
+                          setNewQuestion({
+                            ...newQuestion,
+                            scoring_policy: e.target.value,
+                          })
+                        }
+                        className="w-full border rounded p-2 bg-zinc-800"
+                      >
+                        <option value="best">Best score</option>
+                        <option value="last">Last score</option>
+                        <option value="penalty">Penalty per wrong submission</option>
+                      </select>
+                    </div>
+                    {newQuestion.scoring_policy === "penalty" && (
+                      <div>
+                        <label className="block text-sm font-medium mb-1">
+                          Penalty (points)
+                        </label>
+                        <input
+                          type="number"
+                          min="1"
+                          max="100"
+                          value={newQuestion.submission_penalty}
+                          onChange={(e) =>
+                            setNewQuestion({
+                              ...newQuestion,
+                              submission_penalty: e.target.value,
+                            })
+                          }
+                          className="w-full border rounded p-2 bg-zinc-800"
+                        />
+                      </div>
+                    )}
+                  </div>
+
                   {/* Add Schedule Fields */}
                   <div className="grid grid-cols-2 gap-4">
                     <div>
@@ -22,6 +22,14 @@ const CodingSpace = () => {
   const [languageId, setLanguageId] = useState(71); // Default: Python (as number)
   const editorRef = useRef(null);
   const [outputMessage, setOutputMessage] = useState("");
+  const [customInput, setCustomInput] = useState("");
+  const [runOutput, setRunOutput] = useState(null);
+  const [running, setRunning] = useState(false);
+
+  // Autosaved draft of the in-progress attempt
+  const [draft, setDraft] = useState(null);
+  const attemptIdRef = useRef(null);
+  const savedCodeRef = useRef(null);
 
   // Timer states
   const [timeRemaining, setTimeRemaining] = useState(null);
@@ -39,6 +47,8 @@ const CodingSpace = () => {
 
   // Submission confirmation modal state
   const [showSubmitConfirmation, setShowSubmitConfirmation] = useState(false);
+  // Graded submissions left in this attempt
+  const [submissionsLeft, setSubmissionsLeft] = useState(null);
 
   // Language mapping for Monaco Editor
   const languageMap = {
@@ -209,6 +219,38 @@ const CodingSpace = () => {
     };
   }, [questionId]);
 
+  // Autosave the editor contents while the attempt is in progress
+  useEffect(() => {
+    if (!testInProgress) return;
+
+    const interval = setInterval(async () => {
+      const attemptId = attemptIdRef.current;
+      if (!editorRef.current || !attemptId) return;
+
+      const code = editorRef.current.getValue();
+      if (code === savedCodeRef.current) return;
+
+      try {
+        const response = await fetch(API_ENDPOINTS.SAVE_DRAFT(attemptId), {
+          method: "PUT",
+          credentials: "include",
+          headers: {
+            "Content-Type": "application/json",
+          },
+          body: JSON.stringify({ code: code, language_id: languageId }),
+        });
+        // Throttled or rejected saves are retried on the next tick
+        if (response.ok) {
+          savedCodeRef.current = code;
+        }
+      } catch (err) {
+        console.error("Draft autosave failed:", err);
+      }
+    }, 10000);
+
+    return () => clearInterval(interval);
+  }, [testInProgress, languageId]);
+
   const fetchQuestionDetails = async () => {
     try {
       setLoading(true);
@@ -246,9 +288,24 @@ const CodingSpace = () => {
         setQuestion(data.data.Question);
         setTestCases(data.data.TestCases);
 
-        // Initialize timer based on API response
-        if (data.data.Question.TimeLimit && data.data.Attempt) {
-          initializeTimer(data.data.Question.TimeLimit, data.data.Attempt);
+        // Restore the code saved before the page was closed
+        const attempt = data.data.Attempt;
+        attemptIdRef.current = attempt?.id ?? null;
+        if (attempt?.draft) {
+          savedCodeRef.current = attempt.draft.code;
+          setDraft(attempt.draft);
+          setLanguageId(attempt.draft.languageId);
+        }
+        if (data.data.Question.Grading && data.data.Attempt) {
+          setSubmissionsLeft(
+            data.data.Question.Grading.max_submissions -
+              data.data.Attempt.gradedSubmissions
+          );
+        }
+
+        // Initialize timer from the deadline computed by the server
+        if (data.data.Attempt && data.data.Attempt.secondsLeft != null) {
+          initializeTimer(data.data.Attempt.secondsLeft);
         }
       } else {
         throw new Error("No question data returned");
@@ -261,46 +318,9 @@ const CodingSpace = () => {
     }
   };
 
-  // Initialize timer based on time limit and attempt information
-  const initializeTimer = (timeLimit, attempt) => {
-    // Try to get stored timer data from localStorage
-    const storedData = localStorage.getItem(`timer_${questionId}`);
-    let startTime;
-    let elapsedSeconds = 0;
-
-    if (storedData) {
-      const parsedData = JSON.parse(storedData);
-      startTime = new Date(parsedData.startTime);
-      elapsedSeconds = Math.floor((new Date() - startTime) / 1000);
-    } else if (attempt && attempt.StartTime) {
-      // If no stored data, use the attempt start time from the API
-      startTime = new Date(attempt.StartTime);
-      elapsedSeconds = attempt.TimeTakenSecs || 0;
-
-      // Store the timer data in localStorage
-      localStorage.setItem(
-        `timer_${questionId}`,
-        JSON.stringify({
-          startTime: startTime,
-          timeLimit: timeLimit * 60, // Convert minutes to seconds
-        })
-      );
-    } else {
-      // If no attempt data, use current time
-      startTime = new Date();
-      localStorage.setItem(
-        `timer_${questionId}`,
-        JSON.stringify({
-          startTime: startTime,
-          timeLimit: timeLimit * 60, // Convert minutes to seconds
-        })
-      );
-    }
-
-    // Calculate remaining time in seconds
-    const totalSeconds = timeLimit * 60; // Convert minutes to seconds
-    const remainingSeconds = totalSeconds - elapsedSeconds;
-
+  // Initialize timer with the seconds left until the attempt's deadline. The
+  // server measures this, so the timer agrees with what it will accept.
+  const initializeTimer = (remainingSeconds) => {
     if (remainingSeconds <= 0) {
       // Time already expired, auto-submit
       setTimeRemaining(0);
@@ -368,6 +388,71 @@ const CodingSpace = () => {
     setLanguageId(newLanguageId);
   };
 
+  // Follow a submission over server-sent events, showing each test result as it
+  // arrives. Falls back to polling if the stream can't be opened.
+  const waitForSubmission = (submissionId) =>
+    new Promise((resolve, reject) => {
+      const source = new EventSource(
+        API_ENDPOINTS.STREAM_SUBMISSION(submissionId),
+        { withCredentials: true }
+      );
+      source.addEventListener("status", (e) => {
+        const { status } = JSON.parse(e.data);
+        setOutputMessage(
+          status === "queued" ? "Waiting in queue..." : "Running test cases..."
+        );
+      });
+      source.addEventListener("test_result", (e) => {
+        const { index, test_result } = JSON.parse(e.data);
+        setResults((prev) => {
+          const testResults = [...(prev?.test_results || [])];
+          testResults[index] = test_result;
+          return { ...prev, test_results: testResults };
+        });
+      });
+      source.addEventListener("result", (e) => {
+        source.close();
+        resolve(JSON.parse(e.data).result);
+      });
+      source.addEventListener("error", (e) => {
+        source.close();
+        if (e.data) {
+          reject(new Error(JSON.parse(e.data).error || "Evaluation failed"));
+        } else {
+          // Stream unavailable or dropped, keep following it by polling
+          pollSubmission(submissionId).then(resolve, reject);
+        }
+      });
+    });
+
+  // Poll a queued submission until it has been evaluated, showing partial results
+  const pollSubmission = async (submissionId) => {
+    while (true) {
+      const response = await fetch(API_ENDPOINTS.GET_SUBMISSION(submissionId), {
+        credentials: "include",
+      });
+      const data = await response.json();
+      if (!response.ok) {
+        throw new Error(data.message || "Failed to fetch submission status");
+      }
+
+      const submission = data.data;
+      if (submission.status === "done") {
+        return submission.result;
+      }
+      if (submission.status === "failed") {
+        throw new Error(submission.error || "Evaluation failed");
+      }
+      if (submission.result) {
+        setResults(submission.result);
+      }
+      setOutputMessage(
+        submission.status === "queued" ? "Waiting in queue..." : "Running test cases..."
+      );
+      await new Promise((resolve) => setTimeout(resolve, 1000));
+    }
+  };
+
   // Handle code execution without score calculation (Run Code button)
   const handleRunCode = async (e) => {
     e.preventDefault();
@@ -422,8 +507,9 @@ const CodingSpace = () => {
       console.log("Parsed response:", data);
 
       if (data && data.data) {
-        setResults(data.data);
-        setOutputMessage(data.message || "Code evaluation completed");
+        const result = await waitForSubmission(data.data.submission_id);
+        setResults(result);
+        setOutputMessage("Code evaluation completed");
       } else {
         setOutputMessage("No results returned from evaluation");
       }
@@ -435,6 +521,40 @@ const CodingSpace = () => {
     }
   };
 
+  // Run code on the custom input, without grading or touching the attempt
+  const handleRunCustomInput = async () => {
+    if (!editorRef.current) return;
+
+    try {
+      setRunning(true);
+      setRunOutput(null);
+
+      const response = await fetch(API_ENDPOINTS.RUN_CODE, {
+        method: "POST",
+        credentials: "include",
+        headers: {
+          "Content-Type": "application/json",
+        },
+        body: JSON.stringify({
+          question_id: parseInt(questionId),
+          code: editorRef.current.getValue(),
+          language_id: languageId,
+          stdin: customInput,
+        }),
+      });
+
+      const data = await response.json();
+      if (!response.ok) {
+        throw new Error(data.message || "Failed to run code");
+      }
+      setRunOutput(data.data);
+    } catch (err) {
+      setRunOutput({ error: err.message });
+    } finally {
+      setRunning(false);
+    }
+  };
+
   // Handle final submission with score calculation
   const handleFinalSubmit = async () => {
     if (!editorRef.current) return;
@@ -478,6 +598,20 @@ const CodingSpace = () => {
         throw new Error(data.message || "Failed to submit solution");
       }
 
+      // Wait for grading to finish before leaving the page
+      const result = await waitForSubmission(data.data.submission_id);
+
+      // Stay on the question while graded submissions remain
+      if (result?.submissions_left > 0) {
+        setResults(result);
+        setSubmissionsLeft(result.submissions_left);
+        setOutputMessage(
+          `Graded: attempt score ${result.attempt_score}%, ${result.submissions_left} graded submission(s) left`
+        );
+        setSubmitting(false);
+        return;
+      }
+
       // Clean up timer data from localStorage
       localStorage.removeItem(`timer_${questionId}`);
       // Clean up tab warnings
@@ -612,6 +746,58 @@ const CodingSpace = () => {
               )}
             </div>
 
+            {/* Custom Input */}
+            <div className="mt-8">
+              <h2 className="text-xl font-semibold mb-3">Custom Input</h2>
+              <textarea
+                className="w-full h-24 p-2 bg-zinc-800 border border-zinc-700 rounded-md font-mono text-sm"
+                value={customInput}
+                onChange={(e) => setCustomInput(e.target.value)}
+                placeholder={
+                  question.Signature
+                    ? "One JSON value per line, one per parameter"
+                    : "Input passed to your program on stdin"
+                }
+              />
+              <button
+                type="button"
+                onClick={handleRunCustomInput}
+                disabled={running || submitting}
+                className={`mt-2 px-4 py-1 ${
+                  running || submitting
+                    ? "bg-zinc-500/10 text-zinc-400 border border-zinc-600/20"
+                    : "bg-blue-500/10 text-blue-500 border border-blue-500/20 hover:bg-blue-500/20"
+                } rounded-lg transition-colors`}
+              >
+                {running ? "Running..." : "Run on Input"}
+              </button>
+
+              {runOutput && (
+                <div className="mt-3 border border-zinc-700 rounded-lg p-3 bg-zinc-800 text-sm">
+                  {runOutput.error ? (
+                    <p className="text-red-400">{runOutput.error}</p>
+                  ) : (
+                    <>
+                      <div className="flex justify-between text-zinc-400 mb-2">
+                        <span>{runOutput.status}</span>
+                        <span>
+                          {runOutput.time}s, {runOutput.memory} KB
+                        </span>
+                      </div>
+                      <pre className="whitespace-pre-wrap">
+                        {runOutput.compile_output || runOutput.stdout}
+                      </pre>
+                      {runOutput.stderr && (
+                        <pre className="mt-2 whitespace-pre-wrap text-red-300">
+                          {runOutput.stderr}
+                        </pre>
+                      )}
+                    </>
+                  )}
+                </div>
+              )}
+            </div>
+
             {/* Results Area */}
             {outputMessage && (
               <div className="mt-4 p-3 bg-blue-900/30 border border-blue-700 rounded-md">
@@ -708,6 +894,17 @@ const CodingSpace = () => {
                                 )
                               )}
 
+                              {result.checker_message && (
+                                <div className="mt-1">
+                                  <span className="text-zinc-400">
+                                    Checker:{" "}
+                                  </span>
+                                  <pre className="inline">
+                                    {result.checker_message}
+                                  </pre>
+                                </div>
+                              )}
+
                               {/* For hidden test cases that failed but don't have errors */}
                               {!result.error && result.is_hidden && (
                                 <div className="text-amber-300">
@@ -744,7 +941,8 @@ const CodingSpace = () => {
               <option value={71}>Python 3</option>
               <option value={54}>C++ (GCC 9.2.0)</option>
               <option value={62}>Java</option>
-              <option value={50}>C</option>
+              {/* Function questions have no C harness */}
+              {!question?.Signature && <option value={50}>C</option>}
               <option value={63}>JavaScript</option>
             </select>
           </div>
@@ -782,7 +980,11 @@ const CodingSpace = () => {
             height="100%"
             width="100%"
             language={languageMap[languageId]}
-            defaultValue={defaultCodes[languageId]}
+            defaultValue={
+              draft?.languageId === languageId
+                ? draft.code
+                : question?.Stubs?.[languageId] ?? defaultCodes[languageId]
+            }
             theme="vs-dark"
             options={{
               fontSize: 16,
@@ -824,7 +1026,8 @@ const CodingSpace = () => {
                 return false;
               });
             }}
-            key={languageId} // Re-render editor when language changes
+            // Re-render editor when language changes, function stubs or the draft arrive
+            key={`${languageId}-${question?.Signature ? "function" : "program"}-${draft ? "draft" : "new"}`}
           />
         </div>
       </div>
@@ -892,8 +1095,10 @@ const CodingSpace = () => {
           <div className="bg-zinc-900/90 border border-zinc-800 rounded-lg p-6 max-w-md w-full">
             <h3 className="text-xl font-semibold mb-4">Submit Solution</h3>
             <p className="mb-6 text-gray-300">
-              Are you sure you want to submit your solution? Once submitted, you
-              cannot make any more changes or reattempt this question.
+              {submissionsLeft > 1
+                ? `This uses one of your ${submissionsLeft} remaining graded submissions.`
+                : `Are you sure you want to submit your solution? Once submitted, you
+              cannot make any more changes or reattempt this question.`}
               {timeRemaining !== null && (
                 <span className="block mt-2 font-medium">
                   You still have {formatTime(timeRemaining)} remaining.
@@ -100,12 +100,20 @@ const Dashboard = () => {
             <h1 className="text-4xl font-bold text-white">Dashboard</h1>
             <p className="text-zinc-400">Welcome back, {user.username}</p>
           </div>
-          <button
-            onClick={logout}
-            className="px-6 py-2 bg-red-500/10 text-red-400 border border-red-500/20 rounded-lg hover:bg-red-500/20"
-          >
-            Logout
-          </button>
+          <div className="flex gap-3">
+            <button
+              onClick={() => logout(true)}
+              className="px-6 py-2 text-zinc-400 border border-zinc-700 rounded-lg hover:bg-zinc-800"
+            >
+              Logout all devices
+            </button>
+            <button
+              onClick={() => logout()}
+              className="px-6 py-2 bg-red-500/10 text-red-400 border border-red-500/20 rounded-lg hover:bg-red-500/20"
+            >
+              Logout
+            </button>
+          </div>
         </div>
 
         {user.role === "teacher" ? (
@@ -1,28 +1,48 @@
 import React, { useState, useEffect } from "react";
 import { useAuth } from "../../context/AuthContext";
-import { Link, useNavigate } from "react-router-dom";
-
-// Utility function for SHA-256 hashing
-const sha256Hash = async (message) => {
-  const msgBuffer = new TextEncoder().encode(message);
-  const hashBuffer = await crypto.subtle.digest('SHA-256', msgBuffer);
-  const hashArray = Array.from(new Uint8Array(hashBuffer));
-  return hashArray.map(b => b.toString(16).padStart(2, '0')).join('');
-};
-
-// Generate 8-digit numeric nonce
-const generateNonce = () => {
-  // Generate a random number between 10000000 and 99999999 (8 digits)
-  return Math.floor(10000000 + Math.random() * 90000000).toString();
-};
+import {
+  Link,
+  useLocation,
+  useNavigate,
+  useSearchParams,
+} from "react-router-dom";
+import { API_ENDPOINTS } from "../../config/api";
 
 const Login = () => {
   const [username, setUsername] = useState("");
   const [password, setPassword] = useState("");
+  // Set when the account must pick a new password before it can log in
+  const [mustChangePassword, setMustChangePassword] = useState(false);
+  const [newPassword, setNewPassword] = useState("");
   const [error, setError] = useState("");
   const [loading, setLoading] = useState(false);
-  const { login, error: authError, user } = useAuth();
+  // Set when the account's email address isn't confirmed yet
+  const [mustVerifyEmail, setMustVerifyEmail] = useState(false);
+  // SSO providers configured on the server
+  const [ssoProviders, setSsoProviders] = useState([]);
+  const { login, completeSsoLogin, error: authError, user } = useAuth();
   const navigate = useNavigate();
+  // Message passed on by signup, password reset or email verification
+  const notice = useLocation().state?.notice;
+  // Set by the server when it sends the browser back from an SSO login
+  const [searchParams] = useSearchParams();
+  const ssoResult = searchParams.get("sso");
+  const ssoError = searchParams.get("sso_error");
+
+  useEffect(() => {
+    fetch(API_ENDPOINTS.OIDC_PROVIDERS)
+      .then((response) => (response.ok ? response.json() : { data: [] }))
+      .then((data) => setSsoProviders(data.data || []))
+      .catch((err) => console.error("Error fetching SSO providers:", err));
+  }, []);
+
+  useEffect(() => {
+    if (ssoError) {
+      setError(ssoError);
+    } else if (ssoResult === "success") {
+      completeSsoLogin();
+    }
+  }, [ssoResult, ssoError]);
 
   // Redirect if user is already logged in
   useEffect(() => {
@@ -43,6 +63,7 @@ const Login = () => {
 
     // Reset error state
     setError("");
+    setMustVerifyEmail(false);
 
     // Validate input
     if (!username || !password) {
@@ -50,21 +71,44 @@ const Login = () => {
       return;
     }
 
+    if (mustChangePassword && newPassword.length < 6) {
+      setError("New password must be at least 6 characters");
+      return;
+    }
+
     setLoading(true);
     try {
-      // First round of hashing
-      const firstHash = await sha256Hash(password);
-      
-      // Generate a random nonce
-      const nonce = generateNonce();
-      
-      // Second round of hashing with nonce
-      const finalHash = await sha256Hash(firstHash + nonce);
-      
-      // Pass the username, final hash, and nonce to the login function
-      const success = await login(username, finalHash, nonce);
-
-      if (success) {
+      let loginPassword = password;
+      if (mustChangePassword) {
+        const response = await fetch(API_ENDPOINTS.CHANGE_PASSWORD, {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({
+            username,
+            current_password: password,
+            new_password: newPassword,
+          }),
+        });
+        const data = await response.json();
+        if (!response.ok) {
+          setError(data.message || "Failed to change password");
+          return;
+        }
+        loginPassword = newPassword;
+      }
+
+      // The password is sent as is over TLS and hashed by the server
+      const success = await login(username, loginPassword);
+
+      if (success === "password_change_required") {
+        setMustChangePassword(true);
+        setError("You must choose a new password before signing in");
+      } else if (success === "email_verification_required") {
+        setMustVerifyEmail(true);
+        setError(
+          "Please confirm your email address with the link we sent you before signing in"
+        );
+      } else if (success) {
         // Replace current page with classroom after successful login
         navigate("/classroom", { replace: true });
       }
@@ -97,9 +141,23 @@ const Login = () => {
             Sign In
           </h1>
 
+          {notice && !error && (
+            <div className="bg-green-500/20 border border-green-500/50 text-green-100 px-3 py-2 rounded-md mb-4 text-sm">
+              {notice}
+            </div>
+          )}
+
           {error && (
             <div className="bg-red-500/20 border border-red-500/50 text-red-100 px-3 py-2 rounded-md mb-4 text-sm">
               {error}
+              {mustVerifyEmail && (
+                <Link
+                  to="/verify-email"
+                  className="block mt-1 text-blue-300 hover:text-blue-200"
+                >
+                  Send the link again
+                </Link>
+              )}
             </div>
           )}
 
@@ -138,6 +196,25 @@ const Login = () => {
               />
             </div>
 
+            {mustChangePassword && (
+              <div>
+                <label
+                  htmlFor="newPassword"
+                  className="text-sm font-medium text-gray-300 block mb-1"
+                >
+                  New Password
+                </label>
+                <input
+                  id="newPassword"
+                  type="password"
+                  placeholder="Choose a new password"
+                  className="w-full p-2 bg-white/5 border border-zinc-700 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500 text-white"
+                  onChange={(e) => setNewPassword(e.target.value)}
+                  disabled={loading}
+                />
+              </div>
+            )}
+
             <button
               type="submit"
               className="w-full bg-blue-600 text-white p-2.5 rounded-md hover:bg-blue-700 disabled:bg-blue-800/50 disabled:text-white/50 transition-colors duration-200 mt-2"
@@ -167,13 +244,38 @@ const Login = () => {
                   </svg>
                   Signing in...
                 </span>
+              ) : mustChangePassword ? (
+                "Change Password and Sign In"
               ) : (
                 "Sign In"
               )}
             </button>
           </form>
 
+          {ssoProviders.length > 0 && (
+            <div className="mt-4 space-y-2">
+              <p className="text-center text-sm text-gray-400">or</p>
+              {ssoProviders.map((provider) => (
+                <a
+                  key={provider.name}
+                  href={API_ENDPOINTS.OIDC_LOGIN(provider.name)}
+                  className="block w-full text-center bg-white/5 border border-zinc-700 text-white p-2.5 rounded-md hover:bg-white/10 transition-colors duration-200"
+                >
+                  Sign in with {provider.label}
+                </a>
+              ))}
+            </div>
+          )}
+
           <div className="mt-4 text-center text-gray-300">
+            <p className="mb-2">
+              <Link
+                to="/reset-password"
+                className="text-blue-400 hover:text-blue-300 transition-colors"
+              >
+                Forgot your password?
+              </Link>
+            </p>
             <p>
               Don't have an account?{" "}
               <Link
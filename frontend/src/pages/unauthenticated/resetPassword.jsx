@@ -0,0 +1,131 @@
+import React, { useState } from "react";
+import { Link, useNavigate, useSearchParams } from "react-router-dom";
+import { API_ENDPOINTS } from "../../config/api";
+
+// Asks for a password reset link, or with the token from the reset email
+// sets a new password
+const ResetPassword = () => {
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get("token");
+  const [email, setEmail] = useState("");
+  const [newPassword, setNewPassword] = useState("");
+  const [error, setError] = useState("");
+  const [message, setMessage] = useState("");
+  const [loading, setLoading] = useState(false);
+  const navigate = useNavigate();
+
+  const post = async (url, body) => {
+    const response = await fetch(url, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(body),
+    });
+    const data = await response.json();
+    if (!response.ok) {
+      throw new Error(data.message || "Request failed");
+    }
+    return data;
+  };
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    setError("");
+    setMessage("");
+
+    if (token && newPassword.length < 6) {
+      setError("New password must be at least 6 characters");
+      return;
+    }
+    if (!token && !email) {
+      setError("Please enter your email");
+      return;
+    }
+
+    setLoading(true);
+    try {
+      if (token) {
+        const data = await post(API_ENDPOINTS.RESET_PASSWORD, {
+          token,
+          new_password: newPassword,
+        });
+        navigate("/login", { replace: true, state: { notice: data.message } });
+      } else {
+        const data = await post(API_ENDPOINTS.FORGOT_PASSWORD, { email });
+        setMessage(data.message);
+      }
+    } catch (err) {
+      setError(err.message || "Error connecting to server");
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen pt-20 flex items-center justify-center p-4">
+      <div className="w-full max-w-md p-6 bg-white/10 backdrop-blur-2xl shadow-xl rounded-xl">
+        <h1 className="text-2xl font-bold mb-4 text-center text-white">
+          Reset Password
+        </h1>
+
+        {error && (
+          <div className="bg-red-500/20 border border-red-500/50 text-red-100 px-3 py-2 rounded-md mb-4 text-sm">
+            {error}
+          </div>
+        )}
+        {message && (
+          <div className="bg-green-500/20 border border-green-500/50 text-green-100 px-3 py-2 rounded-md mb-4 text-sm">
+            {message}
+          </div>
+        )}
+
+        <form className="space-y-3" onSubmit={handleSubmit}>
+          {token ? (
+            <input
+              type="password"
+              placeholder="Choose a new password"
+              className="w-full p-2 bg-white/5 border border-zinc-700 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500 text-white"
+              onChange={(e) => setNewPassword(e.target.value)}
+              disabled={loading}
+            />
+          ) : (
+            <>
+              <p className="text-sm text-gray-300">
+                Enter your email and we'll send you a link to choose a new
+                password.
+              </p>
+              <input
+                type="email"
+                placeholder="Enter your email"
+                className="w-full p-2 bg-white/5 border border-zinc-700 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500 text-white"
+                onChange={(e) => setEmail(e.target.value)}
+                disabled={loading}
+              />
+            </>
+          )}
+          <button
+            type="submit"
+            className="w-full bg-blue-600 text-white p-2.5 rounded-md hover:bg-blue-700 disabled:bg-blue-800/50 disabled:text-white/50 transition-colors duration-200"
+            disabled={loading}
+          >
+            {loading
+              ? "Please wait..."
+              : token
+              ? "Set New Password"
+              : "Send Reset Link"}
+          </button>
+        </form>
+
+        <div className="mt-4 text-center text-gray-300">
+          <Link
+            to="/login"
+            className="text-blue-400 hover:text-blue-300 transition-colors"
+          >
+            Back to sign in
+          </Link>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default ResetPassword;
@@ -3,18 +3,6 @@ import { useAuth } from "../../context/AuthContext";
 import { Link, useNavigate } from "react-router-dom";
 import { API_ENDPOINTS } from "../../config/api";
 
-// Helper function to convert string to SHA256 hash
-const sha256 = async (message) => {
-  // Encode as UTF-8
-  const msgBuffer = new TextEncoder().encode(message);
-  // Hash the message
-  const hashBuffer = await crypto.subtle.digest('SHA-256', msgBuffer);
-  // Convert ArrayBuffer to hex string
-  return Array.from(new Uint8Array(hashBuffer))
-    .map(b => b.toString(16).padStart(2, '0'))
-    .join('');
-};
-
 const SignUp = () => {
   const [username, setUsername] = useState("");
   const [password, setPassword] = useState("");
@@ -58,15 +46,12 @@ const SignUp = () => {
 
     setError("");
     try {
-      // Hash the password with SHA256
-      const hashedPassword = await sha256(password);
-      
       const response = await fetch(API_ENDPOINTS.SIGNUP, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ 
           username, 
-          password: hashedPassword, // Send hashed password instead
+          password, // Hashed by the server
           email, 
           userId, 
           role 
@@ -77,7 +62,13 @@ const SignUp = () => {
 
       if (response.status === 200) {
         console.log("Signed up:", data);
-        navigate("/login", { replace: true });
+        navigate("/login", {
+          replace: true,
+          state: {
+            notice:
+              "Account created. Check your email for a link to confirm your address.",
+          },
+        });
       } else {
         setError(data.message || "Signup failed");
       }
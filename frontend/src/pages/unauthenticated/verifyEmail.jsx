@@ -0,0 +1,129 @@
+import React, { useEffect, useRef, useState } from "react";
+import { Link, useNavigate, useSearchParams } from "react-router-dom";
+import { API_ENDPOINTS } from "../../config/api";
+
+// Confirms an email address with the token from the verification email, or
+// without a token asks for a new verification link
+const VerifyEmail = () => {
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get("token");
+  const [email, setEmail] = useState("");
+  const [error, setError] = useState("");
+  const [message, setMessage] = useState("");
+  const [loading, setLoading] = useState(false);
+  const navigate = useNavigate();
+  // Tokens only work once, so don't send it twice in development's double render
+  const verified = useRef(false);
+
+  useEffect(() => {
+    if (!token || verified.current) return;
+    verified.current = true;
+
+    const verify = async () => {
+      setLoading(true);
+      try {
+        const response = await fetch(API_ENDPOINTS.VERIFY_EMAIL, {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ token }),
+        });
+        const data = await response.json();
+        if (!response.ok) {
+          setError(data.message || "Failed to verify email");
+          return;
+        }
+        navigate("/login", { replace: true, state: { notice: data.message } });
+      } catch (err) {
+        setError("Error connecting to server");
+      } finally {
+        setLoading(false);
+      }
+    };
+    verify();
+  }, [token, navigate]);
+
+  const handleResend = async (e) => {
+    e.preventDefault();
+    setError("");
+    setMessage("");
+    if (!email) {
+      setError("Please enter your email");
+      return;
+    }
+
+    setLoading(true);
+    try {
+      const response = await fetch(API_ENDPOINTS.RESEND_VERIFICATION, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ email }),
+      });
+      const data = await response.json();
+      if (!response.ok) {
+        setError(data.message || "Failed to send the link");
+        return;
+      }
+      setMessage(data.message);
+    } catch (err) {
+      setError("Error connecting to server");
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen pt-20 flex items-center justify-center p-4">
+      <div className="w-full max-w-md p-6 bg-white/10 backdrop-blur-2xl shadow-xl rounded-xl">
+        <h1 className="text-2xl font-bold mb-4 text-center text-white">
+          Verify Email
+        </h1>
+
+        {error && (
+          <div className="bg-red-500/20 border border-red-500/50 text-red-100 px-3 py-2 rounded-md mb-4 text-sm">
+            {error}
+          </div>
+        )}
+        {message && (
+          <div className="bg-green-500/20 border border-green-500/50 text-green-100 px-3 py-2 rounded-md mb-4 text-sm">
+            {message}
+          </div>
+        )}
+
+        {token && loading ? (
+          <p className="text-center text-gray-300">Verifying your email...</p>
+        ) : (
+          <form className="space-y-3" onSubmit={handleResend}>
+            <p className="text-sm text-gray-300">
+              Enter your email to get a new verification link.
+            </p>
+            <input
+              type="email"
+              placeholder="Enter your email"
+              className="w-full p-2 bg-white/5 border border-zinc-700 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500 text-white"
+              onChange={(e) => setEmail(e.target.value)}
+              disabled={loading}
+            />
+            <button
+              type="submit"
+              className="w-full bg-blue-600 text-white p-2.5 rounded-md hover:bg-blue-700 disabled:bg-blue-800/50 disabled:text-white/50 transition-colors duration-200"
+              disabled={loading}
+            >
+              {loading ? "Sending..." : "Send Verification Link"}
+            </button>
+          </form>
+        )}
+
+        <div className="mt-4 text-center text-gray-300">
+          <Link
+            to="/login"
+            className="text-blue-400 hover:text-blue-300 transition-colors"
+          >
+            Back to sign in
+          </Link>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default VerifyEmail;